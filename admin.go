@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A cache file listed by the admin endpoints.
+type cacheEntryInfo struct {
+	Key string `json:"key"`
+	cacheQuery
+	Timestamp string `json:"timestamp"`
+	Size      int64  `json:"size"`
+	Songs     int    `json:"songs"`
+	Expired   bool   `json:"expired"`
+}
+
+// newAdminCacheHandler function: Create the handler of the /admin/cache endpoints for a cache directory
+//
+//	GET    /admin/cache                        list cached queries
+//	GET    /admin/cache/entry?msg=         view one entry, or ?key=
+//	DELETE /admin/cache?msg= | ?prefix= | ?all=1 purge entries
+//	POST   /admin/cache/refresh?msg=       refresh a query now
+func newAdminCacheHandler(cacheDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminAuthorized(w, r) {
+			return
+		}
+		w.Header().Set("Server", "MeowMusicServer")
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		switch path := strings.TrimSuffix(r.URL.Path, "/"); {
+		case path == "/admin/cache" && r.Method == http.MethodGet:
+			adminListCache(w, cacheDir)
+		case path == "/admin/cache" && r.Method == http.MethodDelete:
+			adminPurgeCache(w, r, cacheDir)
+		case path == "/admin/cache/entry" && r.Method == http.MethodGet:
+			adminViewCache(w, r, cacheDir)
+		case path == "/admin/cache/refresh" && r.Method == http.MethodPost:
+			adminRefreshCache(w, r, cacheDir)
+		case path == "/admin/cache" || path == "/admin/cache/entry" || path == "/admin/cache/refresh":
+			writeAdminResponse(w, http.StatusMethodNotAllowed, "Method not allowed.", nil)
+		default:
+			writeAdminResponse(w, http.StatusNotFound, "Unknown admin endpoint.", nil)
+		}
+	}
+}
+
+// adminAuthorized function: Check the bearer token against ADMIN_TOKEN, the endpoints do not exist without one
+func adminAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		NotFoundHandler(w, r)
+		return false
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		w.Header().Set("Server", "MeowMusicServer")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeAdminResponse(w, http.StatusUnauthorized, "Admin token required.", nil)
+		return false
+	}
+	return true
+}
+
+// Helper function to write an admin response, codes follow the HTTP status
+func writeAdminResponse(w http.ResponseWriter, status int, msg string, data interface{}) {
+	code := 0
+	if status != http.StatusOK {
+		code = status
+	}
+	if data == nil {
+		data = []interface{}{}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{
+		Code:  code,
+		Msg:   msg,
+		Data:  data,
+		Tips:  "Provide by " + os.Getenv("WEBSITE_NAME"),
+		Cache: "no-cache",
+	})
+}
+
+// listCacheEntries function: Describe every cache file of a directory, newest first
+func listCacheEntries(cacheDir string) []cacheEntryInfo {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return []cacheEntryInfo{}
+	}
+	index := readCacheIndex(cacheDir)
+	now := time.Now()
+	infos := []cacheEntryInfo{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !isCacheDataFile(name) {
+			continue
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		songs, timestamp := readCacheFile(filepath.Join(cacheDir, name))
+		infos = append(infos, cacheEntryInfo{
+			Key:        strings.TrimSuffix(name, ".json"),
+			cacheQuery: index[name],
+			Timestamp:  timestamp,
+			Size:       fileInfo.Size(),
+			Songs:      len(songs),
+			Expired:    cacheExpired(timestamp, now),
+		})
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		if infos[i].Timestamp != infos[j].Timestamp {
+			return infos[i].Timestamp > infos[j].Timestamp
+		}
+		return infos[i].Key < infos[j].Key
+	})
+	return infos
+}
+
+// Helper function to list the cache with the counters of the memory tier
+func adminListCache(w http.ResponseWriter, cacheDir string) {
+	writeAdminResponse(w, http.StatusOK, "API Operation successful.", map[string]interface{}{
+		"entries": listCacheEntries(cacheDir),
+		"stats":   apiCache.snapshot(),
+	})
+}
+
+// Helper function to return the cache query of msg, the filters of /api share it
+func adminCacheQuery(queryParams url.Values) (cacheQuery, bool) {
+	query := newCacheQuery(queryParams.Get("msg"))
+	return query, query.Msg != ""
+}
+
+// Helper function to return the cache file name selected by ?key= or by msg
+func adminCacheFileName(r *http.Request) (string, bool) {
+	queryParams := r.URL.Query()
+	if key := queryParams.Get("key"); key != "" {
+		return key + ".json", isCacheKeyFile(key + ".json")
+	}
+	query, ok := adminCacheQuery(queryParams)
+	return query.fileName(), ok
+}
+
+// Helper function to show one cache entry with its songs
+func adminViewCache(w http.ResponseWriter, r *http.Request, cacheDir string) {
+	name, ok := adminCacheFileName(r)
+	if !ok {
+		writeAdminResponse(w, http.StatusBadRequest, "A valid 'key' or 'msg' parameter is required.", nil)
+		return
+	}
+	fileInfo, err := os.Stat(filepath.Join(cacheDir, name))
+	if err != nil {
+		writeAdminResponse(w, http.StatusNotFound, "No cache entry for the given query.", nil)
+		return
+	}
+	songs, timestamp := readCacheFile(filepath.Join(cacheDir, name))
+	info := cacheEntryInfo{
+		Key:        strings.TrimSuffix(name, ".json"),
+		cacheQuery: readCacheIndex(cacheDir)[name],
+		Timestamp:  timestamp,
+		Size:       fileInfo.Size(),
+		Songs:      len(songs),
+		Expired:    cacheExpired(timestamp, time.Now()),
+	}
+	writeAdminResponse(w, http.StatusOK, "API Operation successful.", map[string]interface{}{
+		"entry": info,
+		"songs": songs,
+	})
+}
+
+// Helper function to purge the entries of a search term, of a prefix or all of them
+func adminPurgeCache(w http.ResponseWriter, r *http.Request, cacheDir string) {
+	queryParams := r.URL.Query()
+	var match func(query cacheQuery) bool
+	switch {
+	case queryParams.Get("all") == "1" || queryParams.Get("all") == "true":
+		match = func(cacheQuery) bool { return true }
+	case queryParams.Get("msg") != "":
+		msg := normaliseQuery(queryParams.Get("msg"))
+		match = func(query cacheQuery) bool { return query.Msg == msg }
+	case queryParams.Get("prefix") != "":
+		prefix := normaliseQuery(queryParams.Get("prefix"))
+		match = func(query cacheQuery) bool { return query.Msg != "" && strings.HasPrefix(query.Msg, prefix) }
+	default:
+		writeAdminResponse(w, http.StatusBadRequest, "One of 'msg', 'prefix' or 'all=1' is required.", nil)
+		return
+	}
+	removed := invalidateCacheFiles(cacheDir, match)
+	writeAdminResponse(w, http.StatusOK, "API Operation successful.", map[string]int{"removed": removed})
+}
+
+// Helper function to refresh a query synchronously, bypassing the minimum refresh interval
+func adminRefreshCache(w http.ResponseWriter, r *http.Request, cacheDir string) {
+	query, ok := adminCacheQuery(r.URL.Query())
+	if !ok {
+		writeAdminResponse(w, http.StatusBadRequest, "A valid 'msg' parameter is required.", nil)
+		return
+	}
+	cacheFilePath := cacheFilePathFor(cacheDir, query)
+	cacheRefreshes.forget(cacheFilePath)
+	songs, _ := refreshCache(query, cacheDir)
+	_, timestamp := readCacheFile(cacheFilePath)
+	writeAdminResponse(w, http.StatusOK, "API Operation successful.", map[string]interface{}{
+		"key":       strings.TrimSuffix(query.fileName(), ".json"),
+		"timestamp": timestamp,
+		"songs":     songs,
+	})
+}
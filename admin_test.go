@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper function to call the admin endpoints of a cache directory
+func adminRequest(t *testing.T, cacheDir string, method string, target string, token string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	newAdminCacheHandler(cacheDir).ServeHTTP(rr, req)
+	var response struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	return rr.Code, response.Data
+}
+
+// TestAdminCacheAuth Test that the admin endpoints require ADMIN_TOKEN
+func TestAdminCacheAuth(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("ADMIN_TOKEN", "")
+	if code, _ := adminRequest(t, cacheDir, "GET", "/admin/cache", ""); code != http.StatusNotFound {
+		t.Errorf("Without ADMIN_TOKEN got status %d, want %d", code, http.StatusNotFound)
+	}
+	t.Setenv("ADMIN_TOKEN", "secret")
+	if code, _ := adminRequest(t, cacheDir, "GET", "/admin/cache", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("With a wrong token got status %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := adminRequest(t, cacheDir, "GET", "/admin/cache", "secret"); code != http.StatusOK {
+		t.Errorf("With the token got status %d, want %d", code, http.StatusOK)
+	}
+	if code, _ := adminRequest(t, cacheDir, "PUT", "/admin/cache", "secret"); code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT got status %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+}
+
+// TestAdminCacheEndpoints Test listing, viewing, purging and refreshing cache entries
+func TestAdminCacheEndpoints(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+	t.Setenv("MEDIA_ROOT", root)
+	writeTestFile(t, root, "metadata.json", []byte(`{"api":[],"other":[{"song_name":"晴天","singer":"周杰伦"},{"song_name":"晴天娃娃","singer":"Meow"}]}`))
+	defer func(previous *libraryIndex) { library = previous }(library)
+	library = newLibraryIndex()
+
+	now := time.Now().Format(time.RFC3339)
+	for _, query := range []cacheQuery{newCacheQuery("晴天"), {Msg: "晴天", Singer: "周杰伦"}, newCacheQuery("晴天娃娃"), newCacheQuery("Rain")} {
+		writeCacheFile(cacheFilePathFor(cacheDir, query), []Song{{Song: query.Msg}}, now)
+		recordCacheQuery(cacheDir, query)
+	}
+
+	_, data := adminRequest(t, cacheDir, "GET", "/admin/cache", "secret")
+	if entries, _ := data["entries"].([]interface{}); len(entries) != 4 {
+		t.Errorf("Expected 4 cache entries, got %v", data["entries"])
+	}
+
+	// Every filter of msg shares its entry, the filtered entries of older versions are reached by key
+	code, data := adminRequest(t, cacheDir, "GET", "/admin/cache/entry?msg=%E6%99%B4%E5%A4%A9&singer=%E5%91%A8%E6%9D%B0%E4%BC%A6", "secret")
+	if entry, _ := data["entry"].(map[string]interface{}); code != http.StatusOK || entry["msg"] != "晴天" || entry["singer"] != nil {
+		t.Errorf("Unexpected entry: %d %v", code, data)
+	}
+	legacyKey := strings.TrimSuffix(cacheQuery{Msg: "晴天", Singer: "周杰伦"}.fileName(), ".json")
+	code, data = adminRequest(t, cacheDir, "GET", "/admin/cache/entry?key="+legacyKey, "secret")
+	if entry, _ := data["entry"].(map[string]interface{}); code != http.StatusOK || entry["singer"] != "周杰伦" {
+		t.Errorf("Unexpected legacy entry: %d %v", code, data)
+	}
+	if code, _ := adminRequest(t, cacheDir, "GET", "/admin/cache/entry?msg=Snow", "secret"); code != http.StatusNotFound {
+		t.Errorf("Missing entry got status %d, want %d", code, http.StatusNotFound)
+	}
+
+	// Purge one search term with every filter, then a prefix
+	if _, data := adminRequest(t, cacheDir, "DELETE", "/admin/cache?msg=%E6%99%B4%E5%A4%A9", "secret"); data["removed"] != float64(2) {
+		t.Errorf("Purge by msg removed %v, want 2", data["removed"])
+	}
+	if _, data := adminRequest(t, cacheDir, "DELETE", "/admin/cache?prefix=Ra", "secret"); data["removed"] != float64(1) {
+		t.Errorf("Purge by prefix removed %v, want 1", data["removed"])
+	}
+	if code, _ := adminRequest(t, cacheDir, "DELETE", "/admin/cache", "secret"); code != http.StatusBadRequest {
+		t.Errorf("Purge without parameters got status %d, want %d", code, http.StatusBadRequest)
+	}
+
+	// A synchronous refresh rebuilds the entry from the sources
+	code, data = adminRequest(t, cacheDir, "POST", "/admin/cache/refresh?msg=%E6%99%B4%E5%A4%A9", "secret")
+	if songs, _ := data["songs"].([]interface{}); code != http.StatusOK || len(songs) != 2 {
+		t.Errorf("Unexpected refresh result: %d %v", code, data)
+	}
+	if _, err := os.Stat(cacheFilePathFor(cacheDir, newCacheQuery("晴天"))); err != nil {
+		t.Errorf("Refresh did not write the cache file: %s", err)
+	}
+
+	if _, data := adminRequest(t, cacheDir, "DELETE", "/admin/cache?all=1", "secret"); data["removed"] != float64(2) {
+		t.Errorf("Purge all removed %v, want 2", data["removed"])
+	}
+	if index := readCacheIndex(cacheDir); len(index) != 0 {
+		t.Errorf("Cache index should be empty, got %+v", index)
+	}
+}
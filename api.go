@@ -1,16 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
-	"time"
 )
 
 // Api Response.
@@ -22,6 +21,7 @@ type Response struct {
 	Ip            string      `json:"ip"`
 	Cache         string      `json:"cache"`
 	CacheUpdating bool        `json:"cache_updating"`
+	Total         int         `json:"total,omitempty"` // Number of songs before pagination
 }
 
 // API Song response.
@@ -33,6 +33,13 @@ type Song struct {
 	Cover    string      `json:"cover"`
 	MusicURL interface{} `json:"music_url"`
 	Lyric    interface{} `json:"lyric"`
+	Track    int         `json:"track,omitempty"`
+	Disc     int         `json:"disc,omitempty"`
+	Year     int         `json:"year,omitempty"`
+	Genre    string      `json:"genre,omitempty"`
+	Duration int         `json:"duration,omitempty"` // seconds
+	Source   string      `json:"source,omitempty"`   // "local" or the source of the provider
+	ID       string      `json:"id,omitempty"`       // Stable across searches, see /api/song/{id}
 }
 
 type MusicURL struct {
@@ -48,6 +55,8 @@ type Lyric struct {
 	Mrc string `json:"mrc"`
 	Lrc string `json:"lrc"`
 	Txt string `json:"txt"`
+	Vtt string `json:"vtt,omitempty"` // WebVTT for HTML5 <track>, only listed by /api/v2
+	Srt string `json:"srt,omitempty"`
 }
 
 // apiHandler is the handler function for API requests.
@@ -56,19 +65,19 @@ func apiHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	queryParams := r.URL.Query()
 	//key := queryParams.Get("key")
-	msg := queryParams.Get("msg")
-	singer := queryParams.Get("singer")
-	numStr := queryParams.Get("num")
+	msg := normaliseQuery(queryParams.Get("msg"))
 
 	ip, err := IPhandler(r)
 	if err != nil {
 		ip = "0.0.0.0"
 	}
 
-	if msg == "" {
+	// Check msg, its query syntax and the filters, a song is returned only when it passes all of them
+	filters, code, errMsg := checkSearchRequest(msg, queryParams)
+	if code != 0 {
 		response := Response{
-			Code:  1,
-			Msg:   "API Operation failed: 'msg' parameter is required.",
+			Code:  code,
+			Msg:   errMsg,
 			Data:  []interface{}{},
 			Tips:  "Provide by " + os.Getenv("WEBSITE_NAME"),
 			Ip:    ip,
@@ -78,139 +87,23 @@ func apiHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Convert numStr to int if provided
-	var num int
-	if numStr != "" {
-		num, err = strconv.Atoi(numStr)
-		if err != nil {
-			response := Response{
-				Code:  2,
-				Msg:   "Invalid 'num' parameter provided.",
-				Data:  []interface{}{},
-				Tips:  "Provide by " + os.Getenv("WEBSITE_NAME"),
-				Ip:    ip,
-				Cache: "no-cache",
-			}
-			json.NewEncoder(w).Encode(response)
-			return
-		}
-	}
-
-	// Construct a complete file path for cache file
-	cacheFilePath := filepath.Join("./cache", msg+".json")
-	cacheDir := "./cache"
-
-	// Delete all expired cache files in the background
-	cacheTime, err := strconv.Atoi(os.Getenv("API_CACHE_TIME"))
+	// Read the requested page, every song is returned without one
+	page, err := parsePageParams(queryParams)
 	if err != nil {
-		fmt.Println("Error getting API_CACHE_TIME from environment variable: ", err)
-		return
-	}
-	fmt.Println("Deleting expired cache files in the background...")
-	go deleteExpiredCacheFiles(cacheDir, cacheTime)
-
-	// Check if cache file exists and is not expired
-	if isCacheValid(cacheFilePath) {
-		// Read from cache file
-		songs, timestamp := readCacheFile(cacheFilePath)
-
-		// Filter songs based on num if provided
-		var filteredSongs []Song
-		if numStr != "" {
-			for _, song := range songs {
-				if song.Num == num {
-					filteredSongs = append(filteredSongs, song)
-				}
-			}
-		} else {
-			filteredSongs = songs
-		}
-
-		// Filter songs based on singer if provided
-		if singer != "" {
-			for _, song := range songs {
-				if strings.Contains(song.Singer, singer) {
-					filteredSongs = append(filteredSongs, song)
-				}
-			}
-		} else {
-			filteredSongs = songs
-		}
-
-		// If no songs found, return an empty array
-		if len(filteredSongs) == 0 {
-			response := Response{
-				Code:  3,
-				Msg:   "No songs found for the given query.",
-				Data:  []interface{}{},
-				Tips:  "Provide by " + os.Getenv("WEBSITE_NAME"),
-				Ip:    ip,
-				Cache: timestamp,
-			}
-			json.NewEncoder(w).Encode(response)
-			fmt.Println("Starting update cache file: ", cacheFilePath)
-			go func() {
-				newSongs := apiSongHandlerOnMetadata(msg)
-				newTimestamp := time.Now().Format(time.RFC3339)
-				writeCacheFile(cacheFilePath, newSongs, newTimestamp)
-				fmt.Println("Updated cache file: ", cacheFilePath)
-			}()
-			return
-		}
-
-		// Prepare the response with cache timestamp
 		response := Response{
-			Code:  0,
-			Msg:   "API Operation successful.",
-			Data:  filteredSongs,
+			Code:  4,
+			Msg:   "Invalid 'page', 'page_size', 'offset' or 'limit' parameter provided.",
+			Data:  []interface{}{},
 			Tips:  "Provide by " + os.Getenv("WEBSITE_NAME"),
 			Ip:    ip,
-			Cache: timestamp,
+			Cache: "no-cache",
 		}
-
-		// Update cache in the background
-		response.CacheUpdating = true
-		// Encode and send the response
 		json.NewEncoder(w).Encode(response)
-		fmt.Println("Starting update cache file: ", cacheFilePath)
-		go func() {
-			newSongs := apiSongHandlerOnMetadata(msg)
-			newTimestamp := time.Now().Format(time.RFC3339)
-			writeCacheFile(cacheFilePath, newSongs, newTimestamp)
-			fmt.Println("Updated cache file: ", cacheFilePath)
-		}()
 		return
 	}
 
-	// If cache file does not exist or is expired, get songs based on msg
-	fmt.Println(msg + " cache file not found or expired.")
-	var songs []Song
-	// get local songs
-	localSongs := getLocalSongs(msg)
-	songs = append(songs, localSongs...)
-
-	// Filter songs based on num if provided
-	var filteredSongs []Song
-	if numStr != "" {
-		for _, song := range songs {
-			if song.Num == num {
-				filteredSongs = append(filteredSongs, song)
-			}
-		}
-	} else {
-		filteredSongs = songs
-	}
-
-	// Filter songs based on singer if provided
-	if singer != "" {
-		for _, song := range songs {
-			if strings.Contains(song.Singer, singer) {
-				filteredSongs = append(filteredSongs, song)
-			}
-		}
-	} else {
-		filteredSongs = songs
-	}
+	// Answer from the cache or the local songs, the filters are applied to the cached songs of msg
+	songs, cache := cachedSearch(msg, filters)
 
 	// If no songs found, return an empty array
 	if len(songs) == 0 {
@@ -220,48 +113,71 @@ func apiHandler(w http.ResponseWriter, r *http.Request) {
 			Data:          []interface{}{},
 			Tips:          "Provide by " + os.Getenv("WEBSITE_NAME"),
 			Ip:            ip,
-			Cache:         "no-cache",
-			CacheUpdating: numStr == "",
+			Cache:         cache,
+			CacheUpdating: cache == "no-cache",
 		}
 		json.NewEncoder(w).Encode(response)
-		fmt.Println("Starting update cache file: ", cacheFilePath)
-		go func() {
-			newSongs := apiSongHandlerOnMetadata(msg)
-			newTimestamp := time.Now().Format(time.RFC3339)
-			writeCacheFile(cacheFilePath, newSongs, newTimestamp)
-			fmt.Println("Updated cache file: ", cacheFilePath)
-		}()
 		return
 	}
 
-	// Prepare the response
+	// Prepare the response, the cache is updated in the background
 	response := Response{
 		Code:          0,
 		Msg:           "API Operation successful.",
-		Data:          filteredSongs,
+		Data:          paginate(songs, page),
 		Tips:          "Provide by " + os.Getenv("WEBSITE_NAME"),
 		Ip:            ip,
-		Cache:         "no-cache",
-		CacheUpdating: numStr == "",
+		Cache:         cache,
+		CacheUpdating: true,
+		Total:         len(songs),
 	}
-
-	// Then get songs from external APIs in the background
-	response.CacheUpdating = true
 	json.NewEncoder(w).Encode(response)
-	fmt.Println("Starting update cache file: ", cacheFilePath)
-	go func() {
-		newSongs := apiSongHandlerOnMetadata(msg)
-		newTimestamp := time.Now().Format(time.RFC3339)
-		writeCacheFile(cacheFilePath, newSongs, newTimestamp)
-		fmt.Println("Updated cache file: ", cacheFilePath)
-	}()
+}
+
+// Helper function to answer a search from the cache, or from the local songs when it is not cached, and refresh the cache in the background
+func cachedSearch(msg string, filters songFilters) ([]Song, string) {
+	cacheDir := cacheDirPath()
+	query := newCacheQuery(msg)
+	defer refreshCacheInBackground(query, cacheDir)
+
+	// Check if the query is cached in memory or on disk and is not expired
+	if songs, timestamp, ok := apiCache.get(cacheFilePathFor(cacheDir, query)); ok {
+		return filters.apply(songs), timestamp
+	}
+
+	// If cache file does not exist or is expired, get songs based on msg, upstream songs follow in the cache
+	fmt.Println(msg + " cache file not found or expired.")
+	return filters.apply(getLocalSongs(msg)), "no-cache"
+}
+
+// Helper function to check a search request, returning its filters or the Response code and message of the first error
+func checkSearchRequest(msg string, queryParams url.Values) (songFilters, int, string) {
+	if msg == "" {
+		return songFilters{}, 1, "API Operation failed: 'msg' parameter is required."
+	}
+	// Check the syntax of msg, such as `singer:周杰伦 "晴天" -live`, before anything is searched
+	if _, err := parseSearchQuery(msg); err != nil {
+		return songFilters{}, 5, "Invalid 'msg' query: " + err.Error() + "."
+	}
+	filters, err := parseSongFilters(queryParams)
+	if err != nil {
+		param := "num"
+		var invalid *filterError
+		if errors.As(err, &invalid) {
+			param = invalid.Param
+		}
+		return songFilters{}, 2, "Invalid '" + param + "' parameter provided."
+	}
+	return filters, 0, ""
 }
 
 type API struct {
-	APIURL  string `json:"api_url"`
-	APIType string `json:"api_type"`
-	APIKey  string `json:"api_key"`
-	Sources string `json:"sources"`
+	APIURL  string  `json:"api_url"`
+	APIType string  `json:"api_type"`
+	APIKey  string  `json:"api_key"`
+	Sources string  `json:"sources"`
+	Timeout int     `json:"timeout,omitempty"` // seconds, PROVIDER_TIMEOUT when 0
+	Weight  float64 `json:"weight,omitempty"`  // ranking weight, 1 when 0
 }
 
 type OtherSong struct {
@@ -280,309 +196,402 @@ type Metadata struct {
 
 // Local Song handler.
 func getLocalSongs(msg string) []Song {
-	// Construct a complete file path for metadata.json
-	metadataFilePath := filepath.Join("./music-uploads", "metadata.json")
+	search, err := parseSearchQuery(msg)
+	if err != nil {
+		fmt.Println("Error parsing search query: ", err)
+		return []Song{}
+	}
 
-	// Read the metadata file
-	metadata, err := readMetadataFile(metadataFilePath)
+	// Read the metadata file, cached by the library index until it is modified
+	metadata, err := library.getMetadata()
 	if err != nil {
 		fmt.Println("Error reading metadata file: ", err)
 		return []Song{}
 	}
 
-	// Get the song array from metadata
-	otherSongs := getSongArray(metadata)
-
-	// Scan the music-uploads directory for artist-song folders
-	artistSongFolders := scanArtistSongFolders("./music-uploads")
+	// Rank the matches before they are numbered
+	return rankSongs(localCandidates(metadata, search))
+}
 
-	// Initialize a counter for songs
-	songCounter := 0
-	var filteredSongs []Song
+// Helper function to collect the library and metadata.json "other" songs matching a search query
+func localCandidates(metadata *Metadata, search *searchQuery) []rankedSong {
+	var candidates []rankedSong
+	weight := searchLocalWeight()
 
-	// Convert artist-song folders to Song
-	for _, artistSongFolder := range artistSongFolders {
-		song := Song{
-			Num:      0, // Initialize Num to 0
-			Song:     artistSongFolder.songName,
-			Singer:   artistSongFolder.artistName,
-			Album:    artistSongFolder.albumName,
-			Cover:    getCoverURL(artistSongFolder.artistName, artistSongFolder.songName, artistSongFolder.albumName),
-			MusicURL: getMusicURL(artistSongFolder.artistName, artistSongFolder.songName, artistSongFolder.albumName),
-			Lyric:    getLyricURL(artistSongFolder.artistName, artistSongFolder.songName, artistSongFolder.albumName),
-		}
-
-		// Check if the song matches the msg
-		if strings.Contains(song.Song, msg) || strings.Contains(song.Singer, msg) || strings.Contains(song.Album, msg) {
-			songCounter++
-			song.Num = songCounter
-			filteredSongs = append(filteredSongs, song)
+	// Local songs come from the library index, which also knows their pinyin
+	for _, entry := range library.entries() {
+		// Check if the song matches the query
+		if score := search.score(entry.song, entry.pinyin); score > 0 {
+			entry.song.Source = localSource
+			candidates = append(candidates, rankedSong{song: entry.song, score: score, weight: weight, local: true, order: len(candidates)})
 		}
 	}
 
-	// Convert OtherSong to Song
-	for _, otherSong := range otherSongs {
-		song := Song{
-			Num:      0, // Initialize Num to 0
-			Song:     otherSong.SongName,
-			Singer:   otherSong.Singer,
-			Album:    otherSong.Album,
-			Cover:    otherSong.Cover,
-			MusicURL: otherSong.MusicURL,
-			Lyric:    otherSong.LyricURL,
-		}
+	for _, otherSong := range getSongArray(metadata) {
+		song := otherToSong(otherSong)
 
-		// Check if the song matches the msg
-		if strings.Contains(song.Song, msg) || strings.Contains(song.Singer, msg) || strings.Contains(song.Album, msg) {
-			songCounter++
-			song.Num = songCounter
-			filteredSongs = append(filteredSongs, song)
+		// Check if the song matches the query
+		if score := search.score(song, pinyinOfSong(song)); score > 0 {
+			candidates = append(candidates, rankedSong{song: song, score: score, weight: weight, local: true, order: len(candidates)})
 		}
 	}
+	return candidates
+}
 
-	// Return the filtered song array
-	return filteredSongs
+// Helper function to convert a song of the "other" list of metadata.json to Song
+func otherToSong(otherSong OtherSong) Song {
+	return Song{
+		Num:      0, // Initialize Num to 0
+		Song:     otherSong.SongName,
+		Singer:   otherSong.Singer,
+		Album:    otherSong.Album,
+		Cover:    otherSong.Cover,
+		MusicURL: otherSong.MusicURL,
+		Lyric:    otherSong.LyricURL,
+		Source:   localSource,
+		ID:       otherSongID(otherSong),
+	}
 }
 
 // API Song handler.
 func apiSongHandlerOnMetadata(msg string) []Song {
-	// Construct a complete file path for metadata.json
-	metadataFilePath := filepath.Join("./music-uploads", "metadata.json")
+	search, err := parseSearchQuery(msg)
+	if err != nil {
+		fmt.Println("Error parsing search query: ", err)
+		return []Song{}
+	}
 
-	// Read the metadata file
-	metadata, err := readMetadataFile(metadataFilePath)
+	// Read the metadata file, cached by the library index until it is modified
+	metadata, err := library.getMetadata()
 	if err != nil {
 		fmt.Println("Error reading metadata file: ", err)
 		return []Song{}
 	}
+	candidates := localCandidates(metadata, search)
 
-	// Get the song array from metadata
-	otherSongs := getSongArray(metadata)
+	// Query every provider of metadata.json concurrently with the words of the query, ties keep the order of the "api" list
+	for _, result := range fanOutSearch(context.Background(), metadata.API, search.Text) {
+		candidates = append(candidates, providerCandidates(search, result, len(candidates))...)
+	}
 
-	// Scan the music-uploads directory for artist-song folders
-	artistSongFolders := scanArtistSongFolders("./music-uploads")
+	// Rank every source together before the songs are numbered
+	return rankSongs(candidates)
+}
 
-	// Initialize a counter for songs
-	songCounter := 0
-	var filteredSongs []Song
+// A song found in the media root, either a quality folder or a single audio file.
+type artistSongFolder struct {
+	artistName    string
+	songName      string
+	albumName     string
+	folder        string     // folder path relative to the media root
+	audioFile     string     // audio file relative to the media root, empty for quality folders
+	tags          *audioTags // embedded tags, nil when the files carry none
+	embeddedCover bool
+}
 
-	// Convert artist-song folders to Song
-	for _, artistSongFolder := range artistSongFolders {
-		song := Song{
-			Num:      0, // Initialize Num to 0
-			Song:     artistSongFolder.songName,
-			Singer:   artistSongFolder.artistName,
-			Album:    artistSongFolder.albumName,
-			Cover:    getCoverURL(artistSongFolder.artistName, artistSongFolder.songName, artistSongFolder.albumName),
-			MusicURL: getMusicURL(artistSongFolder.artistName, artistSongFolder.songName, artistSongFolder.albumName),
-			Lyric:    getLyricURL(artistSongFolder.artistName, artistSongFolder.songName, artistSongFolder.albumName),
+// Helper function to turn the songs of a provider into candidates, order continues from the previous ones
+func providerCandidates(search *searchQuery, result providerResult, order int) []rankedSong {
+	var candidates []rankedSong
+	weight, source := providerWeight(result.API), providerSource(result.API)
+	for _, song := range result.Songs {
+		// Providers do not know the syntax, their songs are checked against the scoped and negated terms here
+		if !search.allows(song) {
+			continue
 		}
-
-		// Check if the song matches the msg
-		if strings.Contains(song.Song, msg) || strings.Contains(song.Singer, msg) || strings.Contains(song.Album, msg) {
-			songCounter++
-			song.Num = songCounter
-			filteredSongs = append(filteredSongs, song)
+		song.Source = source
+		song.ID = upstreamSongID(source, song)
+		upstreamSongs.add(song)
+		score := search.matcher.score(song)
+		if search.termsOnly {
+			score = scoreScopedTerms
+		} else if score == 0 {
+			score = scoreUpstream
 		}
+		candidates = append(candidates, rankedSong{song: song, score: score, weight: weight, order: order + len(candidates)})
 	}
+	return candidates
+}
+
+// Quality file names of a song folder, best first.
+var qualityNames = []string{"hires", "lossless", "superquality", "highquality", "standard", "audition"}
+
+// Helper function to scan the music-uploads directory for artist-song folders and tagged audio files
+func scanArtistSongFolders(dirPath string) []artistSongFolder {
+	var artistSongFolders []artistSongFolder
+	walkLibraryDirs(dirPath, func(relDir string, entries []os.DirEntry) {
+		artistSongFolders = append(artistSongFolders, scanFolder(dirPath, relDir, entries)...)
+	})
+	return artistSongFolders
+}
 
-	// Convert OtherSong to Song
-	for _, otherSong := range otherSongs {
-		song := Song{
-			Num:      0, // Initialize Num to 0
-			Song:     otherSong.SongName,
-			Singer:   otherSong.Singer,
-			Album:    otherSong.Album,
-			Cover:    otherSong.Cover,
-			MusicURL: otherSong.MusicURL,
-			Lyric:    otherSong.LyricURL,
+// Helper function to call fn for every directory of the media root that is not private
+func walkLibraryDirs(dirPath string, fn func(relDir string, entries []os.DirEntry)) {
+	patterns := deniedFiles()
+	err := filepath.WalkDir(dirPath, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			fmt.Println("Error reading directory entries: ", err)
+			return nil
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		relDir, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return nil
+		}
+		if relDir != "." && isDeniedPath(relDir, patterns) {
+			return filepath.SkipDir
 		}
 
-		// Check if the song matches the msg
-		if strings.Contains(song.Song, msg) || strings.Contains(song.Singer, msg) || strings.Contains(song.Album, msg) {
-			songCounter++
-			song.Num = songCounter
-			filteredSongs = append(filteredSongs, song)
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			fmt.Println("Error opening directory: ", err)
+			return nil
 		}
+		fn(relDir, entries)
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error opening directory: ", err)
 	}
+}
 
-	for _, api := range metadata.API {
-		// Handling API requests from the same system
-		if api.APIType == "" {
-			// Same system API request
-			resp, err := http.Get(api.APIURL)
-			if err != nil {
-				fmt.Println("Error fetching data from internal API: ", err)
-				continue // Continue processing the next API, if there are any errors
-			}
-			defer resp.Body.Close()
-
-			// Decode JSON response
-			var internalSongs []Song
-			err = json.NewDecoder(resp.Body).Decode(&internalSongs)
-			if err != nil {
-				fmt.Println("Error decoding internal API response: ", err)
-				continue // Continue processing the next API, if there are any errors
-			}
+// Helper function to find the songs of a single directory of the media root
+func scanFolder(dirPath string, relDir string, entries []os.DirEntry) []artistSongFolder {
+	var artistSongFolders []artistSongFolder
+	patterns := deniedFiles()
+	path := filepath.Join(dirPath, relDir)
+	dirName := filepath.Base(relDir)
+
+	var audioFiles []string
+	qualityFiles := map[string]string{}
+	for _, file := range entries {
+		if file.IsDir() || !isAudioFile(file.Name()) || isDeniedPath(file.Name(), patterns) {
+			continue
+		}
+		audioFiles = append(audioFiles, file.Name())
+		quality := strings.ToLower(strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())))
+		if _, seen := qualityFiles[quality]; !seen {
+			qualityFiles[quality] = file.Name()
+		}
+	}
 
-			// Modify the num field for internal songs
-			for i := range internalSongs {
-				songCounter++
-				internalSongs[i].Num = songCounter
-			}
+	// Split the folder name into artist, song and album name
+	artistName, songName, albumName, named := parseFolderName(dirName)
+	topLevel := filepath.Dir(relDir) == "."
 
-			// Append internal songs to filteredSongs
-			filteredSongs = append(filteredSongs, internalSongs...)
+	isQualityFolder := false
+	for _, quality := range qualityNames {
+		if _, ok := qualityFiles[quality]; ok {
+			isQualityFolder = true
+			break
 		}
+	}
 
-		// Handling API requests from 枫雨API
-		if api.APIType == "api.yuanfeng.cn" {
-			internalSongs := YuafengAPIResponseHandler(api.APIKey, msg, api.Sources)
-			for _, internalSong := range internalSongs {
-				song := Song{
-					Num:      0, // Initialize Num to 0
-					Song:     internalSong.SongName,
-					Singer:   internalSong.Singer,
-					Album:    internalSong.Album,
-					Cover:    internalSong.Cover,
-					MusicURL: internalSong.MusicURL,
-					Lyric:    internalSong.LyricURL,
-				}
-				// Check if the song matches the msg
-				if strings.Contains(song.Song, msg) || strings.Contains(song.Singer, msg) || strings.Contains(song.Album, msg) {
-					songCounter++
-					song.Num = songCounter
-					filteredSongs = append(filteredSongs, song)
-				}
+	// A folder holding quality files, or a legacy top level artist-song folder, is one song
+	if relDir != "." && (isQualityFolder || (topLevel && named && len(audioFiles) == 0)) {
+		folder := artistSongFolder{folder: relDir}
+		if named && topLevel {
+			folder.artistName, folder.songName, folder.albumName = artistName, songName, albumName
+		} else {
+			folder.songName = dirName
+		}
+		for _, quality := range qualityNames {
+			if name, ok := qualityFiles[quality]; ok {
+				applyTags(&folder, filepath.Join(path, name))
+				break
 			}
 		}
+		return append(artistSongFolders, folder)
 	}
 
-	// Return the filtered song array
-	return filteredSongs
+	// Otherwise every audio file is a song of its own
+	for _, name := range audioFiles {
+		folder := artistSongFolder{
+			folder:    relDir,
+			audioFile: filepath.Join(relDir, name),
+			songName:  strings.TrimSuffix(name, filepath.Ext(name)),
+		}
+		if parts := strings.SplitN(folder.songName, " - ", 2); len(parts) == 2 {
+			folder.artistName = strings.TrimSpace(parts[0])
+			folder.songName = strings.TrimSpace(parts[1])
+		}
+		if relDir != "." {
+			folder.albumName = dirName
+		}
+		applyTags(&folder, filepath.Join(path, name))
+		artistSongFolders = append(artistSongFolders, folder)
+	}
+	return artistSongFolders
 }
 
-// Helper function to scan the music-uploads directory for artist-song folders
-func scanArtistSongFolders(dirPath string) []struct {
-	artistName string
-	songName   string
-	albumName  string
-} {
-	var artistSongFolders []struct {
-		artistName string
-		songName   string
-		albumName  string
-	}
+// Helper function to split an "artist-song@album" folder name
+func parseFolderName(name string) (string, string, string, bool) {
+	parts := strings.Split(name, "-")
+	if len(parts) < 2 {
+		return "", "", "", false
+	}
+	artistName := strings.TrimSpace(parts[0])
+	songAndAlbum := strings.Join(parts[1:], "-")
+	songAlbumParts := strings.Split(songAndAlbum, "@")
+	songName := strings.TrimSpace(songAlbumParts[0])
+	var albumName string
+	if len(songAlbumParts) > 1 {
+		albumName = strings.TrimSpace(songAlbumParts[1])
+	}
+	return artistName, songName, albumName, true
+}
 
-	// Open the directory
-	dir, err := os.Open(dirPath)
+// Helper function to read the tags of an audio file, tags win over names derived from the folder
+func applyTags(folder *artistSongFolder, filePath string) {
+	tags, err := readAudioTags(filePath)
 	if err != nil {
-		fmt.Println("Error opening directory: ", err)
-		return artistSongFolders
+		return
+	}
+	if tags.Title != "" {
+		folder.songName = tags.Title
+	}
+	if tags.Artist != "" {
+		folder.artistName = tags.Artist
+	}
+	if tags.Album != "" {
+		folder.albumName = tags.Album
 	}
-	defer dir.Close()
+	folder.embeddedCover = tags.Picture != nil
+	tags.Picture = nil // Served on demand by coverHandler
+	folder.tags = tags
+}
 
-	// Read the contents of the directory
-	entries, err := dir.Readdir(0)
-	if err != nil {
-		fmt.Println("Error reading directory entries: ", err)
-		return artistSongFolders
-	}
-
-	// Iterate over the entries
-	for _, entry := range entries {
-		if entry.IsDir() {
-			// Split the folder name into artist and song name
-			parts := strings.Split(entry.Name(), "-")
-			if len(parts) >= 2 {
-				artistName := strings.TrimSpace(parts[0])
-				songAndAlbum := strings.Join(parts[1:], "-")
-				songAlbumParts := strings.Split(songAndAlbum, "@")
-				songName := strings.TrimSpace(songAlbumParts[0])
-				var albumName string
-				if len(songAlbumParts) > 1 {
-					albumName = strings.TrimSpace(songAlbumParts[1])
+// Helper function to convert a scanned folder or audio file to Song
+func folderToSong(folder artistSongFolder) Song {
+	song := Song{
+		Num:    0, // Initialize Num to 0
+		Song:   folder.songName,
+		Singer: folder.artistName,
+		Album:  folder.albumName,
+		ID:     localSongID(folder.folder),
+	}
+	if folder.audioFile != "" {
+		song.ID = localSongID(folder.audioFile)
+	}
+	if folder.tags != nil {
+		song.Track = folder.tags.Track
+		song.Disc = folder.tags.Disc
+		song.Year = folder.tags.Year
+		song.Genre = folder.tags.Genre
+		song.Duration = folder.tags.Duration
+	}
+
+	if folder.audioFile == "" {
+		song.Cover = getCoverURL(folder.folder)
+		song.MusicURL = getMusicURL(folder.folder)
+		song.Lyric = getLyricURL(folder.folder, "lyric")
+		if song.Cover == "" && folder.embeddedCover {
+			for _, quality := range qualityNames {
+				if coverURL := getEmbeddedCoverURL(folder.folder, quality); coverURL != "" {
+					song.Cover = coverURL
+					break
 				}
-				artistSongFolders = append(artistSongFolders, struct {
-					artistName string
-					songName   string
-					albumName  string
-				}{artistName, songName, albumName})
 			}
 		}
+		return song
 	}
 
-	return artistSongFolders
+	song.Cover = getCoverURL(folder.folder)
+	if song.Cover == "" && folder.embeddedCover {
+		song.Cover = os.Getenv("HOME_URL") + mediaURLPath("/cover/", folder.audioFile)
+	}
+	musicURL := MusicURL{}
+	switch strings.ToLower(filepath.Ext(folder.audioFile)) {
+	case ".flac", ".wav":
+		musicURL.Lossless = getFileURL(folder.audioFile)
+	default:
+		musicURL.Standard = getFileURL(folder.audioFile)
+	}
+	song.MusicURL = musicURL
+	baseName := strings.TrimSuffix(filepath.Base(folder.audioFile), filepath.Ext(folder.audioFile))
+	song.Lyric = getLyricURL(folder.folder, baseName)
+	return song
 }
 
-// Helper function to get the cover URL
-func getCoverURL(artistName, songName, albumName string) string {
-	homeURL := os.Getenv("HOME_URL")
-	PORT := os.Getenv("PORT")
-	coverPath := fmt.Sprintf("/file/%s-%s@%s/cover.png", url.PathEscape(artistName), url.PathEscape(songName), url.PathEscape(albumName))
-	fullCoverURL := fmt.Sprintf("%s%s", homeURL, coverPath)
-	testCoverURL := fmt.Sprintf("%s:%s%s", "http://127.0.0.1", PORT, coverPath)
-	if checkURL(testCoverURL) == "" {
+// Helper function to build the URL path of a file relative to the media root
+func mediaURLPath(prefix string, relPath string) string {
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return prefix + strings.Join(segments, "/")
+}
+
+// Helper function to get the URL of a media file, empty if it cannot be served
+func getFileURL(relPath string) string {
+	fullFilePath, err := resolveMediaPath(mediaRoot(), relPath)
+	if err != nil {
 		return ""
 	}
-	return fullCoverURL
+	if fileInfo, err := os.Stat(fullFilePath); err != nil || fileInfo.IsDir() {
+		return ""
+	}
+	return os.Getenv("HOME_URL") + mediaURLPath("/file/", relPath)
+}
+
+// Helper function to get the cover URL
+func getCoverURL(folder string) string {
+	for _, name := range []string{"cover.png", "cover.jpg"} {
+		if coverURL := getFileURL(filepath.Join(folder, name)); coverURL != "" {
+			return coverURL
+		}
+	}
+	return ""
+}
+
+// Helper function to get the URL of the picture embedded in a quality file
+func getEmbeddedCoverURL(folder string, quality string) string {
+	for _, format := range []string{".flac", ".mp3", ".m4a", ".ogg"} {
+		relPath := filepath.Join(folder, quality+format)
+		if getFileURL(relPath) != "" {
+			return os.Getenv("HOME_URL") + mediaURLPath("/cover/", relPath)
+		}
+	}
+	return ""
 }
 
 // Helper function to get the MusicURL
-func getMusicURL(artistName, songName, albumName string) MusicURL {
+func getMusicURL(folder string) MusicURL {
 	musicURL := MusicURL{
-		Audition:     getMusicFileURL(artistName, songName, albumName, "audition", ".mp3"),
-		Standard:     getMusicFileURL(artistName, songName, albumName, "standard", ".mp3"),
-		Highquality:  getMusicFileURL(artistName, songName, albumName, "highquality", ".mp3"),
-		Superquality: getMusicFileURL(artistName, songName, albumName, "superquality", ".mp3"),
-		Lossless:     getMusicFileURL(artistName, songName, albumName, "lossless", ".flac"),
-		Hires:        getMusicFileURL(artistName, songName, albumName, "hires", ".flac"),
+		Audition:     getFileURL(filepath.Join(folder, "audition.mp3")),
+		Standard:     getFileURL(filepath.Join(folder, "standard.mp3")),
+		Highquality:  getFileURL(filepath.Join(folder, "highquality.mp3")),
+		Superquality: getFileURL(filepath.Join(folder, "superquality.mp3")),
+		Lossless:     getFileURL(filepath.Join(folder, "lossless.flac")),
+		Hires:        getFileURL(filepath.Join(folder, "hires.flac")),
 	}
 	return musicURL
 }
 
 // Helper function to get the Lyric URL
-func getLyricURL(artistName, songName, albumName string) Lyric {
-	homeURL := os.Getenv("HOME_URL")
-	PORT := os.Getenv("PORT")
-	mrcPath := fmt.Sprintf("/file/%s-%s@%s/lyric.mrc", url.PathEscape(artistName), url.PathEscape(songName), url.PathEscape(albumName))
-	lrcPath := fmt.Sprintf("/file/%s-%s@%s/lyric.lrc", url.PathEscape(artistName), url.PathEscape(songName), url.PathEscape(albumName))
-	txtPath := fmt.Sprintf("/file/%s-%s@%s/lyric.txt", url.PathEscape(artistName), url.PathEscape(songName), url.PathEscape(albumName))
-	mrcURL := fmt.Sprintf("%s%s", homeURL, mrcPath)
-	lrcURL := fmt.Sprintf("%s%s", homeURL, lrcPath)
-	txtURL := fmt.Sprintf("%s%s", homeURL, txtPath)
-	testMrcURL := fmt.Sprintf("%s:%s%s", "http://127.0.0.1", PORT, mrcPath)
-	testLrcURL := fmt.Sprintf("%s:%s%s", "http://127.0.0.1", PORT, lrcPath)
-	testTxtURL := fmt.Sprintf("%s:%s%s", "http://127.0.0.1", PORT, txtPath)
-	mrcAvailable := checkURL(testMrcURL) != ""
-	lrcAvailable := checkURL(testLrcURL) != ""
-	txtAvailable := checkURL(testTxtURL) != ""
+func getLyricURL(folder string, baseName string) Lyric {
 	return Lyric{
-		Mrc: conditionalURL(mrcAvailable, mrcURL),
-		Lrc: conditionalURL(lrcAvailable, lrcURL),
-		Txt: conditionalURL(txtAvailable, txtURL),
+		Mrc: getFileURL(filepath.Join(folder, baseName+".mrc")),
+		Lrc: getFileURL(filepath.Join(folder, baseName+".lrc")),
+		Txt: getFileURL(filepath.Join(folder, baseName+".txt")),
 	}
 }
 
-// Helper function to get the music file URL based on quality and format
-func getMusicFileURL(artistName, songName, albumName, quality, format string) string {
-	homeURL := os.Getenv("HOME_URL")
-	PORT := os.Getenv("PORT")
-	musicPath := fmt.Sprintf("/file/%s-%s@%s/%s%s", url.PathEscape(artistName), url.PathEscape(songName), url.PathEscape(albumName), url.PathEscape(quality), url.PathEscape(format))
-	fullMusicURL := fmt.Sprintf("%s%s", homeURL, musicPath)
-	testMusicURL := fmt.Sprintf("%s:%s%s", "http://127.0.0.1", PORT, musicPath)
-	if checkURL(testMusicURL) == "" {
-		return ""
+// Helper function to turn decoded JSON objects back into MusicURL and Lyric values
+func typedSongFields(song *Song) {
+	if fields, ok := song.MusicURL.(map[string]interface{}); ok {
+		var musicURL MusicURL
+		if data, err := json.Marshal(fields); err == nil && json.Unmarshal(data, &musicURL) == nil {
+			song.MusicURL = musicURL
+		}
 	}
-	return fullMusicURL
-}
-
-// Helper function to return URL if available, otherwise return empty string
-func conditionalURL(isAvailable bool, url string) string {
-	if isAvailable {
-		return url
+	if fields, ok := song.Lyric.(map[string]interface{}); ok {
+		var lyric Lyric
+		if data, err := json.Marshal(fields); err == nil && json.Unmarshal(data, &lyric) == nil {
+			song.Lyric = lyric
+		}
 	}
-	return ""
 }
 
 // Read the metadata.json file and parse it into a metadata structure
@@ -608,231 +617,6 @@ func getSongArray(metadata *Metadata) []OtherSong {
 	return metadata.Other
 }
 
-type YuafengAPIFreeResponse struct {
-	Code int `json:"code"`
-	Data []struct {
-		Num       int    `json:"num"`
-		Song      string `json:"song"`
-		Singer    string `json:"singer"`
-		Cover     string `json:"cover"`
-		AlbumName string `json:"album_name"`
-	} `json:"data"`
-}
-
-type YuafengAPIFreeSingleResponse struct {
-	Code int `json:"code"`
-	Data struct {
-		Song      string `json:"song"`
-		Singer    string `json:"singer"`
-		Cover     string `json:"cover"`
-		AlbumName string `json:"album_name"`
-		Music     string `json:"music"`
-		Lyric     string `json:"lyric"`
-	} `json:"data"`
-}
-
-type YuafengAPIQSResponse struct {
-	Code int `json:"code"`
-	Data []struct {
-		Song     string `json:"song"`
-		Singer   string `json:"singer"`
-		Cover    string `json:"cover"`
-		Audition string `json:"music_low"`
-		Standard string `json:"music_high"`
-		Lyric    string `json:"lyric"`
-	} `json:"data"`
-}
-
-// 枫雨API response handler.
-func YuafengAPIResponseHandler(key string, msg string, sources string) []OtherSong {
-	var songs []OtherSong
-	if key == "" {
-		var url string
-		switch sources {
-		case "kuwo":
-			url = "https://api.yuafeng.cn/API/ly/kwmusic.php"
-		case "netease":
-			url = "https://api.yuafeng.cn/API/ly/wymusic.php"
-		case "migu":
-			url = "https://api.yuafeng.cn/API/ly/mgmusic.php"
-		case "baidu":
-			url = "https://api.yuafeng.cn/API/ly/bdmusic.php"
-		default:
-			return []OtherSong{}
-		}
-		resp, err := http.Get(url + "?msg=" + msg)
-		if err != nil {
-			fmt.Println("Error fetching the data form Yuafeng free API:", err)
-		}
-		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Println("Error reading the response body from Yuafeng free API:", err)
-		}
-		var response YuafengAPIFreeResponse
-		err = json.Unmarshal(body, &response)
-		if err != nil {
-			fmt.Println("Error unmarshalling the data from Yuafeng free API:", err)
-		}
-		maxNum := 0
-		for _, item := range response.Data {
-			if item.Num > maxNum {
-				maxNum = item.Num
-			}
-		}
-		for i := 1; i <= maxNum; i++ {
-			var musicURL = MusicURL{}
-			// Loop through different formats
-			for _, format := range []string{"LQ", "PQ", "HQ", "SQ"} {
-				singleUrl := url + "?msg=" + msg + "&n=" + strconv.Itoa(i) + "&format=" + format
-				resp, err := http.Get(singleUrl)
-				if err != nil {
-					fmt.Println("Error fetching the data form Yuafeng free API:", err)
-					continue
-				}
-				defer resp.Body.Close()
-				body, err := ioutil.ReadAll(resp.Body)
-				if err != nil {
-					fmt.Println("Error reading the response body from Yuafeng free API:", err)
-					continue
-				}
-				var singleResponse YuafengAPIFreeSingleResponse
-				err = json.Unmarshal(body, &singleResponse)
-				if err != nil {
-					fmt.Println("Error unmarshalling the data form Yuafeng free API:", err)
-					continue
-				}
-				switch format {
-				case "LQ":
-					musicURL.Audition = singleResponse.Data.Music
-				case "PQ":
-					musicURL.Standard = singleResponse.Data.Music
-				case "HQ":
-					musicURL.Highquality = singleResponse.Data.Music
-				case "SQ":
-					musicURL.Superquality = singleResponse.Data.Music
-				}
-				// Check if the song data is valid before appending to songs
-				if response.Data[i-1].Song != "" && response.Data[i-1].Singer != "" && response.Data[i-1].AlbumName != "" && response.Data[i-1].Cover != "" && (musicURL.Audition != "" || musicURL.Standard != "" || musicURL.Highquality != "" || musicURL.Superquality != "") {
-					song := OtherSong{
-						SongName: response.Data[i-1].Song,
-						Singer:   response.Data[i-1].Singer,
-						Album:    response.Data[i-1].AlbumName,
-						Cover:    response.Data[i-1].Cover,
-						MusicURL: musicURL,
-					}
-					songs = append(songs, song)
-				}
-			}
-		}
-	} //else {
-	//url := "https://api-v2.yuafeng.cn/API/"
-	//if sources == "qsmusic" {
-	//resp, err := http.Get(url + "?key=" + key + "&msg=" + msg)
-	//} else {
-	// No other resource support has been provided temporarily.
-	//return []OtherSong{}
-	//}
-	return songs
-}
-
-// Helper function to check if a URL is valid
-func checkURL(url string) string {
-	resp, err := http.Get(url)
-	if err != nil {
-		return ""
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return ""
-	}
-
-	return url
-}
-
-// Helper function to check if cache file is valid
-func isCacheValid(filePath string) bool {
-	// Check if file exists
-	_, err := os.Stat(filePath)
-	if os.IsNotExist(err) {
-		fmt.Println("Cache file does not exist:", filePath)
-		return false
-	}
-
-	// Read the cache file metadata
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		fmt.Println("Error reading cache file metadata: ", err)
-		return false
-	}
-
-	// Get the cache time from environment variable
-	var cacheTime int
-	if cacheTimeEnv := os.Getenv("API_CACHE_TIME"); cacheTimeEnv != "" {
-		cacheTime, err = strconv.Atoi(cacheTimeEnv)
-		if err != nil {
-			fmt.Println("Error converting API_CACHE_TIME to int: ", err)
-			return false
-		}
-	} else {
-		// Default cache time if not set
-		cacheTime = 1 // 1 hour
-	}
-
-	// Compare file modification time with current time
-	return time.Since(fileInfo.ModTime()).Hours() < float64(cacheTime)
-}
-
-// Helper function to delete expired cache files
-func deleteExpiredCacheFiles(cacheDir string, cacheTime int) {
-	files, err := ioutil.ReadDir(cacheDir)
-	if err != nil {
-		fmt.Println("Error reading cache directory: ", err)
-		return
-	}
-
-	for _, file := range files {
-		filePath := filepath.Join(cacheDir, file.Name())
-		if file.IsDir() || file.Name() == "embedded.json" {
-			continue
-		}
-
-		// Read the cache file
-		fileContent, err := ioutil.ReadFile(filePath)
-		if err != nil {
-			fmt.Println("Error reading cache file: ", filePath, err)
-			continue
-		}
-
-		var cacheData struct {
-			Songs     []Song `json:"songs"`
-			Timestamp string `json:"timestamp"`
-		}
-		if err := json.Unmarshal(fileContent, &cacheData); err != nil {
-			fmt.Println("Error decoding cache file: ", filePath, err)
-			continue
-		}
-
-		// Check if the cache is expired
-		cacheAt, err := time.Parse(time.RFC3339, cacheData.Timestamp)
-		if err != nil {
-			fmt.Println("Error parsing cache time: ", filePath, err)
-			continue
-		}
-
-		cacheDuration := time.Since(cacheAt)
-		if cacheDuration > time.Duration(cacheTime)*time.Hour {
-			// Delete the expired cache file
-			if err := os.Remove(filePath); err != nil {
-				fmt.Println("Error deleting expired cache file: ", filePath, err)
-			} else {
-				fmt.Println("Deleted expired cache file: ", filePath)
-			}
-		}
-	}
-}
-
 // Helper function to read from cache file
 func readCacheFile(filePath string) ([]Song, string) {
 	var cacheFile struct {
@@ -878,19 +662,28 @@ func writeCacheFile(filePath string, songs []Song, timestamp string) {
 		}
 	}
 
-	// Create or update the cache file
-	file, err := os.Create(filePath)
+	// Write a temporary file and rename it, so readers never see a truncated cache file
+	file, err := os.CreateTemp(cacheDir, cacheTempPattern)
 	if err != nil {
 		fmt.Println("Error creating cache file: ", err)
 		return
 	}
-	defer file.Close()
+	defer os.Remove(file.Name())
 
 	// Encode JSON response
 	err = json.NewEncoder(file).Encode(cacheFile)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		fmt.Println("Error encoding cache file: ", err)
+		return
+	}
+	if err := os.Rename(file.Name(), filePath); err != nil {
+		fmt.Println("Error replacing cache file: ", err)
+		return
 	}
+	cachedSongs.add(filePath, songs)
 }
 
 // Processing requests.
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// Group of the names that do not start with a letter, listed after Z.
+const otherInitial = "#"
+
+// A singer of the local songs.
+type catalogArtist struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Initial    string `json:"initial"` // A to Z, from the pinyin of Chinese names, or "#"
+	SongCount  int    `json:"song_count"`
+	AlbumCount int    `json:"album_count"`
+	songs      []Song
+}
+
+// An album of the local songs, identified by its title and singer.
+type catalogAlbum struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Initial   string `json:"initial"` // A to Z, from the pinyin of Chinese titles, or "#"
+	Artist    string `json:"artist"`
+	ArtistID  string `json:"artist_id"`
+	SongCount int    `json:"song_count"`
+	Cover     string `json:"cover"`
+	songs     []Song
+}
+
+// The names of one initial in a sorted list, Offset is the position of the first of them.
+type catalogInitial struct {
+	Initial string `json:"initial"`
+	Count   int    `json:"count"`
+	Offset  int    `json:"offset"`
+}
+
+// Artists and albums of the library and of the "other" list of metadata.json.
+type catalog struct {
+	artists []*catalogArtist
+	albums  []*catalogAlbum
+}
+
+// artistID function: Return the stable ID of a singer, equal for spellings that search the same
+func artistID(name string) string {
+	return songID("artist", normaliseText(name))
+}
+
+// albumID function: Return the stable ID of an album of a singer
+func albumID(artist string, title string) string {
+	return songID("album", normaliseText(artist)+"\x00"+normaliseText(title))
+}
+
+// sortName function: Return the key a name is sorted by, its pinyin when it is Chinese so it sorts among the Latin names
+func sortName(name string) string {
+	if forms := pinyinOf(name); forms.Full != "" {
+		return forms.Full
+	}
+	return normaliseText(name)
+}
+
+// nameInitial function: Return the A to Z group of a name, otherInitial when it does not start with a letter
+func nameInitial(name string) string {
+	key := sortName(name)
+	if key == "" || key[0] < 'a' || key[0] > 'z' {
+		return otherInitial
+	}
+	return strings.ToUpper(key[:1])
+}
+
+// Helper function to compare two names in A to Z order, otherInitial last
+func lessName(a string, b string) bool {
+	initialA, initialB := nameInitial(a), nameInitial(b)
+	if initialA != initialB {
+		return initialB == otherInitial || (initialA != otherInitial && initialA < initialB)
+	}
+	if sortName(a) != sortName(b) {
+		return sortName(a) < sortName(b)
+	}
+	return foldText(a) < foldText(b)
+}
+
+// Helper function to order songs by disc and track, songs without a track number last by title
+func sortTracks(songs []Song) {
+	sort.SliceStable(songs, func(i, j int) bool {
+		a, b := songs[i], songs[j]
+		if (a.Track == 0) != (b.Track == 0) {
+			return a.Track != 0
+		}
+		if max(a.Disc, 1) != max(b.Disc, 1) {
+			return max(a.Disc, 1) < max(b.Disc, 1)
+		}
+		if a.Track != b.Track {
+			return a.Track < b.Track
+		}
+		return lessName(a.Song, b.Song)
+	})
+}
+
+// Helper function to order songs by title, then by singer
+func sortSongs(songs []Song) {
+	sort.SliceStable(songs, func(i, j int) bool {
+		a, b := songs[i], songs[j]
+		if lessName(a.Song, b.Song) || lessName(b.Song, a.Song) {
+			return lessName(a.Song, b.Song)
+		}
+		return lessName(a.Singer, b.Singer)
+	})
+}
+
+// localSongs function: Return the songs of the library and of the "other" list of metadata.json
+func localSongs() []Song {
+	var songs []Song
+	for _, entry := range library.entries() {
+		entry.song.Source = localSource
+		songs = append(songs, entry.song)
+	}
+	if metadata, err := library.getMetadata(); err == nil {
+		for _, otherSong := range getSongArray(metadata) {
+			songs = append(songs, otherToSong(otherSong))
+		}
+	}
+	return songs
+}
+
+// buildCatalog function: Group the local songs by singer and by album
+func buildCatalog() *catalog {
+	artists := map[string]*catalogArtist{}
+	albums := map[string]*catalogAlbum{}
+	for _, song := range localSongs() {
+		if song.Singer == "" {
+			continue
+		}
+		artist, ok := artists[artistID(song.Singer)]
+		if !ok {
+			artist = &catalogArtist{ID: artistID(song.Singer), Name: song.Singer, Initial: nameInitial(song.Singer)}
+			artists[artist.ID] = artist
+		}
+		artist.songs = append(artist.songs, song)
+		artist.SongCount++
+		if song.Album == "" {
+			continue
+		}
+		album, ok := albums[albumID(song.Singer, song.Album)]
+		if !ok {
+			album = &catalogAlbum{ID: albumID(song.Singer, song.Album), Title: song.Album, Initial: nameInitial(song.Album), Artist: artist.Name, ArtistID: artist.ID}
+			albums[album.ID] = album
+			artist.AlbumCount++
+		}
+		album.songs = append(album.songs, song)
+		album.SongCount++
+		if album.Cover == "" {
+			album.Cover = song.Cover
+		}
+	}
+
+	result := &catalog{}
+	for _, artist := range artists {
+		result.artists = append(result.artists, artist)
+	}
+	for _, album := range albums {
+		sortTracks(album.songs)
+		result.albums = append(result.albums, album)
+	}
+	sort.Slice(result.artists, func(i, j int) bool {
+		return lessName(result.artists[i].Name, result.artists[j].Name)
+	})
+	sort.Slice(result.albums, func(i, j int) bool {
+		a, b := result.albums[i], result.albums[j]
+		if lessName(a.Title, b.Title) || lessName(b.Title, a.Title) {
+			return lessName(a.Title, b.Title)
+		}
+		return lessName(a.Artist, b.Artist)
+	})
+	for _, artist := range result.artists {
+		// Songs of an artist follow their albums, the songs without one come last
+		songs := []Song{}
+		for _, album := range result.albumsOf(artist.ID) {
+			songs = append(songs, album.songs...)
+		}
+		loose := artist.songs[:0]
+		for _, song := range artist.songs {
+			if song.Album == "" {
+				loose = append(loose, song)
+			}
+		}
+		sortTracks(loose)
+		artist.songs = append(songs, loose...)
+	}
+	return result
+}
+
+// initials function: Group sorted names by their initial for A to Z navigation
+func initials(names []string) []catalogInitial {
+	groups := []catalogInitial{}
+	for i, name := range names {
+		initial := nameInitial(name)
+		if len(groups) == 0 || groups[len(groups)-1].Initial != initial {
+			groups = append(groups, catalogInitial{Initial: initial, Offset: i})
+		}
+		groups[len(groups)-1].Count++
+	}
+	return groups
+}
+
+// artist function: Return the artist of an ID
+func (catalog *catalog) artist(id string) (*catalogArtist, bool) {
+	for _, artist := range catalog.artists {
+		if artist.ID == id {
+			return artist, true
+		}
+	}
+	return nil, false
+}
+
+// album function: Return the album of an ID
+func (catalog *catalog) album(id string) (*catalogAlbum, bool) {
+	for _, album := range catalog.albums {
+		if album.ID == id {
+			return album, true
+		}
+	}
+	return nil, false
+}
+
+// albumsOf function: Return the albums of an artist
+func (catalog *catalog) albumsOf(artistID string) []*catalogAlbum {
+	albums := []*catalogAlbum{}
+	for _, album := range catalog.albums {
+		if album.ArtistID == artistID {
+			albums = append(albums, album)
+		}
+	}
+	return albums
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestNameInitial Test the A to Z groups and order of Latin, Chinese and other names
+func TestNameInitial(t *testing.T) {
+	initials := map[string]string{"Alice": "A", "alice": "A", "周杰伦": "Z", "阿杜": "A", "１２３": "#", "1997": "#", "《》": "#", "": "#"}
+	for name, want := range initials {
+		if initial := nameInitial(name); initial != want {
+			t.Errorf("nameInitial(%q) = %q, want %q", name, initial, want)
+		}
+	}
+
+	names := []string{"1997", "周杰伦", "Zoe", "Bob", "alice", "阿杜"}
+	sort.Slice(names, func(i, j int) bool { return lessName(names[i], names[j]) })
+	if want := []string{"阿杜", "alice", "Bob", "周杰伦", "Zoe", "1997"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Sorted names %v, want %v", names, want)
+	}
+}
+
+// TestAPIV2Browse Test the artists, albums and tracks of /api/v2 in A to Z and track order
+func TestAPIV2Browse(t *testing.T) {
+	setupAPITest(t, 0)
+	root := os.Getenv("MEDIA_ROOT")
+	track := func(number string, disc string) []byte {
+		frames := [][]byte{id3v2Frame(3, "TRCK", append([]byte{0}, number...))}
+		if disc != "" {
+			frames = append(frames, id3v2Frame(3, "TPOS", append([]byte{0}, disc...)))
+		}
+		return id3v2Tag(3, frames...)
+	}
+	writeTestFile(t, root, "Alice-Three@Spring/standard.mp3", track("3/10", ""))
+	writeTestFile(t, root, "Alice-One@Spring/standard.mp3", track("1", "2/2"))
+	writeTestFile(t, root, "Alice-Two@Spring/standard.mp3", track("2", "1"))
+	writeTestFile(t, root, "Alice-Bonus@Spring/standard.mp3", []byte("audio"))
+	metadata, _ := json.Marshal(Metadata{API: []API{}, Other: []OtherSong{
+		{SongName: "晴天", Singer: "周杰伦", Album: "叶惠美"},
+		{SongName: "Loose", Singer: "Alice"},
+		{SongName: "Sun", Singer: "1997 Band", Album: "Summer"},
+	}})
+	writeTestFile(t, root, "metadata.json", metadata)
+
+	names := func(body map[string]interface{}, field string) []string {
+		var values []string
+		for _, item := range body["data"].([]interface{}) {
+			values = append(values, item.(map[string]interface{})[field].(string))
+		}
+		return values
+	}
+	_, body := apiV2TestRequest(t, "GET", "/api/v2/artists")
+	if got, want := names(body, "name"), []string{"Alice", "周杰伦", "1997 Band"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Artists %v, want %v", got, want)
+	}
+	alice := body["data"].([]interface{})[0].(map[string]interface{})
+	if alice["initial"] != "A" || alice["song_count"] != 5.0 || alice["album_count"] != 1.0 {
+		t.Errorf("Unexpected artist: %v", alice)
+	}
+	if _, body := apiV2TestRequest(t, "GET", "/api/v2/artists?initial=z"); !reflect.DeepEqual(names(body, "name"), []string{"周杰伦"}) || body["total"] != 1.0 {
+		t.Errorf("Unexpected artists of Z: %v", body)
+	}
+	if _, body := apiV2TestRequest(t, "GET", "/api/v2/artists?initial=%23"); !reflect.DeepEqual(names(body, "name"), []string{"1997 Band"}) {
+		t.Errorf("Unexpected artists of #: %v", body)
+	}
+	_, body = apiV2TestRequest(t, "GET", "/api/v2/artists/initials")
+	if got := toJSON(body["data"]); got != `[{"count":1,"initial":"A","offset":0},{"count":1,"initial":"Z","offset":1},{"count":1,"initial":"#","offset":2}]` {
+		t.Errorf("Unexpected artist initials: %s", got)
+	}
+
+	_, body = apiV2TestRequest(t, "GET", "/api/v2/albums")
+	if got, want := names(body, "title"), []string{"Spring", "Summer", "叶惠美"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Albums %v, want %v", got, want)
+	}
+	_, body = apiV2TestRequest(t, "GET", "/api/v2/albums/initials")
+	if got := toJSON(body["data"]); got != `[{"count":2,"initial":"S","offset":0},{"count":1,"initial":"Y","offset":2}]` {
+		t.Errorf("Unexpected album initials: %s", got)
+	}
+
+	// Tracks are ordered by disc and track number, untagged songs last
+	spring := albumID("Alice", "Spring")
+	_, body = apiV2TestRequest(t, "GET", "/api/v2/albums/"+spring+"/songs")
+	if got, want := names(body, "title"), []string{"Two", "Three", "One", "Bonus"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Album songs %v, want %v", got, want)
+	}
+	if _, body := apiV2TestRequest(t, "GET", "/api/v2/albums/"+spring+"/songs?page=2&page_size=3"); !reflect.DeepEqual(names(body, "title"), []string{"Bonus"}) || body["total"] != 4.0 {
+		t.Errorf("Unexpected second page: %v", body)
+	}
+	_, body = apiV2TestRequest(t, "GET", "/api/v2/albums/"+spring)
+	if songs := body["data"].(map[string]interface{})["songs"].([]interface{}); songs[0].(map[string]interface{})["track"] != 2.0 {
+		t.Errorf("Album detail should list songs in track order: %v", songs)
+	}
+	_, body = apiV2TestRequest(t, "GET", "/api/v2/artists/"+artistID("Alice")+"/songs")
+	if got, want := names(body, "title"), []string{"Two", "Three", "One", "Bonus", "Loose"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Artist songs %v, want %v", got, want)
+	}
+	_, body = apiV2TestRequest(t, "GET", "/api/v2/artists/"+artistID("Alice")+"/albums")
+	if got := names(body, "id"); !reflect.DeepEqual(got, []string{spring}) {
+		t.Errorf("Artist albums %v, want %v", got, spring)
+	}
+
+	statuses := map[string]int{
+		"/api/v2/artists?initial=ab":                             http.StatusBadRequest,
+		"/api/v2/albums?initial=1":                               http.StatusBadRequest,
+		"/api/v2/artists/" + artistID("Alice") + "/nothing":      http.StatusNotFound,
+		"/api/v2/albums/" + spring + "/albums":                   http.StatusNotFound,
+		"/api/v2/artists/0123456789abcdef/songs":                 http.StatusNotFound,
+		"/api/v2/artists/" + artistID("Alice") + "/songs/extra":  http.StatusNotFound,
+		"/api/v2/artists/" + artistID("Alice") + "/songs?page=0": http.StatusBadRequest,
+	}
+	for target, status := range statuses {
+		if rr, body := apiV2TestRequest(t, "GET", target); rr.Code != status || body["error"] == nil {
+			t.Errorf("%s: got %d %v, want %d", target, rr.Code, body, status)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"container/list"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Songs of one cache file held in memory.
+type cacheEntry struct {
+	path      string
+	songs     []Song
+	timestamp string
+	loadedAt  time.Time
+}
+
+// Counters of the API cache.
+type cacheStats struct {
+	MemoryHits int64 `json:"memory_hits"`
+	DiskHits   int64 `json:"disk_hits"`
+	Misses     int64 `json:"misses"`
+	Evictions  int64 `json:"evictions"`
+	Entries    int   `json:"entries"`
+}
+
+// Two-tier API cache, a size-bounded LRU in memory in front of the JSON files of the cache directory.
+type songCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Most recently used first
+	stats   cacheStats
+}
+
+// The API cache used by apiHandler.
+var apiCache = newSongCache()
+
+// newSongCache function: Create an empty cache
+func newSongCache() *songCache {
+	return &songCache{entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// apiCacheTime function: Return how long a cached query stays valid, set by API_CACHE_TIME in hours
+func apiCacheTime() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("API_CACHE_TIME"))
+	if err != nil || hours < 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// cacheMemoryEntries function: Return the number of queries kept in memory, set by API_CACHE_MEMORY_ENTRIES
+func cacheMemoryEntries() int {
+	entries, err := strconv.Atoi(os.Getenv("API_CACHE_MEMORY_ENTRIES"))
+	if err != nil || entries < 0 {
+		return 512
+	}
+	return entries
+}
+
+// cacheMemoryTTL function: Return how long a query stays in memory before it is read from disk again, set by API_CACHE_MEMORY_TTL in seconds
+func cacheMemoryTTL() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("API_CACHE_MEMORY_TTL"))
+	if err != nil || seconds < 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// cacheExpired function: The one expiry rule of both tiers, a cache expires API_CACHE_TIME after its timestamp
+func cacheExpired(timestamp string, now time.Time) bool {
+	cachedAt, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return true
+	}
+	return now.Sub(cachedAt) >= apiCacheTime()
+}
+
+// get function: Return the valid cached songs of a cache file, from memory or else from disk
+func (cache *songCache) get(path string) ([]Song, string, bool) {
+	now := time.Now()
+	cache.mu.Lock()
+	if element, ok := cache.entries[path]; ok {
+		entry := element.Value.(*cacheEntry)
+		if !cacheExpired(entry.timestamp, now) && now.Sub(entry.loadedAt) < cacheMemoryTTL() {
+			cache.order.MoveToFront(element)
+			cache.stats.MemoryHits++
+			cache.mu.Unlock()
+			// Callers may append to the songs, the cached slice is never handed out
+			return append([]Song(nil), entry.songs...), entry.timestamp, true
+		}
+		cache.removeElement(element)
+	}
+	cache.mu.Unlock()
+
+	if _, err := os.Stat(path); err != nil {
+		cache.count(&cache.stats.Misses)
+		return nil, "", false
+	}
+	songs, timestamp := readCacheFile(path)
+	if cacheExpired(timestamp, now) {
+		cache.count(&cache.stats.Misses)
+		return nil, "", false
+	}
+	cache.remember(path, append([]Song(nil), songs...), timestamp)
+	cache.count(&cache.stats.DiskHits)
+	return songs, timestamp, true
+}
+
+// put function: Write songs to the cache file and keep them in memory
+func (cache *songCache) put(path string, songs []Song, timestamp string) {
+	writeCacheFile(path, songs, timestamp)
+	cache.remember(path, append([]Song(nil), songs...), timestamp)
+}
+
+// remove function: Drop a cache file from memory, the caller removes the file itself
+func (cache *songCache) remove(path string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if element, ok := cache.entries[path]; ok {
+		cache.removeElement(element)
+	}
+}
+
+// purge function: Drop every cache file from memory
+func (cache *songCache) purge() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries = map[string]*list.Element{}
+	cache.order.Init()
+}
+
+// snapshot function: Return the counters of the cache
+func (cache *songCache) snapshot() cacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	stats := cache.stats
+	stats.Entries = cache.order.Len()
+	return stats
+}
+
+// Helper function to keep songs in memory, evicting the least recently used queries over the limit
+func (cache *songCache) remember(path string, songs []Song, timestamp string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	entry := &cacheEntry{path: path, songs: songs, timestamp: timestamp, loadedAt: time.Now()}
+	if element, ok := cache.entries[path]; ok {
+		element.Value = entry
+		cache.order.MoveToFront(element)
+	} else {
+		cache.entries[path] = cache.order.PushFront(entry)
+	}
+	for limit := cacheMemoryEntries(); cache.order.Len() > limit; {
+		cache.removeElement(cache.order.Back())
+		cache.stats.Evictions++
+	}
+}
+
+// Helper function to unlink an element, the caller holds mu
+func (cache *songCache) removeElement(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*cacheEntry).path)
+}
+
+// Helper function to increment a counter
+func (cache *songCache) count(counter *int64) {
+	cache.mu.Lock()
+	*counter++
+	cache.mu.Unlock()
+}
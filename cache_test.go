@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSongCacheTiers Test that queries are answered from memory, then from disk, with hit and miss counters
+func TestSongCacheTiers(t *testing.T) {
+	cacheDir := t.TempDir()
+	cache := newSongCache()
+	path := filepath.Join(cacheDir, "query.json")
+	now := time.Now().Format(time.RFC3339)
+
+	if _, _, ok := cache.get(path); ok {
+		t.Errorf("A missing cache file should be a miss")
+	}
+	writeCacheFile(path, []Song{{Song: "晴天"}}, now)
+	if songs, timestamp, ok := cache.get(path); !ok || len(songs) != 1 || timestamp != now {
+		t.Errorf("Unexpected disk hit: %+v %q %v", songs, timestamp, ok)
+	}
+
+	// The second read is served from memory even when the file is gone
+	os.Remove(path)
+	if songs, _, ok := cache.get(path); !ok || len(songs) != 1 {
+		t.Errorf("Expected a memory hit, got %+v %v", songs, ok)
+	}
+	cache.remove(path)
+	if _, _, ok := cache.get(path); ok {
+		t.Errorf("A removed cache file should be a miss")
+	}
+
+	stats := cache.snapshot()
+	if stats.MemoryHits != 1 || stats.DiskHits != 1 || stats.Misses != 2 || stats.Entries != 0 {
+		t.Errorf("Unexpected cache stats: %+v", stats)
+	}
+}
+
+// TestSongCacheEviction Test that the least recently used query is evicted over API_CACHE_MEMORY_ENTRIES
+func TestSongCacheEviction(t *testing.T) {
+	t.Setenv("API_CACHE_MEMORY_ENTRIES", "2")
+	cacheDir := t.TempDir()
+	cache := newSongCache()
+	now := time.Now().Format(time.RFC3339)
+	paths := []string{filepath.Join(cacheDir, "a.json"), filepath.Join(cacheDir, "b.json"), filepath.Join(cacheDir, "c.json")}
+
+	cache.put(paths[0], []Song{{Song: "a"}}, now)
+	cache.put(paths[1], []Song{{Song: "b"}}, now)
+	cache.get(paths[0]) // a becomes the most recently used
+	cache.put(paths[2], []Song{{Song: "c"}}, now)
+
+	stats := cache.snapshot()
+	if stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("Unexpected cache stats: %+v", stats)
+	}
+	if _, ok := cache.entries[paths[1]]; ok {
+		t.Errorf("b should have been evicted")
+	}
+	if _, ok := cache.entries[paths[0]]; !ok {
+		t.Errorf("a should have been kept")
+	}
+}
+
+// TestCacheExpiry Test that both tiers and the cleanup apply the same expiry rule
+func TestCacheExpiry(t *testing.T) {
+	t.Setenv("API_CACHE_TIME", "1")
+	cacheDir := t.TempDir()
+	cache := newSongCache()
+	fresh := filepath.Join(cacheDir, "fresh.json")
+	expired := filepath.Join(cacheDir, "expired.json")
+	writeCacheFile(fresh, []Song{{Song: "fresh"}}, time.Now().Add(-59*time.Minute).Format(time.RFC3339))
+	writeCacheFile(expired, []Song{{Song: "expired"}}, time.Now().Add(-61*time.Minute).Format(time.RFC3339))
+
+	// A recent mtime does not keep an expired cache file alive
+	if _, _, ok := cache.get(expired); ok {
+		t.Errorf("An expired cache file should be a miss")
+	}
+	if _, _, ok := cache.get(fresh); !ok {
+		t.Errorf("A fresh cache file should be a hit")
+	}
+
+	// A cached query expires in memory as well
+	stale := filepath.Join(cacheDir, "stale.json")
+	cache.remember(stale, []Song{{Song: "stale"}}, time.Now().Add(-2*time.Hour).Format(time.RFC3339))
+	if _, _, ok := cache.get(stale); ok {
+		t.Errorf("An expired memory entry should not be served")
+	}
+
+	newCacheJanitor(cacheDir, time.Hour, 0).sweep()
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Errorf("Expired cache file should be deleted")
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("Fresh cache file should be kept: %s", err)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// cacheDirPath function: Return the directory of the API cache, set by CACHE_DIR
+func cacheDirPath() string {
+	if dir := os.Getenv("CACHE_DIR"); dir != "" {
+		return dir
+	}
+	return "./cache"
+}
+
+// Sidecar file mapping cache file names to the queries they answer.
+const cacheIndexName = "index.json"
+
+// Pattern of the temporary files cache files and the index are written to before they are renamed.
+const cacheTempPattern = ".tmp-*.json"
+
+// Search parameters answered by one cache file, the filters are only set on the cache files of older versions.
+type cacheQuery struct {
+	Msg     string `json:"msg"`
+	Singer  string `json:"singer,omitempty"`
+	Num     string `json:"num,omitempty"`
+	Album   string `json:"album,omitempty"`
+	Lyrics  string `json:"has_lyrics,omitempty"`
+	Quality string `json:"quality,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+// Serialises the read-modify-write cycles of the cache index.
+var cacheIndexMu sync.Mutex
+
+// newCacheQuery function: Build the cache query of a search term, every filter and spelling of it shares the unfiltered results
+func newCacheQuery(msg string) cacheQuery {
+	return cacheQuery{Msg: normaliseQuery(msg)}
+}
+
+// fileName function: Return the cache file name of the query, a fixed length hash that is safe on every filesystem
+func (query cacheQuery) fileName() string {
+	// url.Values encodes the fields unambiguously, so different queries never share an input
+	values := url.Values{"msg": {query.Msg}, "singer": {query.Singer}, "num": {query.Num}}
+	// Later filters are only encoded when set, so the names of older cache files do not change
+	for name, value := range map[string]string{"album": query.Album, "has_lyrics": query.Lyrics, "quality": query.Quality, "source": query.Source} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	canonical := values.Encode()
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+// cacheFilePathFor function: Return the path of the cache file of a query
+func cacheFilePathFor(cacheDir string, query cacheQuery) string {
+	return filepath.Join(cacheDir, query.fileName())
+}
+
+// isCacheKeyFile function: Report whether a file name is a hashed cache file name
+func isCacheKeyFile(name string) bool {
+	key, ok := strings.CutSuffix(name, ".json")
+	if !ok || len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil && strings.ToLower(key) == key
+}
+
+// isCacheDataFile function: Report whether a cache directory entry holds songs of a query
+func isCacheDataFile(name string) bool {
+	return filepath.Ext(name) == ".json" && name != cacheIndexName && name != "embedded.json" && !strings.HasPrefix(name, ".")
+}
+
+// readCacheIndex function: Read the cache index of a directory, a missing or damaged index is empty
+func readCacheIndex(cacheDir string) map[string]cacheQuery {
+	index := map[string]cacheQuery{}
+	fileContent, err := os.ReadFile(filepath.Join(cacheDir, cacheIndexName))
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(fileContent, &index); err != nil {
+		fmt.Println("Error decoding cache index: ", err)
+		return map[string]cacheQuery{}
+	}
+	return index
+}
+
+// writeCacheIndex function: Write the cache index of a directory atomically
+func writeCacheIndex(cacheDir string, index map[string]cacheQuery) {
+	fileContent, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		fmt.Println("Error encoding cache index: ", err)
+		return
+	}
+	if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
+		fmt.Println("Error creating cache directory: ", err)
+		return
+	}
+	file, err := os.CreateTemp(cacheDir, cacheTempPattern)
+	if err != nil {
+		fmt.Println("Error creating cache index: ", err)
+		return
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(fileContent)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(cacheDir, cacheIndexName))
+	}
+	if err != nil {
+		fmt.Println("Error writing cache index: ", err)
+	}
+}
+
+// recordCacheQuery function: Add a query to the cache index unless it is already there
+func recordCacheQuery(cacheDir string, query cacheQuery) {
+	cacheIndexMu.Lock()
+	defer cacheIndexMu.Unlock()
+	index := readCacheIndex(cacheDir)
+	if recorded, ok := index[query.fileName()]; ok && recorded == query {
+		return
+	}
+	index[query.fileName()] = query
+	writeCacheIndex(cacheDir, index)
+}
+
+// forgetCacheFiles function: Remove cache file names from the cache index
+func forgetCacheFiles(cacheDir string, names ...string) {
+	if len(names) == 0 {
+		return
+	}
+	cacheIndexMu.Lock()
+	defer cacheIndexMu.Unlock()
+	index := readCacheIndex(cacheDir)
+	changed := false
+	for _, name := range names {
+		if _, ok := index[name]; ok {
+			delete(index, name)
+			changed = true
+		}
+	}
+	if changed {
+		writeCacheIndex(cacheDir, index)
+	}
+}
+
+// migrateCacheFiles function: Re-key the cache files named after their raw search term, returning how many were moved
+func migrateCacheFiles(cacheDir string) int {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return 0
+	}
+
+	cacheIndexMu.Lock()
+	defer cacheIndexMu.Unlock()
+	index := readCacheIndex(cacheDir)
+	migrated := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !isCacheDataFile(name) || isCacheKeyFile(name) {
+			continue
+		}
+		// Legacy cache files answered a query without filters
+		query := newCacheQuery(strings.TrimSuffix(name, ".json"))
+		oldPath, newPath := filepath.Join(cacheDir, name), cacheFilePathFor(cacheDir, query)
+		if query.Msg == "" {
+			err = os.Remove(oldPath)
+		} else if _, statErr := os.Stat(newPath); statErr == nil {
+			// A re-keyed file of the same query is newer than the legacy one
+			err = os.Remove(oldPath)
+		} else {
+			if err = os.Rename(oldPath, newPath); err == nil {
+				index[query.fileName()] = query
+				migrated++
+			}
+		}
+		if err != nil {
+			fmt.Println("Error migrating cache file: ", name, err)
+		}
+	}
+	if migrated > 0 {
+		writeCacheIndex(cacheDir, index)
+	}
+	return migrated
+}
+
+// startCache function: Re-key legacy cache files before the first request
+func startCache() {
+	if migrated := migrateCacheFiles(cacheDirPath()); migrated > 0 {
+		fmt.Printf("%d cache files migrated to hashed keys.\n", migrated)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCacheQueryFileName Test that cache file names are bounded, safe and unique per query
+func TestCacheQueryFileName(t *testing.T) {
+	queries := []cacheQuery{
+		newCacheQuery("晴天"),
+		{Msg: "晴天", Singer: "周杰伦"},
+		{Msg: "晴天", Num: "1"},
+		newCacheQuery("../../etc/passwd"),
+		newCacheQuery(strings.Repeat("long query ", 100)),
+		newCacheQuery("a&singer=b"),
+		{Msg: "a", Singer: "b"},
+		newCacheQuery(`con:*?"<>|`),
+	}
+	seen := map[string]cacheQuery{}
+	for _, query := range queries {
+		name := query.fileName()
+		if !isCacheKeyFile(name) {
+			t.Errorf("fileName(%+v) = %q is not a cache key file name", query, name)
+		}
+		if previous, ok := seen[name]; ok {
+			t.Errorf("Queries %+v and %+v share the file name %q", previous, query, name)
+		}
+		seen[name] = query
+	}
+
+	// Equivalent requests share their cache file
+	if newCacheQuery("  晴天   周杰伦 ").fileName() != newCacheQuery("晴天 周杰伦").fileName() {
+		t.Errorf("Equivalent queries should share their cache file name")
+	}
+}
+
+// TestMigrateCacheFiles Test that legacy cache files are re-keyed and recorded in the cache index
+func TestMigrateCacheFiles(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeTestFile(t, cacheDir, "晴天.json", []byte(`{"songs":[{"song":"晴天"}],"timestamp":"legacy"}`))
+	writeTestFile(t, cacheDir, "embedded.json", []byte(`{}`))
+	rekeyed := newCacheQuery("Sunny")
+	writeCacheFile(cacheFilePathFor(cacheDir, rekeyed), []Song{{Song: "Sunny"}}, "new")
+	writeTestFile(t, cacheDir, "Sunny.json", []byte(`{"songs":[],"timestamp":"legacy"}`))
+
+	if migrated := migrateCacheFiles(cacheDir); migrated != 1 {
+		t.Errorf("Expected 1 migrated cache file, got %d", migrated)
+	}
+	query := newCacheQuery("晴天")
+	songs, timestamp := readCacheFile(cacheFilePathFor(cacheDir, query))
+	if len(songs) != 1 || timestamp != "legacy" {
+		t.Errorf("Unexpected migrated cache content: %+v %q", songs, timestamp)
+	}
+	if _, timestamp := readCacheFile(cacheFilePathFor(cacheDir, rekeyed)); timestamp != "new" {
+		t.Errorf("A re-keyed cache file must not be replaced by a legacy one, got timestamp %q", timestamp)
+	}
+	for _, name := range []string{"晴天.json", "Sunny.json"} {
+		if _, err := os.Stat(filepath.Join(cacheDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Legacy cache file %s should be gone", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "embedded.json")); err != nil {
+		t.Errorf("embedded.json must be kept: %s", err)
+	}
+	if index := readCacheIndex(cacheDir); index[query.fileName()] != query {
+		t.Errorf("Cache index does not record the migrated query: %+v", index)
+	}
+
+	// Migrating again is a no-op
+	if migrated := migrateCacheFiles(cacheDir); migrated != 0 {
+		t.Errorf("Expected nothing to migrate, got %d", migrated)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HTTP client for upstream APIs, requests are bounded by their context.
+var upstreamClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// Songs returned by one provider of a fan-out.
+type providerResult struct {
+	API      API
+	Songs    []Song
+	Err      error
+	Duration time.Duration
+}
+
+// Bounds the upstream requests in flight, shared by the providers of a fan-out and the lookups they make themselves.
+type requestLimiter struct {
+	mu    sync.Mutex
+	slots chan struct{}
+}
+
+// The limiter of every request made with upstreamClient.
+var upstreamRequests = &requestLimiter{}
+
+// fanOutWorkers function: Return the number of concurrent upstream requests, set by FANOUT_WORKERS
+func fanOutWorkers() int {
+	workers, err := strconv.Atoi(os.Getenv("FANOUT_WORKERS"))
+	if err != nil || workers <= 0 {
+		return 8
+	}
+	return workers
+}
+
+// providerTimeout function: Return the timeout of a provider, its "timeout" in metadata.json or PROVIDER_TIMEOUT, in seconds
+func providerTimeout(api API) time.Duration {
+	if api.Timeout > 0 {
+		return time.Duration(api.Timeout) * time.Second
+	}
+	seconds, err := strconv.Atoi(os.Getenv("PROVIDER_TIMEOUT"))
+	if err != nil || seconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// acquire function: Wait for one of the FANOUT_WORKERS request slots until ctx is done, returning the function that frees it
+func (limiter *requestLimiter) acquire(ctx context.Context) (func(), error) {
+	limiter.mu.Lock()
+	// A new FANOUT_WORKERS takes effect for the requests started after it
+	if workers := fanOutWorkers(); cap(limiter.slots) != workers {
+		limiter.slots = make(chan struct{}, workers)
+	}
+	slots := limiter.slots
+	limiter.mu.Unlock()
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// forEachConcurrent function: Call fn for 0..n-1 on a goroutine each and wait for them, their upstream requests wait for upstreamRequests
+func forEachConcurrent(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// fanOutSearch function: Search every API concurrently, results keep the order of apis and slow providers only lose their own songs
+func fanOutSearch(ctx context.Context, apis []API, msg string) []providerResult {
+	results := make([]providerResult, len(apis))
+	forEachConcurrent(len(apis), func(i int) {
+		results[i] = searchProvider(ctx, apis[i], msg)
+	})
+	return results
+}
+
+// streamSearch function: Search every API concurrently and send each result as soon as its provider answers, the channel is closed after the last one
+func streamSearch(ctx context.Context, apis []API, msg string) <-chan providerResult {
+	results := make(chan providerResult, len(apis))
+	go func() {
+		defer close(results)
+		forEachConcurrent(len(apis), func(i int) {
+			results <- searchProvider(ctx, apis[i], msg)
+		})
+	}()
+	return results
+}
+
+// searchProvider function: Search one API within its timeout, a provider ignoring its context is abandoned
+func searchProvider(ctx context.Context, api API, msg string) providerResult {
+	start := time.Now()
+	provider, err := newProvider(api)
+	if err != nil {
+		return providerResult{API: api, Err: err}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, providerTimeout(api))
+	defer cancel()
+	done := make(chan providerResult, 1)
+	go func() {
+		songs, err := provider.Search(ctx, msg)
+		done <- providerResult{API: api, Songs: songs, Err: err}
+	}()
+
+	var result providerResult
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		// Give a provider honouring ctx a moment to hand over what it found so far
+		select {
+		case result = <-done:
+			if result.Err == nil {
+				result.Err = ctx.Err()
+			}
+		case <-time.After(100 * time.Millisecond):
+			result = providerResult{API: api, Err: ctx.Err()}
+		}
+	}
+	result.Duration = time.Since(start)
+	if result.Err != nil {
+		fmt.Printf("Provider %q returned %d songs in %s: %v\n", api.APIType, len(result.Songs), result.Duration, result.Err)
+	}
+	return result
+}
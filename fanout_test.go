@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Provider that answers after a delay, or never when it ignores its context.
+type slowProvider struct {
+	fakeProvider
+	delay     time.Duration
+	ignoreCtx bool
+}
+
+func (provider *slowProvider) Search(ctx context.Context, msg string) ([]Song, error) {
+	if provider.ignoreCtx {
+		time.Sleep(provider.delay)
+		return []Song{{Song: "too late"}}, nil
+	}
+	select {
+	case <-time.After(provider.delay):
+		return []Song{{Song: provider.api.Sources}}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func init() {
+	registerProvider("fake-slow", func(api API) Provider {
+		return &slowProvider{fakeProvider: fakeProvider{api: api}, delay: 300 * time.Millisecond}
+	})
+	registerProvider("fake-stuck", func(api API) Provider {
+		return &slowProvider{fakeProvider: fakeProvider{api: api}, delay: 10 * time.Second, ignoreCtx: true}
+	})
+}
+
+// TestFanOutSearchConcurrent Test that providers are queried concurrently and keep their order
+func TestFanOutSearchConcurrent(t *testing.T) {
+	apis := []API{
+		{APIType: "fake-slow", Sources: "first"},
+		{APIType: "fake-slow", Sources: "second"},
+		{APIType: "fake-slow", Sources: "third"},
+	}
+	start := time.Now()
+	results := fanOutSearch(context.Background(), apis, "")
+	if elapsed := time.Since(start); elapsed > 800*time.Millisecond {
+		t.Errorf("Fan-out took %s, providers were not queried concurrently", elapsed)
+	}
+	for i, result := range results {
+		if result.Err != nil || len(result.Songs) != 1 || result.Songs[0].Song != apis[i].Sources {
+			t.Errorf("Result %d: unexpected %+v", i, result)
+		}
+	}
+}
+
+// TestFanOutSearchTimeout Test that a stuck provider does not hold back the others
+func TestFanOutSearchTimeout(t *testing.T) {
+	apis := []API{
+		{APIType: "fake-stuck", Timeout: 1},
+		{APIType: "fake-slow", Sources: "fast"},
+		{APIType: "unknown"},
+	}
+	start := time.Now()
+	results := fanOutSearch(context.Background(), apis, "")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Fan-out took %s, the stuck provider was not abandoned", elapsed)
+	}
+	if results[0].Err != context.DeadlineExceeded {
+		t.Errorf("Expected the stuck provider to time out, got %v", results[0].Err)
+	}
+	if len(results[1].Songs) != 1 || results[1].Songs[0].Song != "fast" {
+		t.Errorf("Expected partial results from the fast provider, got %+v", results[1])
+	}
+	if results[2].Err == nil {
+		t.Errorf("Expected an error for an unknown api_type")
+	}
+}
+
+// TestUpstreamRequestLimit Test that providers and their own lookups share FANOUT_WORKERS upstream requests
+func TestUpstreamRequestLimit(t *testing.T) {
+	t.Setenv("FANOUT_WORKERS", "3")
+	var running, maxRunning, total int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&total, 1)
+		time.Sleep(5 * time.Millisecond)
+		if r.URL.Query().Get("n") == "" {
+			fmt.Fprint(w, `{"code":200,"data":[
+				{"num":1,"song":"晴天","singer":"周杰伦","cover":"c1","album_name":"叶惠美"},
+				{"num":2,"song":"晴天 (Live)","singer":"周杰伦","cover":"c2","album_name":"Live"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"code":200,"data":{"music":"http://music/song"}}`)
+	}))
+	defer server.Close()
+	defer func(previous string) { yuafengBaseURL = previous }(yuafengBaseURL)
+	yuafengBaseURL = server.URL
+
+	apis := []API{
+		{APIType: "api.yuanfeng.cn", Sources: "kuwo"},
+		{APIType: "api.yuanfeng.cn", Sources: "netease"},
+		{APIType: "api.yuanfeng.cn", Sources: "migu"},
+	}
+	for i, result := range fanOutSearch(context.Background(), apis, "晴天") {
+		if result.Err != nil || len(result.Songs) != 2 {
+			t.Errorf("Result %d: unexpected %+v", i, result)
+		}
+	}
+	// Each provider makes one search and 8 format lookups
+	if total != 27 || maxRunning > 3 {
+		t.Errorf("Made %d requests with up to %d at once, want 27 with up to 3", total, maxRunning)
+	}
+}
+
+// TestYuafengAPIResponseHandler Test the concurrent format lookups of 枫雨API
+func TestYuafengAPIResponseHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("n") == "" {
+			fmt.Fprint(w, `{"code":200,"data":[
+				{"num":1,"song":"晴天","singer":"周杰伦","cover":"c1","album_name":"叶惠美"},
+				{"num":2,"song":"晴天 (Live)","singer":"周杰伦","cover":"c2","album_name":"Live"}]}`)
+			return
+		}
+		// The lossless lookup of the second song hangs
+		if query.Get("n") == "2" && query.Get("format") == "SQ" {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprintf(w, `{"code":200,"data":{"music":"http://music/%s/%s"}}`, query.Get("n"), strings.ToLower(query.Get("format")))
+	}))
+	defer server.Close()
+	defer func(previous string) { yuafengBaseURL = previous }(yuafengBaseURL)
+	yuafengBaseURL = server.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	songs := YuafengAPIResponseHandler(ctx, "", "晴天", "kuwo")
+	if len(songs) != 2 {
+		t.Fatalf("Expected one song per result, got %d: %+v", len(songs), songs)
+	}
+	if songs[0].MusicURL.Superquality != "http://music/1/sq" || songs[0].MusicURL.Audition != "http://music/1/lq" {
+		t.Errorf("Unexpected URLs of the first song: %+v", songs[0].MusicURL)
+	}
+	if songs[1].MusicURL.Superquality != "" || songs[1].MusicURL.Standard != "http://music/2/pq" {
+		t.Errorf("Expected partial URLs of the second song: %+v", songs[1].MusicURL)
+	}
+}
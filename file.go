@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -60,15 +62,26 @@ func fileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Construct the complete file path
-	fullFilePath := filepath.Join("./music-uploads", filePath)
+	// Confine the request to the media root, private files look like missing ones
+	fullFilePath, err := resolveMediaPath(mediaRoot(), filePath)
+	if err != nil {
+		NotFoundHandler(w, r)
+		return
+	}
 
-	// Get file content
-	fileContent, err := GetFileContent(fullFilePath)
+	// Open the file, it is streamed from disk instead of being buffered
+	file, err := os.Open(fullFilePath)
 	if err != nil {
 		NotFoundHandler(w, r)
 		return
 	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil || fileInfo.IsDir() {
+		NotFoundHandler(w, r)
+		return
+	}
 
 	// Set appropriate Content-Type based on file extension
 	ext := filepath.Ext(filePath)
@@ -106,15 +119,45 @@ func fileHandler(w http.ResponseWriter, r *http.Request) {
 	case ".mrc":
 		w.Header().Set("Content-Type", "text/plain")
 	case ".json":
-		if filePath == "metadata.json" {
-			NotFoundHandler(w, r)
-			return
-		}
 		w.Header().Set("Content-Type", "application/json")
 	default:
 		w.Header().Set("Content-Type", "application/octet-stream")
 	}
 
-	// Write file content to response
-	w.Write(fileContent)
+	// Range, If-Range, If-None-Match and If-Modified-Since are handled by ServeContent
+	w.Header().Set("Server", "MeowMusicServer")
+	w.Header().Set("ETag", fileETag(fileInfo))
+	http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), file)
+}
+
+// fileETag function: Build a strong ETag from the size and modification time of a file
+func fileETag(fileInfo os.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", fileInfo.ModTime().UnixNano(), fileInfo.Size())
+}
+
+// coverHandler function: Serve the picture embedded in an audio file
+func coverHandler(w http.ResponseWriter, r *http.Request) {
+	// Remove the prefix '/cover/'
+	filePath := strings.TrimPrefix(r.URL.Path, "/cover/")
+
+	fullFilePath, err := resolveMediaPath(mediaRoot(), filePath)
+	if err != nil {
+		NotFoundHandler(w, r)
+		return
+	}
+	fileInfo, err := os.Stat(fullFilePath)
+	if err != nil || fileInfo.IsDir() {
+		NotFoundHandler(w, r)
+		return
+	}
+	tags, err := readAudioTags(fullFilePath)
+	if err != nil || tags.Picture == nil {
+		NotFoundHandler(w, r)
+		return
+	}
+
+	w.Header().Set("Server", "MeowMusicServer")
+	w.Header().Set("Content-Type", tags.PictureMIME)
+	w.Header().Set("ETag", fileETag(fileInfo))
+	http.ServeContent(w, r, "", fileInfo.ModTime(), bytes.NewReader(tags.Picture))
 }
@@ -85,14 +85,9 @@ func TestGetFileContent(t *testing.T) {
 
 // TestFileHandlerAudio Test fileHandler function for audio files
 func TestFileHandlerAudio(t *testing.T) {
-	// Define the base directory for music uploads
-	baseDir := "./music-uploads"
-
-	// Create the base directory if it doesn't exist
-	if err := os.MkdirAll(baseDir, 0777); err != nil {
-		t.Fatalf("Cannot create base directory: %s", err)
-	}
-	defer os.RemoveAll(baseDir) // Clean up
+	// Serve the test file from a temporary media root, ./music-uploads is left alone
+	baseDir := t.TempDir()
+	t.Setenv("MEDIA_ROOT", baseDir)
 
 	// Create the test file in the base directory
 	testFilePath := filepath.Join(baseDir, "testfile.mp3")
@@ -132,14 +127,9 @@ func TestFileHandlerAudio(t *testing.T) {
 
 // TestFileHandlerImage Test fileHandler function for image files
 func TestFileHandlerImage(t *testing.T) {
-	// Define the base directory for music uploads
-	baseDir := "./music-uploads"
-
-	// Create the base directory if it doesn't exist
-	if err := os.MkdirAll(baseDir, 0777); err != nil {
-		t.Fatalf("Cannot create base directory: %s", err)
-	}
-	defer os.RemoveAll(baseDir) // Clean up
+	// Serve the test file from a temporary media root, ./music-uploads is left alone
+	baseDir := t.TempDir()
+	t.Setenv("MEDIA_ROOT", baseDir)
 
 	// Create the test file in the base directory
 	testFilePath := filepath.Join(baseDir, "testfile.jpg")
@@ -179,14 +169,8 @@ func TestFileHandlerImage(t *testing.T) {
 
 // TestFileHandlerNotFound Test fileHandler function for nonexistent files
 func TestFileHandlerNotFound(t *testing.T) {
-	// Define the base directory for music uploads
-	baseDir := "./music-uploads"
-
-	// Create the base directory if it doesn't exist
-	if err := os.MkdirAll(baseDir, 0777); err != nil {
-		t.Fatalf("Cannot create base directory: %s", err)
-	}
-	defer os.RemoveAll(baseDir) // Clean up
+	// Look in an empty temporary media root, ./music-uploads is left alone
+	t.Setenv("MEDIA_ROOT", t.TempDir())
 
 	// Set HTTP request
 	req, err := http.NewRequest("GET", "/file/nonexistentfile.mp3", nil)
@@ -207,23 +191,18 @@ func TestFileHandlerNotFound(t *testing.T) {
 
 // TestFileHandlerDefaultContentType Test fileHandler function for default content type
 func TestFileHandlerDefaultContentType(t *testing.T) {
-	// Define the base directory for music uploads
-	baseDir := "./music-uploads"
+	// Serve the test file from a temporary media root, ./music-uploads is left alone
+	baseDir := t.TempDir()
+	t.Setenv("MEDIA_ROOT", baseDir)
 
-	// Create the base directory if it doesn't exist
-	if err := os.MkdirAll(baseDir, 0777); err != nil {
-		t.Fatalf("Unable to create base directory: %s", err)
-	}
-	defer os.RemoveAll(baseDir) // Clean up
-
-	// Create the test file in the base directory
-	testFilePath := filepath.Join(baseDir, "testfile.txt")
+	// Create the test file in the base directory, .txt is served as text/plain so the extension must be unknown
+	testFilePath := filepath.Join(baseDir, "testfile.bin")
 	if err := ioutil.WriteFile(testFilePath, []byte("text data"), 0666); err != nil {
 		t.Fatalf("Cannot create file: %s", err)
 	}
 
 	// Set HTTP request
-	req, err := http.NewRequest("GET", "/file/testfile.txt", nil)
+	req, err := http.NewRequest("GET", "/file/testfile.bin", nil)
 	if err != nil {
 		t.Fatalf("Cannot create HTTP request: %s", err)
 	}
@@ -251,3 +230,105 @@ func TestFileHandlerDefaultContentType(t *testing.T) {
 		t.Errorf("Response body error: got %v, want %v", rr.Body.String(), expectedBody)
 	}
 }
+
+// TestFileHandlerRange Test fileHandler function for partial content requests
+func TestFileHandlerRange(t *testing.T) {
+	// Serve the test file from a temporary media root, ./music-uploads is left alone
+	baseDir := t.TempDir()
+	t.Setenv("MEDIA_ROOT", baseDir)
+
+	// Create the test file in the base directory
+	testFilePath := filepath.Join(baseDir, "testfile.flac")
+	if err := ioutil.WriteFile(testFilePath, []byte("0123456789"), 0666); err != nil {
+		t.Fatalf("Cannot create file: %s", err)
+	}
+
+	// Set HTTP request with a single range
+	req, err := http.NewRequest("GET", "/file/testfile.flac", nil)
+	if err != nil {
+		t.Fatalf("Cannot create HTTP request: %s", err)
+	}
+	req.Header.Set("Range", "bytes=2-5")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(fileHandler).ServeHTTP(rr, req)
+
+	// Check response status code, Content-Type and body
+	if status := rr.Code; status != http.StatusPartialContent {
+		t.Errorf("Status code error: got %v, want %v", status, http.StatusPartialContent)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "audio/flac" {
+		t.Errorf("Content-Type error: got %v, want %v", contentType, "audio/flac")
+	}
+	if contentRange := rr.Header().Get("Content-Range"); contentRange != "bytes 2-5/10" {
+		t.Errorf("Content-Range error: got %v, want %v", contentRange, "bytes 2-5/10")
+	}
+	if rr.Body.String() != "2345" {
+		t.Errorf("Response body error: got %v, want %v", rr.Body.String(), "2345")
+	}
+
+	// Set HTTP request with multiple ranges
+	req.Header.Set("Range", "bytes=0-1,8-9")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(fileHandler).ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusPartialContent {
+		t.Errorf("Status code error: got %v, want %v", status, http.StatusPartialContent)
+	}
+	if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "multipart/byteranges") {
+		t.Errorf("Content-Type error: got %v, want multipart/byteranges", contentType)
+	}
+
+	// If-Range with a stale ETag must return the full file
+	req.Header.Set("Range", "bytes=2-5")
+	req.Header.Set("If-Range", "\"stale\"")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(fileHandler).ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Status code error: got %v, want %v", status, http.StatusOK)
+	}
+	if rr.Body.String() != "0123456789" {
+		t.Errorf("Response body error: got %v, want %v", rr.Body.String(), "0123456789")
+	}
+}
+
+// TestFileHandlerConditional Test fileHandler function for conditional requests
+func TestFileHandlerConditional(t *testing.T) {
+	// Serve the test file from a temporary media root, ./music-uploads is left alone
+	baseDir := t.TempDir()
+	t.Setenv("MEDIA_ROOT", baseDir)
+
+	// Create the test file in the base directory
+	testFilePath := filepath.Join(baseDir, "testfile.mp3")
+	if err := ioutil.WriteFile(testFilePath, []byte("binary audio data"), 0666); err != nil {
+		t.Fatalf("Cannot create file: %s", err)
+	}
+
+	// First request returns the validators
+	req, err := http.NewRequest("GET", "/file/testfile.mp3", nil)
+	if err != nil {
+		t.Fatalf("Cannot create HTTP request: %s", err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(fileHandler).ServeHTTP(rr, req)
+	etag := rr.Header().Get("ETag")
+	lastModified := rr.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("Validators missing: ETag %q, Last-Modified %q", etag, lastModified)
+	}
+
+	// If-None-Match with the same ETag returns 304
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(fileHandler).ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotModified {
+		t.Errorf("Status code error: got %v, want %v", status, http.StatusNotModified)
+	}
+
+	// If-Modified-Since with the same date returns 304
+	req.Header.Del("If-None-Match")
+	req.Header.Set("If-Modified-Since", lastModified)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(fileHandler).ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotModified {
+		t.Errorf("Status code error: got %v, want %v", status, http.StatusNotModified)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Source of the songs served from the media root and the "other" list of metadata.json.
+const localSource = "local"
+
+// Filters of an /api request, every filter that is set must match.
+type songFilters struct {
+	Num        int    // 0 matches every number
+	Singer     string // normalised, matched as a substring
+	Album      string // normalised, matched as a substring
+	HasLyrics  bool
+	MinQuality string // one of qualityNames
+	Source     string // "local" or the source of a provider
+}
+
+// An invalid filter parameter, Param names the query string parameter.
+type filterError struct {
+	Param string
+}
+
+func (err *filterError) Error() string {
+	return fmt.Sprintf("invalid '%s' parameter", err.Param)
+}
+
+// parseSongFilters function: Read the num, singer, album, has_lyrics, quality and source filters from the query string
+func parseSongFilters(queryParams url.Values) (songFilters, error) {
+	var filters songFilters
+	if numStr := queryParams.Get("num"); numStr != "" {
+		num, err := strconv.Atoi(numStr)
+		if err != nil {
+			return songFilters{}, &filterError{Param: "num"}
+		}
+		filters.Num = num
+	}
+	filters.Singer = normaliseText(queryParams.Get("singer"))
+	filters.Album = normaliseText(queryParams.Get("album"))
+	if hasLyrics := queryParams.Get("has_lyrics"); hasLyrics != "" {
+		value, err := strconv.ParseBool(hasLyrics)
+		if err != nil {
+			return songFilters{}, &filterError{Param: "has_lyrics"}
+		}
+		filters.HasLyrics = value
+	}
+	if quality := strings.ToLower(strings.TrimSpace(queryParams.Get("quality"))); quality != "" {
+		if !slices.Contains(qualityNames, quality) {
+			return songFilters{}, &filterError{Param: "quality"}
+		}
+		filters.MinQuality = quality
+	}
+	filters.Source = strings.ToLower(strings.TrimSpace(queryParams.Get("source")))
+	return filters, nil
+}
+
+// match function: Report whether a song passes every filter
+func (filters songFilters) match(song Song) bool {
+	if filters.Num != 0 && song.Num != filters.Num {
+		return false
+	}
+	if filters.Singer != "" && !strings.Contains(normaliseText(song.Singer), filters.Singer) {
+		return false
+	}
+	if filters.Album != "" && !strings.Contains(normaliseText(song.Album), filters.Album) {
+		return false
+	}
+	if filters.Source != "" && !strings.EqualFold(song.Source, filters.Source) {
+		return false
+	}
+	if !filters.HasLyrics && filters.MinQuality == "" {
+		return true
+	}
+
+	// Cached songs hold their URLs as decoded JSON objects
+	typedSongFields(&song)
+	if filters.HasLyrics && !hasLyrics(song) {
+		return false
+	}
+	if filters.MinQuality != "" && bestQuality(song) > slices.Index(qualityNames, filters.MinQuality) {
+		return false
+	}
+	return true
+}
+
+// apply function: Return the songs that pass every filter, in their order
+func (filters songFilters) apply(songs []Song) []Song {
+	filtered := []Song{}
+	for _, song := range songs {
+		if filters.match(song) {
+			filtered = append(filtered, song)
+		}
+	}
+	return filtered
+}
+
+// Helper function to check that a song has a lyric URL of any format
+func hasLyrics(song Song) bool {
+	switch lyric := song.Lyric.(type) {
+	case Lyric:
+		return lyric.Lrc != "" || lyric.Mrc != "" || lyric.Txt != ""
+	case string:
+		return lyric != ""
+	}
+	return false
+}
+
+// Helper function to return the index in qualityNames of the best quality a song is available in, len(qualityNames) for none
+func bestQuality(song Song) int {
+	musicURL, ok := song.MusicURL.(MusicURL)
+	if !ok {
+		return len(qualityNames)
+	}
+	for i, url := range []string{musicURL.Hires, musicURL.Lossless, musicURL.Superquality, musicURL.Highquality, musicURL.Standard, musicURL.Audition} {
+		if url != "" {
+			return i
+		}
+	}
+	return len(qualityNames)
+}
+
+// providerSource function: Return the source name of the songs of a provider, its "sources", "api_type" or host
+func providerSource(api API) string {
+	if api.Sources != "" {
+		return strings.ToLower(api.Sources)
+	}
+	if api.APIType != "" {
+		return strings.ToLower(api.APIType)
+	}
+	if parsedURL, err := url.Parse(api.APIURL); err == nil && parsedURL.Host != "" {
+		return strings.ToLower(parsedURL.Host)
+	}
+	return "upstream"
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseSongFilters Test that filters are normalised and invalid values are reported by parameter
+func TestParseSongFilters(t *testing.T) {
+	tests := []struct {
+		query string
+		want  songFilters
+		param string
+	}{
+		{"", songFilters{}, ""},
+		{"num=02&singer=ＡＬＩＣＥ&album=Spring", songFilters{Num: 2, Singer: "alice", Album: "spring"}, ""},
+		{"has_lyrics=true&quality=Lossless&source=Local", songFilters{HasLyrics: true, MinQuality: "lossless", Source: "local"}, ""},
+		{"has_lyrics=0", songFilters{}, ""},
+		{"num=one", songFilters{}, "num"},
+		{"has_lyrics=maybe", songFilters{}, "has_lyrics"},
+		{"quality=ultra", songFilters{}, "quality"},
+	}
+	for _, test := range tests {
+		queryParams, _ := url.ParseQuery(test.query)
+		got, err := parseSongFilters(queryParams)
+		param := ""
+		if invalid, ok := err.(*filterError); ok {
+			param = invalid.Param
+		}
+		if got != test.want || param != test.param {
+			t.Errorf("parseSongFilters(%q) = %+v, %v, want %+v, invalid %q", test.query, got, err, test.want, test.param)
+		}
+	}
+}
+
+// TestSongFiltersMatch Test the quality and lyrics filters on typed and decoded songs
+func TestSongFiltersMatch(t *testing.T) {
+	song := Song{MusicURL: MusicURL{Superquality: "sq.flac", Standard: "std.mp3"}, Lyric: Lyric{Txt: "lyric.txt"}}
+	var decoded Song
+	data, _ := json.Marshal(song)
+	json.Unmarshal(data, &decoded)
+
+	tests := []struct {
+		filters songFilters
+		want    bool
+	}{
+		{songFilters{MinQuality: "audition"}, true},
+		{songFilters{MinQuality: "superquality"}, true},
+		{songFilters{MinQuality: "lossless"}, false},
+		{songFilters{HasLyrics: true}, true},
+		{songFilters{HasLyrics: true, MinQuality: "hires"}, false},
+	}
+	for _, test := range tests {
+		for _, candidate := range []Song{song, decoded} {
+			if got := test.filters.match(candidate); got != test.want {
+				t.Errorf("%+v.match(%T) = %v, want %v", test.filters, candidate.MusicURL, got, test.want)
+			}
+		}
+	}
+	if (songFilters{HasLyrics: true}).match(Song{}) || (songFilters{MinQuality: "audition"}).match(Song{}) {
+		t.Errorf("A song without URLs should not pass the lyrics or quality filters")
+	}
+}
+
+// TestAPIHandlerFilters Test every combination of filters on cache misses and hits
+func TestAPIHandlerFilters(t *testing.T) {
+	setupAPITest(t, 0)
+	fakeProviderSongs["filters"] = []Song{
+		{Song: "Rain E", Singer: "Alice", Album: "Spring", MusicURL: MusicURL{Lossless: "e.flac"}, Lyric: Lyric{Lrc: "e.lrc"}},
+	}
+	t.Cleanup(func() { delete(fakeProviderSongs, "filters") })
+	metadata, _ := json.Marshal(Metadata{
+		API: []API{{APIType: "fake", Sources: "filters"}},
+		Other: []OtherSong{
+			{SongName: "Rain A", Singer: "Alice", Album: "Spring", MusicURL: MusicURL{Lossless: "a.flac", Standard: "a.mp3"}, LyricURL: Lyric{Lrc: "a.lrc"}},
+			{SongName: "Rain B", Singer: "Alice", Album: "Summer", MusicURL: MusicURL{Standard: "b.mp3"}},
+			{SongName: "Rain C", Singer: "Bob", Album: "Spring", MusicURL: MusicURL{Hires: "c.flac"}},
+			{SongName: "Rain D", Singer: "Bob", Album: "Summer", MusicURL: MusicURL{Audition: "d.mp3"}, LyricURL: Lyric{Txt: "d.txt"}},
+		},
+	})
+	writeTestFile(t, os.Getenv("MEDIA_ROOT"), "metadata.json", metadata)
+
+	// Misses only search local songs, the refreshed cache of msg also holds the provider's
+	tests := []struct {
+		filters string
+		miss    []string
+		hit     []string
+	}{
+		{"", []string{"Rain A", "Rain B", "Rain C", "Rain D"}, []string{"Rain A", "Rain B", "Rain C", "Rain D", "Rain E"}},
+		{"singer=alice", []string{"Rain A", "Rain B"}, []string{"Rain A", "Rain B", "Rain E"}},
+		{"album=spring", []string{"Rain A", "Rain C"}, []string{"Rain A", "Rain C", "Rain E"}},
+		{"singer=alice&album=spring", []string{"Rain A"}, []string{"Rain A", "Rain E"}},
+		{"has_lyrics=1", []string{"Rain A", "Rain D"}, []string{"Rain A", "Rain D", "Rain E"}},
+		{"quality=lossless", []string{"Rain A", "Rain C"}, []string{"Rain A", "Rain C", "Rain E"}},
+		{"quality=standard&has_lyrics=1", []string{"Rain A"}, []string{"Rain A", "Rain E"}},
+		{"singer=bob&album=summer&has_lyrics=1&quality=audition", []string{"Rain D"}, []string{"Rain D"}},
+		{"source=local&singer=alice", []string{"Rain A", "Rain B"}, []string{"Rain A", "Rain B"}},
+		{"source=filters", nil, []string{"Rain E"}},
+		{"source=filters&has_lyrics=1&quality=hires", nil, nil},
+		{"num=2", []string{"Rain B"}, []string{"Rain B"}},
+		{"num=2&singer=alice", []string{"Rain B"}, []string{"Rain B"}},
+		{"num=3&singer=alice", nil, nil},
+		{"num=5&source=filters", nil, []string{"Rain E"}},
+	}
+	for _, test := range tests {
+		// Every filter shares the cache of msg, it is emptied so each one starts with a miss
+		apiCache.purge()
+		if err := os.RemoveAll(os.Getenv("CACHE_DIR")); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range [][]string{test.miss, test.hit} {
+			response, songs := apiTestRequest(t, "/api?msg=Rain&"+test.filters)
+			var names []string
+			for _, song := range songs {
+				names = append(names, song.Song)
+			}
+			if !reflect.DeepEqual(names, want) || response.Total != len(want) {
+				t.Errorf("%q (cache %s): got %v with total %d, want %v", test.filters, response.Cache, names, response.Total, want)
+			}
+			if len(want) == 0 && response.Code != 3 {
+				t.Errorf("%q: got code %d without songs, want 3", test.filters, response.Code)
+			}
+		}
+	}
+
+	for _, param := range []string{"num=x", "has_lyrics=maybe", "quality=ultra"} {
+		response, _ := apiTestRequest(t, "/api?msg=Rain&"+param)
+		name, _, _ := strings.Cut(param, "=")
+		if response.Code != 2 || !strings.Contains(response.Msg, "'"+name+"'") {
+			t.Errorf("%q: got code %d %q, want code 2 naming the parameter", param, response.Code, response.Msg)
+		}
+	}
+}
@@ -2,4 +2,7 @@ module MeowMusic-Server
 
 go 1.25.0
 
-require github.com/joho/godotenv v1.5.1
+require (
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/text v0.41.0
+)
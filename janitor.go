@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Age after which a temporary cache file is left over from a write that crashed rather than one in progress.
+const staleTempFileAge = 10 * time.Minute
+
+// What one sweep of the cache janitor removed.
+type janitorSummary struct {
+	Scanned        int       `json:"scanned"`
+	Expired        int       `json:"expired"`
+	Evicted        int       `json:"evicted"`
+	Orphaned       int       `json:"orphaned"` // Temporary files of crashed writes
+	FreedBytes     int64     `json:"freed_bytes"`
+	RemainingBytes int64     `json:"remaining_bytes"`
+	FinishedAt     time.Time `json:"finished_at"`
+}
+
+// Periodically deletes expired cache files and keeps ./cache under CACHE_MAX_SIZE.
+type cacheJanitor struct {
+	cacheDir string
+	interval time.Duration
+	maxSize  int64
+
+	mu     sync.Mutex
+	last   janitorSummary
+	totals janitorSummary
+	sweeps int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// cacheJanitorInterval function: Return the time between two sweeps, set by CACHE_JANITOR_INTERVAL in seconds
+func cacheJanitorInterval() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("CACHE_JANITOR_INTERVAL"))
+	if err != nil || seconds <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// cacheMaxSize function: Return the maximum total size of the cache files, set by CACHE_MAX_SIZE in megabytes, 0 is unlimited
+func cacheMaxSize() int64 {
+	megabytes, err := strconv.Atoi(os.Getenv("CACHE_MAX_SIZE"))
+	if err != nil || megabytes < 0 {
+		return 256 << 20
+	}
+	return int64(megabytes) << 20
+}
+
+// newCacheJanitor function: Create a janitor for a cache directory, run starts it
+func newCacheJanitor(cacheDir string, interval time.Duration, maxSize int64) *cacheJanitor {
+	return &cacheJanitor{
+		cacheDir: cacheDir,
+		interval: interval,
+		maxSize:  maxSize,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// startCacheJanitor function: Sweep the cache in the background until the janitor is closed
+func startCacheJanitor() *cacheJanitor {
+	janitor := newCacheJanitor(cacheDirPath(), cacheJanitorInterval(), cacheMaxSize())
+	go janitor.run()
+	return janitor
+}
+
+// run function: Sweep once at start and then every interval
+func (janitor *cacheJanitor) run() {
+	defer close(janitor.done)
+	ticker := time.NewTicker(janitor.interval)
+	defer ticker.Stop()
+	for {
+		janitor.sweep()
+		select {
+		case <-janitor.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// close function: Stop the janitor and wait for a running sweep to finish
+func (janitor *cacheJanitor) close() {
+	close(janitor.stop)
+	<-janitor.done
+}
+
+// sweep function: Delete expired cache files, then the oldest ones until the cache fits in maxSize
+func (janitor *cacheJanitor) sweep() janitorSummary {
+	var summary janitorSummary
+	entries, err := os.ReadDir(janitor.cacheDir)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error reading cache directory: ", err)
+	}
+
+	type cachedFile struct {
+		name     string
+		size     int64
+		cachedAt time.Time
+	}
+	var files []cachedFile
+	var deleted []string
+	remove := func(name string, size int64) bool {
+		path := filepath.Join(janitor.cacheDir, name)
+		apiCache.remove(path)
+		if err := os.Remove(path); err != nil {
+			fmt.Println("Error deleting cache file: ", path, err)
+			return false
+		}
+		deleted = append(deleted, name)
+		summary.FreedBytes += size
+		return true
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		name := entry.Name()
+		if orphaned, _ := filepath.Match(cacheTempPattern, name); orphaned && !entry.IsDir() {
+			if info, err := entry.Info(); err == nil && now.Sub(info.ModTime()) > staleTempFileAge {
+				path := filepath.Join(janitor.cacheDir, name)
+				if err := os.Remove(path); err != nil {
+					fmt.Println("Error deleting temporary cache file: ", path, err)
+				} else {
+					summary.Orphaned++
+					summary.FreedBytes += info.Size()
+				}
+			}
+			continue
+		}
+		if entry.IsDir() || !isCacheDataFile(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		summary.Scanned++
+
+		// Only the timestamp is kept, the whole file is still read and decoded
+		var cacheData struct {
+			Timestamp string `json:"timestamp"`
+		}
+		fileContent, err := os.ReadFile(filepath.Join(janitor.cacheDir, name))
+		if err == nil {
+			err = json.Unmarshal(fileContent, &cacheData)
+		}
+		if err != nil || cacheExpired(cacheData.Timestamp, now) {
+			if remove(name, info.Size()) {
+				summary.Expired++
+			}
+			continue
+		}
+		cachedAt, _ := time.Parse(time.RFC3339, cacheData.Timestamp)
+		files = append(files, cachedFile{name: name, size: info.Size(), cachedAt: cachedAt})
+		summary.RemainingBytes += info.Size()
+	}
+
+	// Oldest first until the remaining files fit
+	if janitor.maxSize > 0 && summary.RemainingBytes > janitor.maxSize {
+		sort.Slice(files, func(i, j int) bool { return files[i].cachedAt.Before(files[j].cachedAt) })
+		for _, file := range files {
+			if summary.RemainingBytes <= janitor.maxSize {
+				break
+			}
+			if remove(file.name, file.size) {
+				summary.Evicted++
+				summary.RemainingBytes -= file.size
+			}
+		}
+	}
+	forgetCacheFiles(janitor.cacheDir, deleted...)
+	summary.FinishedAt = time.Now()
+
+	janitor.mu.Lock()
+	janitor.last = summary
+	janitor.sweeps++
+	janitor.totals.Scanned += summary.Scanned
+	janitor.totals.Expired += summary.Expired
+	janitor.totals.Evicted += summary.Evicted
+	janitor.totals.Orphaned += summary.Orphaned
+	janitor.totals.FreedBytes += summary.FreedBytes
+	janitor.totals.RemainingBytes = summary.RemainingBytes
+	janitor.totals.FinishedAt = summary.FinishedAt
+	janitor.mu.Unlock()
+
+	if summary.Expired > 0 || summary.Evicted > 0 || summary.Orphaned > 0 {
+		fmt.Printf("Cache janitor: %d files scanned, %d expired and %d evicted, %d temporary files removed, %d bytes freed, %d bytes remaining.\n",
+			summary.Scanned, summary.Expired, summary.Evicted, summary.Orphaned, summary.FreedBytes, summary.RemainingBytes)
+	}
+	return summary
+}
+
+// snapshot function: Return the last sweep, the totals since start and the number of sweeps
+func (janitor *cacheJanitor) snapshot() (janitorSummary, janitorSummary, int) {
+	janitor.mu.Lock()
+	defer janitor.mu.Unlock()
+	return janitor.last, janitor.totals, janitor.sweeps
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCacheJanitorSweep Test that the janitor deletes expired files, then the oldest ones over the size limit
+func TestCacheJanitorSweep(t *testing.T) {
+	t.Setenv("API_CACHE_TIME", "24")
+	cacheDir := t.TempDir()
+	songs := []Song{{Song: strings.Repeat("a", 1000)}}
+	at := func(age time.Duration) string { return time.Now().Add(-age).Format(time.RFC3339) }
+	writeCacheFile(filepath.Join(cacheDir, "expired.json"), songs, at(25*time.Hour))
+	writeCacheFile(filepath.Join(cacheDir, "old.json"), songs, at(3*time.Hour))
+	writeCacheFile(filepath.Join(cacheDir, "middle.json"), songs, at(2*time.Hour))
+	writeCacheFile(filepath.Join(cacheDir, "new.json"), songs, at(time.Hour))
+	writeTestFile(t, cacheDir, "broken.json", []byte("{"))
+	writeTestFile(t, cacheDir, "embedded.json", []byte("{}"))
+	// Temporary files of a crashed write are removed once they are old, a write may be in progress otherwise
+	stale := writeTestFile(t, cacheDir, ".tmp-stale.json", []byte("{\"songs\":["))
+	os.Chtimes(stale, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+	writeTestFile(t, cacheDir, ".tmp-writing.json", []byte("{\"songs\":["))
+	info, err := os.Stat(filepath.Join(cacheDir, "new.json"))
+	if err != nil {
+		t.Fatalf("Cannot stat cache file: %s", err)
+	}
+
+	// Room for two of the three valid files
+	janitor := newCacheJanitor(cacheDir, time.Hour, 2*info.Size())
+	summary := janitor.sweep()
+	if summary.Scanned != 5 || summary.Expired != 2 || summary.Evicted != 1 || summary.Orphaned != 1 || summary.RemainingBytes != 2*info.Size() {
+		t.Errorf("Unexpected sweep summary: %+v", summary)
+	}
+	for name, want := range map[string]bool{"expired.json": false, "broken.json": false, "old.json": false, "middle.json": true, "new.json": true, "embedded.json": true, ".tmp-stale.json": false, ".tmp-writing.json": true} {
+		_, err := os.Stat(filepath.Join(cacheDir, name))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s exists: %v, want %v", name, exists, want)
+		}
+	}
+	if _, totals, sweeps := janitor.snapshot(); sweeps != 1 || totals.Evicted != 1 {
+		t.Errorf("Unexpected janitor totals: %+v after %d sweeps", totals, sweeps)
+	}
+}
+
+// TestCacheJanitorClose Test that the janitor sweeps at start and stops when closed
+func TestCacheJanitorClose(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCacheFile(filepath.Join(cacheDir, "expired.json"), []Song{}, "")
+	janitor := newCacheJanitor(cacheDir, time.Hour, 0)
+	go janitor.run()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, _, sweeps := janitor.snapshot(); sweeps > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("The janitor did not sweep at start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	janitor.close()
+	if _, err := os.Stat(filepath.Join(cacheDir, "expired.json")); !os.IsNotExist(err) {
+		t.Errorf("Expired cache file should be deleted")
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Songs found in one directory of the media root, with the signature they were scanned at.
+type libraryFolder struct {
+	Signature uint64       `json:"signature"`
+	Songs     []Song       `json:"songs"`
+	Pinyin    []songPinyin `json:"-"` // Pinyin of Songs, rebuilt when loaded so the table can change
+}
+
+// A local song with its search forms.
+type librarySong struct {
+	song   Song
+	pinyin songPinyin
+}
+
+// On-disk form of the library index.
+type libraryIndexFile struct {
+	Root    string                    `json:"root"`
+	HomeURL string                    `json:"home_url"`
+	Folders map[string]*libraryFolder `json:"folders"`
+}
+
+// Library index, answers local searches from memory and is refreshed incrementally.
+type libraryIndex struct {
+	mu              sync.RWMutex
+	root            string
+	homeURL         string
+	folders         map[string]*libraryFolder
+	order           []string
+	refreshed       bool
+	metadata        *Metadata
+	metadataErr     error
+	metadataModTime time.Time
+	metadataPath    string
+	refreshMu       sync.Mutex
+}
+
+// The library index used by the handlers.
+var library = newLibraryIndex()
+
+// newLibraryIndex function: Create an empty library index
+func newLibraryIndex() *libraryIndex {
+	return &libraryIndex{folders: map[string]*libraryFolder{}}
+}
+
+// libraryIndexPath function: Return the file the index is persisted to, set by LIBRARY_INDEX_PATH
+func libraryIndexPath() string {
+	if path := os.Getenv("LIBRARY_INDEX_PATH"); path != "" {
+		return path
+	}
+	return "./library-index.json"
+}
+
+// libraryScanInterval function: Return the interval between incremental refreshes, set by LIBRARY_SCAN_INTERVAL in seconds
+func libraryScanInterval() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("LIBRARY_SCAN_INTERVAL"))
+	if err != nil || seconds <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// load function: Read a previously saved index so the first refresh only rescans what changed
+func (index *libraryIndex) load(path string) error {
+	fileContent, err := GetFileContent(path)
+	if err != nil {
+		return err
+	}
+	var indexFile libraryIndexFile
+	if err := json.Unmarshal(fileContent, &indexFile); err != nil {
+		return err
+	}
+	if indexFile.Folders == nil {
+		indexFile.Folders = map[string]*libraryFolder{}
+	}
+	for _, folder := range indexFile.Folders {
+		for i := range folder.Songs {
+			typedSongFields(&folder.Songs[i])
+			// Indexes saved before songs had IDs, or with derived lyric URLs, are rescanned by the next refresh
+			lyric, _ := folder.Songs[i].Lyric.(Lyric)
+			if folder.Songs[i].ID == "" || hasDerivedLyrics(lyric) {
+				folder.Signature = 0
+			}
+		}
+		folder.indexPinyin()
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.root = indexFile.Root
+	index.homeURL = indexFile.HomeURL
+	index.folders = indexFile.Folders
+	index.order = sortedFolderKeys(index.folders)
+	return nil
+}
+
+// save function: Write the index atomically to disk
+func (index *libraryIndex) save(path string) error {
+	index.mu.RLock()
+	indexFile := libraryIndexFile{Root: index.root, HomeURL: index.homeURL, Folders: index.folders}
+	fileContent, err := json.Marshal(indexFile)
+	index.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, fileContent, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// refresh function: Rescan the directories whose signature changed and drop the ones that disappeared
+func (index *libraryIndex) refresh() (int, error) {
+	_, changed, err := index.refreshSongs()
+	return changed, err
+}
+
+// refreshSongs function: Refresh the index and return the songs that were added, removed or rescanned
+func (index *libraryIndex) refreshSongs() ([]Song, int, error) {
+	index.refreshMu.Lock()
+	defer index.refreshMu.Unlock()
+
+	root := mediaRoot()
+	homeURL := os.Getenv("HOME_URL")
+	if _, err := os.Stat(root); err != nil {
+		index.mu.Lock()
+		index.root, index.homeURL, index.refreshed = root, homeURL, true
+		removed := index.folders
+		index.folders, index.order = map[string]*libraryFolder{}, nil
+		index.mu.Unlock()
+		var songs []Song
+		for _, folder := range removed {
+			songs = append(songs, folder.Songs...)
+		}
+		return songs, len(removed), err
+	}
+
+	// URLs are stored in the index, so another root or HOME_URL means a full rebuild
+	index.mu.RLock()
+	oldFolders := index.folders
+	if index.root != root || index.homeURL != homeURL {
+		oldFolders = map[string]*libraryFolder{}
+	}
+	index.mu.RUnlock()
+
+	changed := 0
+	var changedSongs []Song
+	newFolders := map[string]*libraryFolder{}
+	walkLibraryDirs(root, func(relDir string, entries []os.DirEntry) {
+		signature := folderSignature(filepath.Join(root, relDir), entries)
+		if old, ok := oldFolders[relDir]; ok && old.Signature == signature {
+			newFolders[relDir] = old
+			return
+		}
+		changed++
+		var songs []Song
+		for _, folder := range scanFolder(root, relDir, entries) {
+			songs = append(songs, folderToSong(folder))
+		}
+		newFolders[relDir] = &libraryFolder{Signature: signature, Songs: songs}
+		newFolders[relDir].indexPinyin()
+		changedSongs = append(changedSongs, songs...)
+		if old, ok := oldFolders[relDir]; ok {
+			changedSongs = append(changedSongs, old.Songs...)
+		}
+	})
+	for relDir, old := range oldFolders {
+		if _, ok := newFolders[relDir]; !ok {
+			changed++
+			changedSongs = append(changedSongs, old.Songs...)
+		}
+	}
+
+	index.mu.Lock()
+	index.root, index.homeURL, index.refreshed = root, homeURL, true
+	index.folders = newFolders
+	index.order = sortedFolderKeys(newFolders)
+	index.mu.Unlock()
+	return changedSongs, changed, nil
+}
+
+// folderSignature function: Hash the names, sizes and modification times of a directory's files
+func folderSignature(path string, entries []os.DirEntry) uint64 {
+	hash := fnv.New64a()
+	if dirInfo, err := os.Stat(path); err == nil {
+		fmt.Fprintf(hash, "%d\n", dirInfo.ModTime().UnixNano())
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(hash, "%s|%d|%d\n", entry.Name(), fileInfo.Size(), fileInfo.ModTime().UnixNano())
+	}
+	return hash.Sum64()
+}
+
+// sortedFolderKeys function: Return the folder keys in a stable order
+func sortedFolderKeys(folders map[string]*libraryFolder) []string {
+	keys := make([]string, 0, len(folders))
+	for key := range folders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// songs function: Return every local song of the index, building it on first use
+func (index *libraryIndex) songs() []Song {
+	var songs []Song
+	for _, entry := range index.entries() {
+		songs = append(songs, entry.song)
+	}
+	return songs
+}
+
+// entries function: Return every local song of the index with its search forms, building it on first use
+func (index *libraryIndex) entries() []librarySong {
+	index.mu.RLock()
+	refreshed := index.refreshed && index.root == mediaRoot()
+	index.mu.RUnlock()
+	if !refreshed {
+		if _, err := index.refresh(); err != nil {
+			fmt.Println("Error refreshing library index: ", err)
+		}
+	}
+
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	var entries []librarySong
+	for _, key := range index.order {
+		folder := index.folders[key]
+		for i, song := range folder.Songs {
+			entries = append(entries, librarySong{song: song, pinyin: folder.Pinyin[i]})
+		}
+	}
+	return entries
+}
+
+// indexPinyin function: Spell the songs of a folder in pinyin
+func (folder *libraryFolder) indexPinyin() {
+	folder.Pinyin = make([]songPinyin, len(folder.Songs))
+	for i, song := range folder.Songs {
+		folder.Pinyin[i] = pinyinOfSong(song)
+	}
+}
+
+// getMetadata function: Return metadata.json, only re-reading it when it was modified
+func (index *libraryIndex) getMetadata() (*Metadata, error) {
+	metadataFilePath := filepath.Join(mediaRoot(), "metadata.json")
+	fileInfo, err := os.Stat(metadataFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	index.mu.RLock()
+	if (index.metadata != nil || index.metadataErr != nil) && index.metadataPath == metadataFilePath && fileInfo.ModTime().Equal(index.metadataModTime) {
+		defer index.mu.RUnlock()
+		return index.metadata, index.metadataErr
+	}
+	index.mu.RUnlock()
+
+	metadata, err := readMetadataFile(metadataFilePath)
+	index.mu.Lock()
+	index.metadata, index.metadataErr = metadata, err
+	index.metadataModTime, index.metadataPath = fileInfo.ModTime(), metadataFilePath
+	index.mu.Unlock()
+	return metadata, err
+}
+
+// startLibraryIndex function: Load the saved index and refresh it, the watcher keeps it up to date afterwards
+func startLibraryIndex() {
+	path := libraryIndexPath()
+	if err := library.load(path); err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error loading library index: ", err)
+	}
+	changed, err := library.refresh()
+	if err != nil {
+		fmt.Println("Error refreshing library index: ", err)
+		return
+	}
+	if changed > 0 {
+		fmt.Printf("Library index updated, %d folders changed.\n", changed)
+		if err := library.save(path); err != nil {
+			fmt.Println("Error saving library index: ", err)
+		}
+	}
+}
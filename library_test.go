@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLibraryIndexRefresh Test the incremental refresh of the library index
+func TestLibraryIndexRefresh(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("MEDIA_ROOT", root)
+	t.Setenv("HOME_URL", "http://music.example")
+	writeTestFile(t, root, "Singer-Song@Album/standard.mp3", []byte("audio"))
+	writeTestFile(t, root, "Singer-Song@Album/lyric.lrc", []byte("[00:00.00]la"))
+	writeTestFile(t, root, "Other-Tune@Record/cover.png", []byte("png"))
+
+	index := newLibraryIndex()
+	changed, err := index.refresh()
+	if err != nil {
+		t.Fatalf("refresh returns error: %s", err)
+	}
+	if changed != 3 {
+		t.Errorf("Expected 3 changed folders on the first refresh, got %d", changed)
+	}
+
+	songs := index.songs()
+	if len(songs) != 2 {
+		t.Fatalf("Expected 2 songs, got %d", len(songs))
+	}
+	song := songs[1]
+	musicURL := song.MusicURL.(MusicURL)
+	if song.Song != "Song" || musicURL.Standard != "http://music.example/file/Singer-Song@Album/standard.mp3" || musicURL.Lossless != "" {
+		t.Errorf("Unexpected song: %+v", song)
+	}
+	if lyric := song.Lyric.(Lyric); lyric.Lrc == "" || lyric.Mrc != "" {
+		t.Errorf("Unexpected lyric: %+v", lyric)
+	}
+	if songs[0].Cover != "http://music.example/file/Other-Tune@Record/cover.png" {
+		t.Errorf("Unexpected cover: %s", songs[0].Cover)
+	}
+
+	// Nothing changed, nothing is rescanned
+	changed, err = index.refresh()
+	if err != nil || changed != 0 {
+		t.Errorf("Expected no changes, got %d (%v)", changed, err)
+	}
+
+	// Adding a file only rescans its folder, removing a folder drops its songs
+	later := time.Now().Add(time.Minute)
+	writeTestFile(t, root, "Singer-Song@Album/lossless.flac", []byte("audio"))
+	os.Chtimes(filepath.Join(root, "Singer-Song@Album"), later, later)
+	if err := os.RemoveAll(filepath.Join(root, "Other-Tune@Record")); err != nil {
+		t.Fatalf("Cannot remove folder: %s", err)
+	}
+	changed, err = index.refresh()
+	if err != nil {
+		t.Fatalf("refresh returns error: %s", err)
+	}
+	if changed != 3 { // root, the modified folder and the removed folder
+		t.Errorf("Expected 3 changed folders, got %d", changed)
+	}
+	songs = index.songs()
+	if len(songs) != 1 || songs[0].MusicURL.(MusicURL).Lossless == "" {
+		t.Errorf("Unexpected songs after refresh: %+v", songs)
+	}
+}
+
+// TestLibraryIndexSaveLoad Test that a saved index is reused after a restart
+func TestLibraryIndexSaveLoad(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("MEDIA_ROOT", root)
+	writeTestFile(t, root, "Singer-Song@Album/standard.mp3", []byte("audio"))
+	indexPath := filepath.Join(t.TempDir(), "index", "library.json")
+
+	index := newLibraryIndex()
+	if _, err := index.refresh(); err != nil {
+		t.Fatalf("refresh returns error: %s", err)
+	}
+	if err := index.save(indexPath); err != nil {
+		t.Fatalf("save returns error: %s", err)
+	}
+
+	loaded := newLibraryIndex()
+	if err := loaded.load(indexPath); err != nil {
+		t.Fatalf("load returns error: %s", err)
+	}
+	changed, err := loaded.refresh()
+	if err != nil || changed != 0 {
+		t.Errorf("Expected the loaded index to be up to date, got %d changes (%v)", changed, err)
+	}
+	songs := loaded.songs()
+	if len(songs) != 1 || songs[0].Singer != "Singer" {
+		t.Fatalf("Unexpected songs: %+v", songs)
+	}
+	if _, ok := songs[0].MusicURL.(MusicURL); !ok {
+		t.Errorf("Expected MusicURL to be decoded as MusicURL, got %T", songs[0].MusicURL)
+	}
+}
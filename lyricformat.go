@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// How long the last cue of WebVTT and SRT lyrics stays on screen, in milliseconds.
+const lastCueDuration = 5000
+
+// Lyric formats in the order of the Lyric fields.
+var lyricFormats = []string{"mrc", "lrc", "txt", "vtt", "srt"}
+
+// Content types of the lyric formats, WebVTT and SRT are the ones HTML5 <track> elements load.
+var lyricContentTypes = map[string]string{
+	"mrc": "text/plain; charset=utf-8",
+	"lrc": "text/plain; charset=utf-8",
+	"txt": "text/plain; charset=utf-8",
+	"vtt": "text/vtt; charset=utf-8",
+	"srt": "application/x-subrip; charset=utf-8",
+}
+
+// Derives the lyric format To from the format From.
+type lyricConversion struct {
+	From    string
+	To      string
+	Convert func(content string) string
+}
+
+// The conversions between lyric formats, a format missing from a song is derived through as many of them as needed.
+var lyricConversions = []lyricConversion{
+	{From: "mrc", To: "lrc", Convert: mrcToLRC},
+	{From: "lrc", To: "txt", Convert: lrcToTXT},
+	{From: "lrc", To: "vtt", Convert: lrcToWebVTT},
+	{From: "lrc", To: "srt", Convert: lrcToSRT},
+}
+
+// One subtitle of WebVTT and SRT lyrics.
+type lyricCue struct {
+	Start int
+	End   int
+	Text  string
+}
+
+var (
+	mrcLine       = regexp.MustCompile(`^\[(\d+),(\d+)\](.*)$`)
+	mrcWord       = regexp.MustCompile(`([^()]*)\((\d+),(\d+)\)`)  // word(start,duration), absolute
+	mrcOffsetWord = regexp.MustCompile(`<(\d+),(\d+),\d+>([^<]*)`) // <offset,duration,0>word, from the line start
+)
+
+// url function: Return the field of a lyric format, nil for unknown formats
+func (lyric *Lyric) url(format string) *string {
+	switch format {
+	case "mrc":
+		return &lyric.Mrc
+	case "lrc":
+		return &lyric.Lrc
+	case "txt":
+		return &lyric.Txt
+	case "vtt":
+		return &lyric.Vtt
+	case "srt":
+		return &lyric.Srt
+	}
+	return nil
+}
+
+// derivedLyricURL function: Return the URL a lyric format of a song is converted at
+func derivedLyricURL(id string, format string) string {
+	return os.Getenv("HOME_URL") + "/lyric/" + id + "." + format
+}
+
+// Helper function to report whether a lyric URL is served by lyricHandler rather than a file
+func isDerivedLyricURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, os.Getenv("HOME_URL")+"/lyric/")
+}
+
+// hasDerivedLyrics function: Report whether a lyric lists a URL served by lyricHandler
+func hasDerivedLyrics(lyric Lyric) bool {
+	for _, format := range lyricFormats {
+		if isDerivedLyricURL(*lyric.url(format)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function to report whether a lyric format can be derived from the formats a song has
+func canDeriveLyric(format string, has func(format string) bool) bool {
+	if has(format) {
+		return true
+	}
+	for _, conversion := range lyricConversions {
+		if conversion.To == format && canDeriveLyric(conversion.From, has) {
+			return true
+		}
+	}
+	return false
+}
+
+// withDerivedLyrics function: Fill in the URLs of the lyric formats a song lacks but can be converted to
+func withDerivedLyrics(id string, lyric Lyric) Lyric {
+	if id == "" {
+		return lyric
+	}
+	native := lyric
+	has := func(format string) bool {
+		url := *native.url(format)
+		return url != "" && !isDerivedLyricURL(url)
+	}
+	for _, format := range lyricFormats {
+		if !has(format) && canDeriveLyric(format, has) {
+			*lyric.url(format) = derivedLyricURL(id, format)
+		}
+	}
+	return lyric
+}
+
+// deriveLyric function: Return a lyric format, read from its own file or converted from another format
+func deriveLyric(format string, read func(format string) (string, error)) (string, error) {
+	content, err := read(format)
+	if !errors.Is(err, errNoLyrics) {
+		return content, err
+	}
+	for _, conversion := range lyricConversions {
+		if conversion.To != format {
+			continue
+		}
+		source, err := deriveLyric(conversion.From, read)
+		if errors.Is(err, errNoLyrics) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return conversion.Convert(source), nil
+	}
+	return "", errNoLyrics
+}
+
+// Helper function to format milliseconds as an LRC timestamp
+func lrcTime(ms int) string {
+	return fmt.Sprintf("%02d:%02d.%02d", ms/60000, ms/1000%60, ms%1000/10)
+}
+
+// Helper function to format milliseconds as a WebVTT or SRT timestamp, SRT separates the milliseconds with a comma
+func cueTime(ms int, separator string) string {
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
+
+// mrcToLRC function: Convert MRC word timing to enhanced LRC, lines are "[start,duration]" followed by "word(start,duration)" or "<offset,duration,0>word"
+func mrcToLRC(content string) string {
+	var lrc strings.Builder
+	for _, line := range strings.Split(strings.TrimPrefix(content, "\uFEFF"), "\n") {
+		line = strings.TrimSpace(line)
+		match := mrcLine.FindStringSubmatch(line)
+		if match == nil {
+			// ID tags like [ti:] are the same in both formats
+			if lrcTag.MatchString(line) {
+				lrc.WriteString(line + "\n")
+			}
+			continue
+		}
+		start, _ := strconv.Atoi(match[1])
+		duration, _ := strconv.Atoi(match[2])
+		text := match[3]
+		lrc.WriteString("[" + lrcTime(start) + "]")
+		offsetWords, words := mrcOffsetWord.FindAllStringSubmatch(text, -1), mrcWord.FindAllStringSubmatch(text, -1)
+		switch {
+		case strings.HasPrefix(text, "<") && offsetWords != nil:
+			for _, word := range offsetWords {
+				offset, _ := strconv.Atoi(word[1])
+				lrc.WriteString("<" + lrcTime(start+offset) + ">" + word[3])
+			}
+		case words != nil:
+			for _, word := range words {
+				wordStart, _ := strconv.Atoi(word[2])
+				lrc.WriteString("<" + lrcTime(wordStart) + ">" + word[1])
+			}
+		default:
+			lrc.WriteString(strings.TrimSpace(text) + "\n")
+			continue
+		}
+		lrc.WriteString("<" + lrcTime(start+duration) + ">\n")
+	}
+	return lrc.String()
+}
+
+// lrcToTXT function: Convert LRC to plain text, one line per timestamp
+func lrcToTXT(content string) string {
+	var txt strings.Builder
+	for _, line := range parseLRC(content).Lines {
+		if line.Text != "" {
+			txt.WriteString(line.Text + "\n")
+		}
+	}
+	return txt.String()
+}
+
+// lrcCues function: Turn the lines of LRC lyrics into cues lasting until the next line, lines of the same time share a cue
+func lrcCues(content string) []lyricCue {
+	lyrics := parseLRC(content)
+	if !lyrics.Synced {
+		return nil
+	}
+	var cues []lyricCue
+	for i, line := range lyrics.Lines {
+		if line.Text == "" {
+			continue
+		}
+		if len(cues) > 0 && cues[len(cues)-1].Start == line.Time {
+			cues[len(cues)-1].Text += "\n" + line.Text
+			continue
+		}
+		end := line.Time + lastCueDuration
+		for _, next := range lyrics.Lines[i+1:] {
+			if next.Time > line.Time {
+				end = next.Time
+				break
+			}
+		}
+		cues = append(cues, lyricCue{Start: line.Time, End: end, Text: line.Text})
+	}
+	return cues
+}
+
+// lrcToWebVTT function: Convert LRC to WebVTT subtitles
+func lrcToWebVTT(content string) string {
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+	for i, cue := range lrcCues(content) {
+		fmt.Fprintf(&vtt, "\n%d\n%s --> %s\n%s\n", i+1, cueTime(cue.Start, "."), cueTime(cue.End, "."), cue.Text)
+	}
+	return vtt.String()
+}
+
+// lrcToSRT function: Convert LRC to SRT subtitles
+func lrcToSRT(content string) string {
+	var srt strings.Builder
+	for i, cue := range lrcCues(content) {
+		if i > 0 {
+			srt.WriteString("\n")
+		}
+		fmt.Fprintf(&srt, "%d\n%s --> %s\n%s\n", i+1, cueTime(cue.Start, ","), cueTime(cue.End, ","), cue.Text)
+	}
+	return srt.String()
+}
+
+// lyricReader function: Return a reader of the lyric files a song has, derived URLs count as missing
+func lyricReader(ctx context.Context, lyric Lyric) func(format string) (string, error) {
+	return func(format string) (string, error) {
+		url := lyric.url(format)
+		if url == nil || *url == "" || isDerivedLyricURL(*url) {
+			return "", errNoLyrics
+		}
+		return readLyricFile(ctx, *url)
+	}
+}
+
+// lyricHandler function: Serve a lyric format of a song at /lyric/{id}.{format}, converted from the formats it has
+func lyricHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", "MeowMusicServer")
+	id, format, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/lyric/"), ".")
+	contentType, ok := lyricContentTypes[format]
+	if !ok || !isSongID(id) {
+		NotFoundHandler(w, r)
+		return
+	}
+	song, found := findSong(id)
+	if !found {
+		NotFoundHandler(w, r)
+		return
+	}
+	lyric, _ := resolveSong(r.Context(), song).Lyric.(Lyric)
+	content, err := deriveLyric(format, lyricReader(r.Context(), lyric))
+	if errors.Is(err, errNoLyrics) {
+		NotFoundHandler(w, r)
+		return
+	}
+	if err != nil {
+		fmt.Println("Error reading lyrics: ", id, err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Access-Control-Allow-Origin", "*") // <track> elements of other sites load subtitles with CORS
+	fmt.Fprint(w, content)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestMRCToLRC Test absolute and line relative word timing, plain lines and tags
+func TestMRCToLRC(t *testing.T) {
+	mrc := "[ti:Rain]\n" +
+		"[1000,2000]Hel(1000,300)lo (1300,500)world(1800,1200)\n" +
+		"[3500,1500]<0,500,0>Rain <500,1000,0>falls\n" +
+		"[6000,1000]Plain line\n" +
+		"not a line\n"
+	want := "[ti:Rain]\n" +
+		"[00:01.00]<00:01.00>Hel<00:01.30>lo <00:01.80>world<00:03.00>\n" +
+		"[00:03.50]<00:03.50>Rain <00:04.00>falls<00:05.00>\n" +
+		"[00:06.00]Plain line\n"
+	if lrc := mrcToLRC(mrc); lrc != want {
+		t.Errorf("mrcToLRC returned\n%s\nwant\n%s", lrc, want)
+	}
+	if lines := parseLRC(mrcToLRC(mrc)).Lines; len(lines) != 3 || lines[0].Text != "Hello world" || lines[1].Time != 3500 {
+		t.Errorf("Converted lyrics should parse without the word timing: %+v", lines)
+	}
+}
+
+// TestLRCConversions Test LRC to TXT, WebVTT and SRT, lines of the same time share a cue
+func TestLRCConversions(t *testing.T) {
+	lrc := "[ar:Alice]\n[00:01.00]Rain\n[00:01.00]雨\n[00:03.50]falls\n[00:05.00]\n[00:06.00]down"
+	if txt := lrcToTXT(lrc); txt != "Rain\n雨\nfalls\ndown\n" {
+		t.Errorf("Unexpected TXT %q", txt)
+	}
+	wantVTT := "WEBVTT\n\n" +
+		"1\n00:00:01.000 --> 00:00:03.500\nRain\n雨\n\n" +
+		"2\n00:00:03.500 --> 00:00:05.000\nfalls\n\n" +
+		"3\n00:00:06.000 --> 00:00:11.000\ndown\n"
+	if vtt := lrcToWebVTT(lrc); vtt != wantVTT {
+		t.Errorf("lrcToWebVTT returned\n%s\nwant\n%s", vtt, wantVTT)
+	}
+	wantSRT := "1\n00:00:01,000 --> 00:00:03,500\nRain\n雨\n\n" +
+		"2\n00:00:03,500 --> 00:00:05,000\nfalls\n\n" +
+		"3\n00:00:06,000 --> 00:00:11,000\ndown\n"
+	if srt := lrcToSRT(lrc); srt != wantSRT {
+		t.Errorf("lrcToSRT returned\n%s\nwant\n%s", srt, wantSRT)
+	}
+	if vtt := lrcToWebVTT("no timing"); vtt != "WEBVTT\n" {
+		t.Errorf("Lyrics without timing have no cues: %q", vtt)
+	}
+}
+
+// TestWithDerivedLyrics Test which formats are advertised from the formats a song has
+func TestWithDerivedLyrics(t *testing.T) {
+	t.Setenv("HOME_URL", "http://music.example")
+	id := "0123456789abcdef"
+	derived := func(format string) string { return "http://music.example/lyric/" + id + "." + format }
+	cases := map[string]struct {
+		lyric Lyric
+		want  Lyric
+	}{
+		"lrc":  {Lyric{Lrc: "a.lrc"}, Lyric{Lrc: "a.lrc", Txt: derived("txt"), Vtt: derived("vtt"), Srt: derived("srt")}},
+		"mrc":  {Lyric{Mrc: "a.mrc"}, Lyric{Mrc: "a.mrc", Lrc: derived("lrc"), Txt: derived("txt"), Vtt: derived("vtt"), Srt: derived("srt")}},
+		"txt":  {Lyric{Txt: "a.txt"}, Lyric{Txt: "a.txt"}},
+		"all":  {Lyric{Lrc: "a.lrc", Txt: "a.txt", Srt: "a.srt"}, Lyric{Lrc: "a.lrc", Txt: "a.txt", Vtt: derived("vtt"), Srt: "a.srt"}},
+		"none": {Lyric{}, Lyric{}},
+	}
+	for name, c := range cases {
+		if got := withDerivedLyrics(id, c.lyric); got != c.want {
+			t.Errorf("%s: got %+v, want %+v", name, got, c.want)
+		}
+		if got := withDerivedLyrics(id, withDerivedLyrics(id, c.lyric)); got != c.want {
+			t.Errorf("%s: deriving twice got %+v", name, got)
+		}
+	}
+	if got := withDerivedLyrics("", Lyric{Lrc: "a.lrc"}); got != (Lyric{Lrc: "a.lrc"}) {
+		t.Errorf("Songs without an ID cannot have derived URLs: %+v", got)
+	}
+}
+
+// TestLyricHandler Test lyric formats served from files and converted on the fly
+func TestLyricHandler(t *testing.T) {
+	setupAPITest(t, 0)
+	t.Setenv("HOME_URL", "http://music.example")
+	root := os.Getenv("MEDIA_ROOT")
+	writeTestFile(t, root, "Alice-Rain@Spring/standard.mp3", []byte("audio"))
+	writeTestFile(t, root, "Alice-Rain@Spring/lyric.mrc", []byte("[1000,2000]Rain(1000,1000)falls(2000,1000)"))
+	writeTestFile(t, root, "Alice-Snow@Winter/standard.mp3", []byte("audio"))
+	writeTestFile(t, root, "Alice-Snow@Winter/lyric.txt", []byte("Snow"))
+	rain, snow := localSongID("Alice-Rain@Spring"), localSongID("Alice-Snow@Winter")
+
+	// The legacy /api keeps its lyric fields, /api/v2 advertises the derived formats
+	_, songs := apiTestRequest(t, "/api?msg=Rain")
+	if len(songs) != 1 || toJSON(songs[0].Lyric) != `{"lrc":"","mrc":"http://music.example/file/Alice-Rain@Spring/lyric.mrc","txt":""}` {
+		t.Fatalf("Legacy search results should not list derived formats: %+v", songs)
+	}
+	rr, body := apiV2TestRequest(t, "GET", "/api/v2/search?q=Rain")
+	if rr.Code != http.StatusOK || !strings.Contains(toJSON(body["data"]), `"vtt":"http://music.example/lyric/`+rain+`.vtt"`) {
+		t.Fatalf("Search results of /api/v2 should advertise the derived formats: %d %v", rr.Code, body)
+	}
+
+	cases := []struct {
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"/lyric/" + rain + ".mrc", http.StatusOK, "text/plain", "[1000,2000]Rain(1000,1000)falls(2000,1000)"},
+		{"/lyric/" + rain + ".lrc", http.StatusOK, "text/plain", "[00:01.00]<00:01.00>Rain<00:02.00>falls<00:03.00>\n"},
+		{"/lyric/" + rain + ".txt", http.StatusOK, "text/plain", "Rainfalls\n"},
+		{"/lyric/" + rain + ".vtt", http.StatusOK, "text/vtt", "WEBVTT\n\n1\n00:00:01.000 --> 00:00:06.000\nRainfalls\n"},
+		{"/lyric/" + rain + ".srt", http.StatusOK, "application/x-subrip", "1\n00:00:01,000 --> 00:00:06,000\nRainfalls\n"},
+		{"/lyric/" + snow + ".txt", http.StatusOK, "text/plain", "Snow"},
+		{"/lyric/" + snow + ".vtt", http.StatusNotFound, "", ""},
+		{"/lyric/" + rain + ".pdf", http.StatusNotFound, "", ""},
+		{"/lyric/" + rain, http.StatusNotFound, "", ""},
+		{"/lyric/0123456789abcdef.lrc", http.StatusNotFound, "", ""},
+		{"/lyric/../Alice-Rain@Spring/lyric.mrc", http.StatusNotFound, "", ""},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		lyricHandler(rr, httptest.NewRequest("GET", c.path, nil))
+		if rr.Code != c.status || (c.status == http.StatusOK && (!strings.HasPrefix(rr.Header().Get("Content-Type"), c.contentType) || rr.Body.String() != c.body)) {
+			t.Errorf("%s: got %d %s %q, want %d %s %q", c.path, rr.Code, rr.Header().Get("Content-Type"), rr.Body.String(), c.status, c.contentType, c.body)
+		}
+	}
+
+	// Parsed lyrics use the converted LRC when a song only has MRC
+	rr, body = apiV2TestRequest(t, "GET", "/api/v2/songs/"+rain+"/lyrics/lines")
+	if rr.Code != http.StatusOK || toJSON(body["data"].(map[string]interface{})["lines"]) != `[{"text":"Rainfalls","time":1000}]` {
+		t.Errorf("Unexpected lines of MRC lyrics: %d %v", rr.Code, body)
+	}
+}
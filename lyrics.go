@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	lyricCacheSize   = 256     // Most upstream lyric files kept by lyricFiles, the oldest are forgotten first
+	maxLyricFileSize = 1 << 20 // Largest upstream lyric file downloaded, in bytes
+)
+
+var errNoLyrics = errors.New("the song has no lyrics")
+
+// One line of synchronised lyrics.
+type lyricLine struct {
+	Time int    `json:"time"` // Milliseconds from the start of the song, offset applied
+	Text string `json:"text"`
+}
+
+// Lyrics parsed from an LRC file, or from a TXT file without timing.
+type parsedLyrics struct {
+	Tags   map[string]string `json:"tags"`   // ID tags like "ar", "ti", "al", "by" and "offset"
+	Offset int               `json:"offset"` // Milliseconds, already applied to the lines
+	Synced bool              `json:"synced"` // false for plain text, every line then has time 0
+	Lines  []lyricLine       `json:"lines"`
+}
+
+// The line of the lyrics shown at a position of the song.
+type lyricPosition struct {
+	Time  int        `json:"time"`  // The position asked for, in milliseconds
+	Index int        `json:"index"` // Index of Line in the lines, -1 before the first one or without timing
+	Line  *lyricLine `json:"line"`
+	Next  *lyricLine `json:"next"`
+}
+
+// Upstream lyric files already downloaded, devices asking for the line at the current time reuse them.
+type lyricCache struct {
+	mu    sync.Mutex
+	files map[string]string
+	order []string
+}
+
+// The cache of upstream lyric files used by the handlers.
+var lyricFiles = &lyricCache{files: map[string]string{}}
+
+var (
+	lrcTimestamp     = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+	lrcTag           = regexp.MustCompile(`^\[([A-Za-z#]+):([^\]]*)\]$`)
+	lrcWordTimestamp = regexp.MustCompile(`<\d+:\d{1,2}(?:[.:]\d{1,3})?>`)
+)
+
+// Helper function to convert the groups of an LRC timestamp to milliseconds
+func lrcMillis(match []string) int {
+	minutes, _ := strconv.Atoi(match[1])
+	seconds, _ := strconv.Atoi(match[2])
+	fraction, _ := strconv.Atoi((match[3] + "000")[:3]) // "5" and "50" are 500 ms
+	return minutes*60000 + seconds*1000 + fraction
+}
+
+// parseLRC function: Parse LRC lyrics, a line with several timestamps is repeated at each of them
+func parseLRC(content string) parsedLyrics {
+	lyrics := parsedLyrics{Tags: map[string]string{}, Lines: []lyricLine{}}
+	var plain []lyricLine
+	for _, line := range strings.Split(strings.TrimPrefix(content, "\uFEFF"), "\n") {
+		line = strings.TrimSpace(line)
+		var times []int
+		for {
+			match := lrcTimestamp.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			times = append(times, lrcMillis(match))
+			line = line[len(match[0]):]
+		}
+		if len(times) == 0 {
+			if match := lrcTag.FindStringSubmatch(line); match != nil {
+				lyrics.Tags[strings.ToLower(match[1])] = strings.TrimSpace(match[2])
+			} else if line != "" {
+				plain = append(plain, lyricLine{Text: line})
+			}
+			continue
+		}
+		// Word timestamps of enhanced LRC are dropped, the line keeps its own time
+		text := strings.TrimSpace(lrcWordTimestamp.ReplaceAllString(line, ""))
+		for _, time := range times {
+			lyrics.Lines = append(lyrics.Lines, lyricLine{Time: time, Text: text})
+		}
+	}
+
+	if len(lyrics.Lines) == 0 {
+		if plain != nil {
+			lyrics.Lines = plain
+		}
+		return lyrics
+	}
+	lyrics.Synced = true
+	// A positive offset shows the lines earlier
+	lyrics.Offset, _ = strconv.Atoi(lyrics.Tags["offset"])
+	for i := range lyrics.Lines {
+		lyrics.Lines[i].Time = max(lyrics.Lines[i].Time-lyrics.Offset, 0)
+	}
+	sort.SliceStable(lyrics.Lines, func(i, j int) bool { return lyrics.Lines[i].Time < lyrics.Lines[j].Time })
+	return lyrics
+}
+
+// at function: Return the line shown at a time in milliseconds, the last one starting at or before it
+func (lyrics parsedLyrics) at(time int) lyricPosition {
+	position := lyricPosition{Time: time, Index: -1}
+	if !lyrics.Synced {
+		return position
+	}
+	position.Index = sort.Search(len(lyrics.Lines), func(i int) bool { return lyrics.Lines[i].Time > time }) - 1
+	if position.Index >= 0 {
+		position.Line = &lyrics.Lines[position.Index]
+	}
+	if position.Index+1 < len(lyrics.Lines) {
+		position.Next = &lyrics.Lines[position.Index+1]
+	}
+	return position
+}
+
+// get function: Return a remembered lyric file
+func (cache *lyricCache) get(rawURL string) (string, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	content, ok := cache.files[rawURL]
+	return content, ok
+}
+
+// add function: Remember a lyric file, forgetting the oldest ones beyond lyricCacheSize
+func (cache *lyricCache) add(rawURL string, content string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if _, ok := cache.files[rawURL]; !ok {
+		cache.order = append(cache.order, rawURL)
+	}
+	cache.files[rawURL] = content
+	for len(cache.order) > lyricCacheSize {
+		delete(cache.files, cache.order[0])
+		cache.order = cache.order[1:]
+	}
+}
+
+// readLyricFile function: Read a lyric file from the media root when it is served by /file/, download it otherwise
+func readLyricFile(ctx context.Context, rawURL string) (string, error) {
+	if relPath, ok := strings.CutPrefix(rawURL, os.Getenv("HOME_URL")+"/file/"); ok {
+		relPath, err := url.PathUnescape(relPath)
+		if err != nil {
+			return "", err
+		}
+		fullFilePath, err := resolveMediaPath(mediaRoot(), relPath)
+		if err != nil {
+			return "", err
+		}
+		content, err := os.ReadFile(fullFilePath)
+		return string(content), err
+	}
+
+	lyricURL, err := url.Parse(rawURL)
+	if err != nil || (lyricURL.Scheme != "http" && lyricURL.Scheme != "https") {
+		return "", fmt.Errorf("unsupported lyric URL %q", rawURL)
+	}
+	if content, ok := lyricFiles.get(rawURL); ok {
+		return content, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, providerTimeout(API{}))
+	defer cancel()
+	content, err := getLimitedBody(ctx, rawURL, maxLyricFileSize)
+	if err != nil {
+		return "", err
+	}
+	lyricFiles.add(rawURL, string(content))
+	return string(content), nil
+}
+
+// loadLyrics function: Parse the LRC lyrics of a song, converted from MRC when needed, or its TXT file as lines without timing
+func loadLyrics(ctx context.Context, lyric Lyric) (parsedLyrics, error) {
+	read := lyricReader(ctx, lyric)
+	content, err := deriveLyric("lrc", read)
+	if errors.Is(err, errNoLyrics) {
+		content, err = read("txt")
+	}
+	if err != nil {
+		return parsedLyrics{}, err
+	}
+	return parseLRC(content), nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestParseLRC Test tags, repeated timestamps, offsets, enhanced LRC and plain text
+func TestParseLRC(t *testing.T) {
+	lyrics := parseLRC("\uFEFF[ti:Rain]\r\n[ar: Alice ]\r\n[offset:+500]\r\n" +
+		"[00:12.30][01:02.5]Chorus\r\n" +
+		"[00:05.00]<00:05.00>Hello <00:05.50>world\r\n" +
+		"[00:00.20]Intro\r\n" +
+		"[00:20]\r\n" +
+		"untimed credits\r\n")
+	if want := map[string]string{"ti": "Rain", "ar": "Alice", "offset": "+500"}; !reflect.DeepEqual(lyrics.Tags, want) {
+		t.Errorf("Tags %v, want %v", lyrics.Tags, want)
+	}
+	want := []lyricLine{{0, "Intro"}, {4500, "Hello world"}, {11800, "Chorus"}, {19500, ""}, {62000, "Chorus"}}
+	if !lyrics.Synced || lyrics.Offset != 500 || !reflect.DeepEqual(lyrics.Lines, want) {
+		t.Errorf("Unexpected lyrics %+v, want lines %+v", lyrics, want)
+	}
+
+	plain := parseLRC("First line\n\nSecond line\n")
+	if plain.Synced || !reflect.DeepEqual(plain.Lines, []lyricLine{{0, "First line"}, {0, "Second line"}}) {
+		t.Errorf("Unexpected plain lyrics %+v", plain)
+	}
+	if empty := parseLRC(""); empty.Lines == nil || len(empty.Lines) != 0 {
+		t.Errorf("Empty lyrics should have an empty list of lines: %+v", empty)
+	}
+}
+
+// TestParsedLyricsAt Test the line shown before, on, between and after the timestamps
+func TestParsedLyricsAt(t *testing.T) {
+	lyrics := parseLRC("[00:01.00]One\n[00:02.00]Two\n[00:03.00]Three")
+	cases := []struct {
+		time  int
+		index int
+		line  string
+		next  string
+	}{
+		{0, -1, "", "One"},
+		{1000, 0, "One", "Two"},
+		{2500, 1, "Two", "Three"},
+		{60000, 2, "Three", ""},
+	}
+	for _, c := range cases {
+		position := lyrics.at(c.time)
+		line, next := "", ""
+		if position.Line != nil {
+			line = position.Line.Text
+		}
+		if position.Next != nil {
+			next = position.Next.Text
+		}
+		if position.Index != c.index || line != c.line || next != c.next {
+			t.Errorf("at(%d) = %d %q %q, want %d %q %q", c.time, position.Index, line, next, c.index, c.line, c.next)
+		}
+	}
+	if position := parseLRC("no timing").at(1000); position.Index != -1 || position.Line != nil || position.Next != nil {
+		t.Errorf("Lyrics without timing have no current line: %+v", position)
+	}
+}
+
+// TestAPIV2LyricLines Test parsed lyrics of local files and of upstream URLs, downloaded once
+func TestAPIV2LyricLines(t *testing.T) {
+	setupAPITest(t, 0)
+	t.Setenv("HOME_URL", "http://music.example")
+	root := os.Getenv("MEDIA_ROOT")
+	writeTestFile(t, root, "Alice-Rain@Spring/standard.mp3", []byte("audio"))
+	writeTestFile(t, root, "Alice-Rain@Spring/lyric.lrc", []byte("[ar:Alice]\n[00:01.00]Rain\n[00:03.00]falls"))
+	writeTestFile(t, root, "Alice-Snow@Winter/standard.mp3", []byte("audio"))
+	writeTestFile(t, root, "Alice-Snow@Winter/lyric.txt", []byte("Snow\nfalls"))
+	writeTestFile(t, root, "Alice-Mute@Winter/standard.mp3", []byte("audio"))
+
+	var downloads atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken.lrc" {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Path == "/huge.lrc" {
+			fmt.Fprint(w, "[00:01.00]"+strings.Repeat("a", maxLyricFileSize))
+			return
+		}
+		downloads.Add(1)
+		fmt.Fprint(w, "[00:00.50][00:02.00]Sun")
+	}))
+	defer upstream.Close()
+	previous := lyricFiles
+	lyricFiles = &lyricCache{files: map[string]string{}}
+	t.Cleanup(func() { lyricFiles = previous })
+	upSong := OtherSong{SongName: "Sun", Singer: "Bob", LyricURL: Lyric{Lrc: upstream.URL + "/sun.lrc"}}
+	brokenSong := OtherSong{SongName: "Cloud", Singer: "Bob", LyricURL: Lyric{Lrc: upstream.URL + "/broken.lrc"}}
+	hugeSong := OtherSong{SongName: "Storm", Singer: "Bob", LyricURL: Lyric{Lrc: upstream.URL + "/huge.lrc"}}
+	metadata, _ := json.Marshal(Metadata{API: []API{}, Other: []OtherSong{upSong, brokenSong, hugeSong}})
+	writeTestFile(t, root, "metadata.json", metadata)
+
+	lines := func(body map[string]interface{}) string {
+		return toJSON(body["data"].(map[string]interface{})["lines"])
+	}
+	rain := "/api/v2/songs/" + localSongID("Alice-Rain@Spring") + "/lyrics/lines"
+	rr, body := apiV2TestRequest(t, "GET", rain)
+	if rr.Code != http.StatusOK || lines(body) != `[{"text":"Rain","time":1000},{"text":"falls","time":3000}]` ||
+		toJSON(body["data"].(map[string]interface{})["tags"]) != `{"ar":"Alice"}` {
+		t.Errorf("Unexpected local lyrics: %d %v", rr.Code, body)
+	}
+	if _, body := apiV2TestRequest(t, "GET", rain+"?t=2000"); toJSON(body["data"]) != `{"index":0,"line":{"text":"Rain","time":1000},"next":{"text":"falls","time":3000},"time":2000}` {
+		t.Errorf("Unexpected line at 2s: %v", body)
+	}
+	snow := "/api/v2/songs/" + localSongID("Alice-Snow@Winter") + "/lyrics/lines"
+	if _, body := apiV2TestRequest(t, "GET", snow); lines(body) != `[{"text":"Snow","time":0},{"text":"falls","time":0}]` || body["data"].(map[string]interface{})["synced"] != false {
+		t.Errorf("Unexpected plain lyrics: %v", body)
+	}
+
+	sun := "/api/v2/songs/" + otherSongID(upSong) + "/lyrics/lines"
+	for _, target := range []string{sun, sun + "?t=600", sun + "?t=2500"} {
+		if rr, body := apiV2TestRequest(t, "GET", target); rr.Code != http.StatusOK {
+			t.Errorf("%s: got %d %v", target, rr.Code, body)
+		}
+	}
+	if _, body := apiV2TestRequest(t, "GET", sun+"?t=600"); toJSON(body["data"]) != `{"index":0,"line":{"text":"Sun","time":500},"next":{"text":"Sun","time":2000},"time":600}` {
+		t.Errorf("Unexpected upstream line: %v", body)
+	}
+	if downloads.Load() != 1 {
+		t.Errorf("The upstream lyrics should be downloaded once, got %d", downloads.Load())
+	}
+
+	statuses := map[string]int{
+		"/api/v2/songs/" + localSongID("Alice-Mute@Winter") + "/lyrics/lines": http.StatusNotFound,
+		"/api/v2/songs/" + otherSongID(brokenSong) + "/lyrics/lines":          http.StatusBadGateway,
+		"/api/v2/songs/" + otherSongID(hugeSong) + "/lyrics/lines":            http.StatusBadGateway,
+		rain + "?t=-1":  http.StatusBadRequest,
+		rain + "?t=1.5": http.StatusBadRequest,
+		"/api/v2/songs/0123456789abcdef/lyrics/lines": http.StatusNotFound,
+		rain + "/extra": http.StatusNotFound,
+	}
+	for target, status := range statuses {
+		if rr, body := apiV2TestRequest(t, "GET", target); rr.Code != status || body["error"] == nil {
+			t.Errorf("%s: got %d %v, want %d", target, rr.Code, body, status)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -24,12 +28,52 @@ func main() {
 		log.Fatalf("%s PORT environment variable not set\n", TAG)
 	}
 
+	startLibraryIndex()
+	startCache()
+	watcher, err := startLibraryWatcher()
+	if err != nil {
+		log.Fatalf("%s Starting library watcher failed: %v\n", TAG, err)
+	}
+	defer watcher.close()
+	janitor := startCacheJanitor()
+	defer janitor.close()
+
 	http.HandleFunc("/", indexHandler)
 	http.HandleFunc("/api", apiHandler)
+	http.HandleFunc("/api/stream", apiStreamHandler)
+	http.HandleFunc("/api/song/", songHandler)
+	http.HandleFunc("/api/v2", apiV2Handler)
+	http.HandleFunc("/api/v2/", apiV2Handler)
+	http.HandleFunc("/api/openapi.json", openAPIHandler)
+	http.HandleFunc("/api/docs", docsHandler)
 	http.HandleFunc("/file/", fileHandler)
+	http.HandleFunc("/cover/", coverHandler)
+	http.HandleFunc("/lyric/", lyricHandler)
+	adminCacheHandler := newAdminCacheHandler(cacheDirPath())
+	http.HandleFunc("/admin/cache", adminCacheHandler)
+	http.HandleFunc("/admin/cache/", adminCacheHandler)
 	fmt.Printf("%s Started.\n喵波音律-音乐家园QQ交流群:865754861\n", TAG)
 	fmt.Printf("Starting music server at port %s\n", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	server := &http.Server{Addr: ":" + port}
+
+	// Stop serving on SIGINT or SIGTERM, so the deferred background workers finish cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		fmt.Printf("%s Shutting down...\n", TAG)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			fmt.Printf("%s Failed to shut down server: %v\n", TAG, err)
+		}
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		fmt.Printf("%s Failed to start server: %v\n", TAG, err)
+		return
 	}
+	<-shutdownDone
+	backgroundRefreshes.Wait()
 }
@@ -6,6 +6,8 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+
+	"github.com/joho/godotenv"
 )
 
 // TestMain Test the behavior of the main function
@@ -100,3 +102,37 @@ func TestFaleHandler(t *testing.T) {
 			status, http.StatusNotFound)
 	}
 }
+
+// TestEnvExample Test that godotenv reads the settings of .env.example without their comments
+func TestEnvExample(t *testing.T) {
+	env, err := godotenv.Read(".env.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"CACHE_DIR":                "./cache",
+		"API_MAX_PAGE_SIZE":        "100",
+		"API_CACHE_MEMORY_ENTRIES": "512",
+		"API_CACHE_MEMORY_TTL":     "600",
+		"CACHE_JANITOR_INTERVAL":   "600",
+		"CACHE_MAX_SIZE":           "256",
+		"MEDIA_ROOT":               "./music-uploads",
+		"FILE_DENY_LIST":           "metadata.json,metadata.json.example,cache,.*",
+		"LIBRARY_INDEX_PATH":       "./library-index.json",
+		"LIBRARY_SCAN_INTERVAL":    "300",
+		"WATCHER_MODE":             "auto",
+		"FANOUT_WORKERS":           "8",
+		"PROVIDER_TIMEOUT":         "10",
+		"CACHE_REFRESH_INTERVAL":   "60",
+		"ADMIN_TOKEN":              "",
+		"SEARCH_LOCAL_FIRST":       "true",
+		"SEARCH_LOCAL_WEIGHT":      "1",
+		"SEARCH_CHINESE_VARIANTS":  "true",
+		"SEARCH_MAX_TYPOS":         "2",
+	}
+	for key, value := range want {
+		if got, ok := env[key]; !ok || got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
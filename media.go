@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errPathTraversal = errors.New("path escapes the media root")
+	errPathDenied    = errors.New("path is a private file")
+)
+
+// Files never served by /file/, matched against every path segment.
+var defaultDeniedFiles = []string{"metadata.json", "metadata.json.example", "cache", ".*"}
+
+// mediaRoot function: Return the directory holding the uploaded music, set by MEDIA_ROOT
+func mediaRoot() string {
+	if root := os.Getenv("MEDIA_ROOT"); root != "" {
+		return root
+	}
+	return "./music-uploads"
+}
+
+// deniedFiles function: Return the private file patterns, set by FILE_DENY_LIST as a comma separated list
+func deniedFiles() []string {
+	denyList := os.Getenv("FILE_DENY_LIST")
+	if denyList == "" {
+		return defaultDeniedFiles
+	}
+	var patterns []string
+	for _, pattern := range strings.Split(denyList, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// isDeniedPath function: Check whether any segment of a relative path matches a private file pattern
+func isDeniedPath(relPath string, patterns []string) bool {
+	for _, segment := range strings.Split(filepath.ToSlash(relPath), "/") {
+		if segment == "" || segment == "." {
+			continue
+		}
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(segment)); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveMediaPath function: Confine a requested path to the media root and return the real file path
+func resolveMediaPath(root string, requestPath string) (string, error) {
+	// Reject anything that could be interpreted as a traversal before cleaning it away
+	if strings.ContainsAny(requestPath, "\\\x00") {
+		return "", errPathTraversal
+	}
+	for _, segment := range strings.Split(requestPath, "/") {
+		if segment == ".." {
+			return "", errPathTraversal
+		}
+	}
+	relPath := strings.TrimPrefix(filepath.Clean("/"+requestPath), "/")
+	if relPath == "" {
+		return "", os.ErrNotExist
+	}
+
+	patterns := deniedFiles()
+	if isDeniedPath(relPath, patterns) {
+		return "", errPathDenied
+	}
+
+	// Resolve symlinks on both sides so a link cannot point outside the media root
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	realRoot, err = filepath.Abs(realRoot)
+	if err != nil {
+		return "", err
+	}
+	realPath, err := filepath.EvalSymlinks(filepath.Join(realRoot, filepath.FromSlash(relPath)))
+	if err != nil {
+		return "", err
+	}
+	realPath, err = filepath.Abs(realPath)
+	if err != nil {
+		return "", err
+	}
+	realRel, err := filepath.Rel(realRoot, realPath)
+	if err != nil || realRel == ".." || strings.HasPrefix(realRel, ".."+string(filepath.Separator)) {
+		return "", errPathTraversal
+	}
+	if isDeniedPath(realRel, patterns) {
+		return "", errPathDenied
+	}
+
+	return realPath, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestResolveMediaPath Test resolveMediaPath function against traversal and private file attacks
+func TestResolveMediaPath(t *testing.T) {
+	// Create a media root and a secret file next to it
+	tempDir := t.TempDir()
+	root := filepath.Join(tempDir, "media")
+	files := map[string]string{
+		"media/Artist-Song@Album/standard.mp3":  "audio",
+		"media/Artist-Song@Album/metadata.json": "{}",
+		"media/metadata.json":                   "{}",
+		"media/.env":                            "PORT=1",
+		"media/cache/query.json":                "{}",
+		"secret.txt":                            "secret",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatalf("Cannot create directory: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatalf("Cannot create file: %s", err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(tempDir, "secret.txt"), filepath.Join(root, "escape.txt")); err != nil {
+		t.Skipf("Symlinks are not supported: %s", err)
+	}
+	if err := os.Symlink(tempDir, filepath.Join(root, "escape-dir")); err != nil {
+		t.Fatalf("Cannot create symlink: %s", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "metadata.json"), filepath.Join(root, "meta.txt")); err != nil {
+		t.Fatalf("Cannot create symlink: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		allowed bool
+	}{
+		{"plain file", "Artist-Song@Album/standard.mp3", true},
+		{"redundant slashes", "Artist-Song@Album//./standard.mp3", true},
+		{"parent segment", "../secret.txt", false},
+		{"nested parent segment", "Artist-Song@Album/../../secret.txt", false},
+		{"parent segment that stays inside", "Artist-Song@Album/../metadata.json", false},
+		{"backslash traversal", "..\\secret.txt", false},
+		{"null byte", "standard.mp3\x00.png", false},
+		{"root metadata", "metadata.json", false},
+		{"nested metadata", "Artist-Song@Album/metadata.json", false},
+		{"upper case metadata", "METADATA.JSON", false},
+		{"dotfile", ".env", false},
+		{"cache directory", "cache/query.json", false},
+		{"symlink file escape", "escape.txt", false},
+		{"symlink directory escape", "escape-dir/secret.txt", false},
+		{"symlink to private file", "meta.txt", false},
+		{"missing file", "Artist-Song@Album/lossless.flac", false},
+		{"empty path", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveMediaPath(root, tt.path)
+			if tt.allowed && err != nil {
+				t.Errorf("resolveMediaPath(%q) returned error: %s", tt.path, err)
+			}
+			if !tt.allowed && err == nil {
+				t.Errorf("resolveMediaPath(%q) was allowed, expected an error", tt.path)
+			}
+		})
+	}
+}
+
+// TestFileHandlerEncodedTraversal Test fileHandler function with percent-encoded traversal attempts
+func TestFileHandlerEncodedTraversal(t *testing.T) {
+	// Create a media root with a secret file next to it
+	tempDir := t.TempDir()
+	root := filepath.Join(tempDir, "media")
+	if err := os.MkdirAll(root, 0777); err != nil {
+		t.Fatalf("Cannot create base directory: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "secret.txt"), []byte("secret"), 0666); err != nil {
+		t.Fatalf("Cannot create file: %s", err)
+	}
+	t.Setenv("MEDIA_ROOT", root)
+
+	for _, target := range []string{
+		"/file/%2e%2e/secret.txt",
+		"/file/%2E%2E%2Fsecret.txt",
+		"/file/..%5csecret.txt",
+		"/file/.%2e/.%2e/secret.txt",
+	} {
+		req := httptest.NewRequest("GET", target, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(fileHandler).ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("%s: status code error: got %v, want %v", target, status, http.StatusNotFound)
+		}
+	}
+}
+
+// TestDeniedFiles Test deniedFiles function with the FILE_DENY_LIST environment variable
+func TestDeniedFiles(t *testing.T) {
+	t.Setenv("FILE_DENY_LIST", " *.bak , private ,")
+	patterns := deniedFiles()
+	if len(patterns) != 2 || patterns[0] != "*.bak" || patterns[1] != "private" {
+		t.Errorf("Unexpected patterns: %v", patterns)
+	}
+	if !isDeniedPath("Artist-Song/old.BAK", patterns) {
+		t.Errorf("Expected Artist-Song/old.BAK to be denied")
+	}
+	if isDeniedPath("Artist-Song/standard.mp3", patterns) {
+		t.Errorf("Expected Artist-Song/standard.mp3 to be allowed")
+	}
+}
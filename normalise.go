@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// A search term prepared once and matched against many songs.
+type songMatcher struct {
+	msg      string   // Normalised search term
+	runes    []rune   // Normalised search term, by rune
+	tokens   []string // Folded words of the search term
+	maxTypos int
+	pinyin   bool // The search term may be pinyin or initials
+}
+
+// Map from traditional to simplified characters, built from the tables below.
+var traditionalToSimplified = func() map[rune]rune {
+	traditional, simplified := []rune(traditionalChars), []rune(simplifiedChars)
+	table := make(map[rune]rune, len(traditional))
+	for i, r := range traditional {
+		table[r] = simplified[i]
+	}
+	return table
+}()
+
+// searchChineseVariants function: Report whether traditional and simplified spellings match each other, set by SEARCH_CHINESE_VARIANTS
+func searchChineseVariants() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("SEARCH_CHINESE_VARIANTS"))
+	if err != nil {
+		return true
+	}
+	return enabled
+}
+
+// searchMaxTypos function: Return the most typos tolerated in a search term, set by SEARCH_MAX_TYPOS, 0 disables fuzzy matching
+func searchMaxTypos() int {
+	typos, err := strconv.Atoi(os.Getenv("SEARCH_MAX_TYPOS"))
+	if err != nil || typos < 0 {
+		return 2
+	}
+	return typos
+}
+
+// foldText function: Apply Unicode NFKC, then fold case and optionally traditional characters, keeping punctuation and spaces
+func foldText(text string) string {
+	variants := searchChineseVariants()
+	// NFKC maps full-width ASCII, half-width katakana, circled digits, ligatures and compatibility ideographs to their plain forms
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if variants {
+			if simplified, ok := traditionalToSimplified[r]; ok {
+				r = simplified
+			}
+		}
+		return r
+	}, norm.NFKC.String(text))
+}
+
+// normaliseText function: Fold a text and strip everything but letters and digits, the form search terms are compared in
+func normaliseText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return r
+		}
+		return -1
+	}, foldText(text))
+}
+
+// newSongMatcher function: Prepare a search term for matchScore
+func newSongMatcher(msg string) *songMatcher {
+	normalised := normaliseText(msg)
+	matcher := &songMatcher{msg: normalised, runes: []rune(normalised), tokens: searchTokens(msg), pinyin: isPinyinQuery(normalised)}
+
+	// Terms up to four characters must match exactly, longer ones tolerate a typo per four characters
+	if len(matcher.runes) > 0 {
+		matcher.maxTypos = (len(matcher.runes) - 1) / 4
+	}
+	if limit := searchMaxTypos(); matcher.maxTypos > limit {
+		matcher.maxTypos = limit
+	}
+	return matcher
+}
+
+// fuzzyDistance function: Return the edit distance between the search term and its closest substring of text, and whether it is within the typo limit
+func (matcher *songMatcher) fuzzyDistance(text string) (int, bool) {
+	if matcher.maxTypos == 0 || text == "" {
+		return 0, false
+	}
+	// Approximate substring matching with adjacent transpositions, a match may start anywhere in text for free
+	pattern, runes := matcher.runes, []rune(text)
+	beforePrevious := make([]int, len(pattern)+1)
+	previous, current := make([]int, len(pattern)+1), make([]int, len(pattern)+1)
+	for i := range previous {
+		previous[i] = i
+	}
+	best := previous[len(pattern)]
+	for j, r := range runes {
+		current[0] = 0
+		for i, p := range pattern {
+			cost := 1
+			if p == r {
+				cost = 0
+			}
+			current[i+1] = min(previous[i]+cost, previous[i+1]+1, current[i]+1)
+			if i > 0 && j > 0 && p == runes[j-1] && pattern[i-1] == r {
+				current[i+1] = min(current[i+1], beforePrevious[i-1]+1)
+			}
+		}
+		best = min(best, current[len(pattern)])
+		beforePrevious, previous, current = previous, current, beforePrevious
+	}
+	return best, best <= matcher.maxTypos
+}
+
+// Traditional Chinese characters and their simplified forms, rune by rune.
+var (
+	traditionalChars = "" +
+		"來個們倫傑備傳傷價億優兒內兩凍劇劉劍動勝勢區協卻參吳問喚單嗎嗚嘆噴嚇嚮嚴囉國圍園" +
+		"圓圖團報場塵壇壓壞壯壺壽夠夢夥夾奧奪奮娛婦媯媽嬌孫學孿寢實寧審寫寬寶將專尋對導層" +
+		"屬岡峯島嶼師帳帶幣幫幾廟廢廣廳弔張彈彎彥後徑從徵徹恆悅惡惱愛態慘慣慶憂憐憑憤憫憲" +
+		"憶應懶懷戀戰戲戶拋揚換揮損搖搶撐撥擁擇擊擋擔據擬擺擾攜攤敗敵數斃斬斷於時晉晝暈暢" +
+		"暫曆曉曬書會朧東條棄棟棲楊楓極榮槍樂標樣樹橋機檢櫻權歐歡歲歷歸殘殺殼毀氣汙決沒沖" +
+		"況洩涼淒淚淨淵淺渾湧溝溫滄滅滯滾滿漁漢漬漲漸潑潔潛澀澤濁濃濕濟濤濱瀏瀟灑灘灣災為" +
+		"烏無煉煙煥煩熱燈燒營燦爐爭爺爾牆牽犢犧狀猶猻獅獎獨獲現瑣瑩瑪環璽甕產畝畢畫異當疊" +
+		"痺瘋瘡療癡癮發皺盜盞盡盤盧眾睏睜睞矚碩確碼磚礎祿禍禦禪禮禱稅種稱穀穌穩窮窺竊競筆" +
+		"筧節範築簡簽籃籌糧糾紀約紅紋納純紗紙級紛細終組結絕給絲綁經綠維網綿緊緒線締緣編緩" +
+		"練緻縣縫縮縱總織繞繩繼續纏纖罈罰罷羅羋義習聖聞聯聰聲聳職聽肅脅脈脫腦膚膽臉臘臨臺" +
+		"與興舉舊艦艱艷芻荊莊莖華萬葉蒼蓋蓮蔣蕭薑薩藍藝藥蘆蘇蘋蘭處虛號蛻蝦蟲蠟蠻術衛衝裊" +
+		"裏補裝裡複襯襲見覓視親覺覽觀訂計訊討訓記訝設許訴評詞詠詢試詩詭話該詳誇誌認誕語誠" +
+		"誤說誰課調談請諒論諧諾謀謊謎講謝謹證譏識譚譜譯議護讀變讓讚豎豐豬貓貝負貢貧貨販責" +
+		"貴買貸費貼賀資賊賓賞賢賣質賴購贈贊贏趕趙趨跡蹟蹤躉躍軀車軌軍軟較載輔輕輛輝輩輪輸" +
+		"轉轟辦辭辯農迴這連週遊運過遙遞遠適遲遷遺還邊邏郵鄉鄧鄭鄰醜醞醫釋針鈔鈴鉛銀銘銷鋒" +
+		"鋪鋼錄錢錦錯鍊鍋鍛鍵鍾鎖鎮鏈鏟鏡鐘鐵鑄鑰長門閃閉開閒間閣閨閱閻闆闊闖關陝陣陰陳陸" +
+		"陽隊階隕際隨險隱隻雋雖雙雛雜雞離難雲電霧霽靂靈靜鞦韆韋韓韻響頁頂項順須頌預頒頓頗" +
+		"領頭頸頹頻顆題顏願類顧顫顯風颯颱飄飆飛飢飯飲餅養餓餘館饑饒馬馮駐駕騎騙騰騷驅驕驗" +
+		"驚骯髏髒體髮鬆鬥鬧鬱魘魚魯鮮鯨鱗鳥鳳鳴鴉鴿鵝鶴鷹鸚鹽麗麥麵麼黃點黨黴齊齒齡龍龔龜"
+	simplifiedChars = "" +
+		"来个们伦杰备传伤价亿优儿内两冻剧刘剑动胜势区协却参吴问唤单吗呜叹喷吓向严啰国围园" +
+		"圆图团报场尘坛压坏壮壶寿够梦伙夹奥夺奋娱妇妫妈娇孙学孪寝实宁审写宽宝将专寻对导层" +
+		"属冈峰岛屿师帐带币帮几庙废广厅吊张弹弯彦后径从征彻恒悦恶恼爱态惨惯庆忧怜凭愤悯宪" +
+		"忆应懒怀恋战戏户抛扬换挥损摇抢撑拨拥择击挡担据拟摆扰携摊败敌数毙斩断于时晋昼晕畅" +
+		"暂历晓晒书会胧东条弃栋栖杨枫极荣枪乐标样树桥机检樱权欧欢岁历归残杀壳毁气污决没冲" +
+		"况泄凉凄泪净渊浅浑涌沟温沧灭滞滚满渔汉渍涨渐泼洁潜涩泽浊浓湿济涛滨浏潇洒滩湾灾为" +
+		"乌无炼烟焕烦热灯烧营灿炉争爷尔墙牵犊牺状犹狲狮奖独获现琐莹玛环玺瓮产亩毕画异当叠" +
+		"痹疯疮疗痴瘾发皱盗盏尽盘卢众困睁睐瞩硕确码砖础禄祸御禅礼祷税种称谷稣稳穷窥窃竞笔" +
+		"笕节范筑简签篮筹粮纠纪约红纹纳纯纱纸级纷细终组结绝给丝绑经绿维网绵紧绪线缔缘编缓" +
+		"练致县缝缩纵总织绕绳继续缠纤坛罚罢罗芈义习圣闻联聪声耸职听肃胁脉脱脑肤胆脸腊临台" +
+		"与兴举旧舰艰艳刍荆庄茎华万叶苍盖莲蒋萧姜萨蓝艺药芦苏苹兰处虚号蜕虾虫蜡蛮术卫冲袅" +
+		"里补装里复衬袭见觅视亲觉览观订计讯讨训记讶设许诉评词咏询试诗诡话该详夸志认诞语诚" +
+		"误说谁课调谈请谅论谐诺谋谎谜讲谢谨证讥识谭谱译议护读变让赞竖丰猪猫贝负贡贫货贩责" +
+		"贵买贷费贴贺资贼宾赏贤卖质赖购赠赞赢赶赵趋迹迹踪趸跃躯车轨军软较载辅轻辆辉辈轮输" +
+		"转轰办辞辩农回这连周游运过遥递远适迟迁遗还边逻邮乡邓郑邻丑酝医释针钞铃铅银铭销锋" +
+		"铺钢录钱锦错炼锅锻键钟锁镇链铲镜钟铁铸钥长门闪闭开闲间阁闺阅阎板阔闯关陕阵阴陈陆" +
+		"阳队阶陨际随险隐只隽虽双雏杂鸡离难云电雾霁雳灵静秋千韦韩韵响页顶项顺须颂预颁顿颇" +
+		"领头颈颓频颗题颜愿类顾颤显风飒台飘飙飞饥饭饮饼养饿余馆饥饶马冯驻驾骑骗腾骚驱骄验" +
+		"惊肮髅脏体发松斗闹郁魇鱼鲁鲜鲸鳞鸟凤鸣鸦鸽鹅鹤鹰鹦盐丽麦面么黄点党霉齐齿龄龙龚龟"
+)
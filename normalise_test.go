@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestNormaliseText Test NFKC, case folding, punctuation stripping and Chinese variants
+func TestNormaliseText(t *testing.T) {
+	tests := map[string]string{
+		"Jay Chou":      "jaychou",
+		"ＪＡＹ　ＣＨＯＵ":      "jaychou",
+		"Don't Stop!":   "dontstop",
+		"七里香 (Live)":    "七里香live",
+		"後來":            "后来",
+		"愛在西元前":         "爱在西元前",
+		"Ａ-Ｌｉｎ《給我一個理由》": "alin给我一个理由",
+		"ｶﾞｯｶﾘ":         "ガッカリ",
+		"第①章":           "第1章",
+		"ﬁre":           "fire",
+		"\uF900":        "\u8C48",
+		"㍻":             "平成",
+		"Ⅳ":             "iv",
+	}
+	for input, want := range tests {
+		if got := normaliseText(input); got != want {
+			t.Errorf("normaliseText(%q) = %q, want %q", input, got, want)
+		}
+	}
+
+	t.Setenv("SEARCH_CHINESE_VARIANTS", "false")
+	if got := normaliseText("後來"); got != "後來" {
+		t.Errorf("normaliseText without variants = %q, want %q", got, "後來")
+	}
+}
+
+// TestFuzzyMatch Test that typos are tolerated in long enough search terms only
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		song Song
+		msg  string
+		want bool
+	}{
+		{Song{Song: "Yesterday"}, "yesterdy", true},
+		{Song{Song: "Yesterday Once More"}, "yestrday", true},
+		{Song{Song: "Hello", Singer: "Adele"}, "adelle", true},
+		{Song{Song: "Song"}, "sung", false},
+		{Song{Song: "晴天"}, "情天", false},
+		{Song{Song: "Bohemian Rhapsody"}, "bohemain rapsody", true},
+		{Song{Song: "Bohemian Rhapsody"}, "bohemian melody", false},
+	}
+	for _, test := range tests {
+		score := matchScore(test.song, test.msg)
+		if (score > 0) != test.want {
+			t.Errorf("matchScore(%+v, %q) = %d, want a match: %v", test.song, test.msg, score, test.want)
+		}
+		if score >= scoreSingerAlbum {
+			t.Errorf("A fuzzy match of %q scores %d, above the exact matches", test.msg, score)
+		}
+	}
+
+	t.Setenv("SEARCH_MAX_TYPOS", "0")
+	if score := matchScore(Song{Song: "Yesterday"}, "yesterdy"); score != 0 {
+		t.Errorf("SEARCH_MAX_TYPOS=0 should disable fuzzy matching, got score %d", score)
+	}
+}
+
+// TestGetLocalSongsNormalised Test that local search ignores case, width and Chinese variants
+func TestGetLocalSongsNormalised(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("MEDIA_ROOT", root)
+	writeTestFile(t, root, "metadata.json", []byte(`{"api":[],"other":[
+		{"song_name":"七里香","singer":"Jay Chou"},
+		{"song_name":"後來","singer":"劉若英"}
+	]}`))
+	defer func(previous *libraryIndex) { library = previous }(library)
+	library = newLibraryIndex()
+
+	for msg, want := range map[string]string{"jay": "七里香", "ｊａｙ ｃｈｏｕ": "七里香", "后来": "後來", "jay chuo": "七里香"} {
+		songs := getLocalSongs(msg)
+		if len(songs) != 1 || songs[0].Song != want {
+			t.Errorf("getLocalSongs(%q) = %+v, want %q", msg, songs, want)
+		}
+	}
+}
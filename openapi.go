@@ -0,0 +1,307 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Viewer of the OpenAPI document, it only loads /api/openapi.json so it works without internet access.
+//
+//go:embed docs.html
+var docsPage []byte
+
+// The OpenAPI document, built once from the Go types of the responses.
+var (
+	openAPIOnce     sync.Once
+	openAPIDocument []byte
+)
+
+// A JSON object of the OpenAPI document.
+type openAPIObject = map[string]interface{}
+
+// The component schemas of the document, derived from the JSON fields of Go types so they cannot drift from the responses.
+type openAPISchemas map[string]interface{}
+
+// Helper function to reference a component schema
+func schemaRef(name string) openAPIObject {
+	return openAPIObject{"$ref": "#/components/schemas/" + name}
+}
+
+// Helper function to allow null in place of a schema
+func nullable(schema openAPIObject) openAPIObject {
+	return openAPIObject{"nullable": true, "allOf": []interface{}{schema}}
+}
+
+// define function: Add the schema of a struct type as a component, fields replaces the schema of some of its JSON fields
+func (schemas openAPISchemas) define(name string, t reflect.Type, fields openAPIObject) openAPIObject {
+	if _, ok := schemas[name]; !ok {
+		schemas[name] = openAPIObject{} // Placeholder while the fields are read, in case a type refers to itself
+		properties := openAPIObject{}
+		required := []string{}
+		schemas.addFields(t, fields, properties, &required)
+		sort.Strings(required)
+		schemas[name] = openAPIObject{"type": "object", "properties": properties, "required": required, "additionalProperties": false}
+	}
+	return schemaRef(name)
+}
+
+// Helper function to add the JSON fields of a struct type, fields of embedded structs included like encoding/json does
+func (schemas openAPISchemas) addFields(t reflect.Type, fields openAPIObject, properties openAPIObject, required *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			schemas.addFields(field.Type, fields, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema, ok := fields[name]
+		if !ok {
+			schema = schemas.schema(field.Type)
+		}
+		properties[name] = schema
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// schema function: Return the schema of a Go type, structs become components named after the type
+func (schemas openAPISchemas) schema(t reflect.Type) openAPIObject {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemas.schema(t.Elem())
+	case reflect.String:
+		return openAPIObject{"type": "string"}
+	case reflect.Bool:
+		return openAPIObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openAPIObject{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return openAPIObject{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return openAPIObject{"type": "array", "items": schemas.schema(t.Elem())}
+	case reflect.Map:
+		return openAPIObject{"type": "object", "additionalProperties": schemas.schema(t.Elem())}
+	case reflect.Struct:
+		name := []rune(t.Name())
+		name[0] = unicode.ToUpper(name[0])
+		return schemas.define(string(name), t, nil)
+	}
+	return openAPIObject{} // interface{} fields hold any JSON value
+}
+
+// Helper function to describe a query or path parameter
+func openAPIParameter(name string, in string, description string, schema openAPIObject) openAPIObject {
+	return openAPIObject{"name": name, "in": in, "description": description, "required": in == "path", "schema": schema}
+}
+
+// Helper function to describe a JSON response
+func openAPIResponse(description string, schema openAPIObject) openAPIObject {
+	return openAPIObject{"description": description, "content": openAPIObject{"application/json": openAPIObject{"schema": schema}}}
+}
+
+// Helper function to describe a GET operation
+func openAPIGet(tag string, summary string, parameters []interface{}, responses openAPIObject) openAPIObject {
+	return openAPIObject{"get": openAPIObject{"tags": []string{tag}, "summary": summary, "parameters": parameters, "responses": responses}}
+}
+
+// buildOpenAPI function: Build the OpenAPI 3 document of /api, /api/stream, /api/song and /api/v2
+func buildOpenAPI() openAPIObject {
+	schemas := openAPISchemas{}
+	song := schemas.define("Song", reflect.TypeOf(Song{}), openAPIObject{
+		"music_url": nullable(schemas.schema(reflect.TypeOf(MusicURL{}))),
+		"lyric":     nullable(schemas.schema(reflect.TypeOf(Lyric{}))),
+	})
+	searchResponse := schemas.define("SearchResponse", reflect.TypeOf(Response{}), openAPIObject{
+		"data": openAPIObject{"type": "array", "items": song},
+		"code": openAPIObject{"type": "integer", "enum": []int{0, 1, 2, 3, 4, 5}},
+	})
+	songResponse := schemas.define("SongResponse", reflect.TypeOf(Response{}), openAPIObject{
+		"data": openAPIObject{"oneOf": []interface{}{song, openAPIObject{"type": "array", "maxItems": 0}}},
+		"code": openAPIObject{"type": "integer", "enum": []int{0, 2, 3}},
+	})
+	streamEvent := schemas.define("StreamEvent", reflect.TypeOf(streamEvent{}), openAPIObject{
+		"event": openAPIObject{"type": "string", "enum": []string{"local", "provider", "done", "error"}},
+	})
+	songV2 := schemas.schema(reflect.TypeOf(songV2{}))
+	errorV2 := schemas.schema(reflect.TypeOf(errorResponseV2{}))
+	listOf := func(name string, items openAPIObject) openAPIObject {
+		return schemas.define(name, reflect.TypeOf(listResponseV2{}), openAPIObject{"data": openAPIObject{"type": "array", "items": items}})
+	}
+	itemOf := func(name string, data openAPIObject) openAPIObject {
+		return schemas.define(name, reflect.TypeOf(itemResponseV2{}), openAPIObject{"data": data})
+	}
+
+	songList := listOf("SongListV2", songV2)
+	artistList := listOf("ArtistListV2", schemas.schema(reflect.TypeOf(catalogArtist{})))
+	albumList := listOf("AlbumListV2", schemas.schema(reflect.TypeOf(catalogAlbum{})))
+	initialList := itemOf("InitialsItemV2", openAPIObject{"type": "array", "items": schemas.schema(reflect.TypeOf(catalogInitial{}))})
+
+	id := openAPIParameter("id", "path", "Stable ID of the resource.", openAPIObject{"type": "string", "pattern": "^[0-9a-f]{16}$"})
+	search := []interface{}{
+		openAPIParameter("singer", "query", "Only songs whose singer contains this text, the ranking does not change.", openAPIObject{"type": "string"}),
+		openAPIParameter("num", "query", "Only the song with this position in the results.", openAPIObject{"type": "integer", "minimum": 1}),
+		openAPIParameter("album", "query", "Only songs of this album.", openAPIObject{"type": "string"}),
+		openAPIParameter("has_lyrics", "query", "Only songs with lyrics when true, false returns every song.", openAPIObject{"type": "boolean"}),
+		openAPIParameter("quality", "query", "Only songs with at least this quality.", openAPIObject{"type": "string", "enum": qualityNames}),
+		openAPIParameter("source", "query", "Only songs of this source, \"local\" or a provider.", openAPIObject{"type": "string"}),
+	}
+	pages := []interface{}{
+		openAPIParameter("page", "query", "Page to return, from 1, with page_size.", openAPIObject{"type": "integer", "minimum": 1}),
+		openAPIParameter("page_size", "query", "Songs per page, at most API_MAX_PAGE_SIZE.", openAPIObject{"type": "integer", "minimum": 1}),
+		openAPIParameter("offset", "query", "Results to skip, with limit, not with page.", openAPIObject{"type": "integer", "minimum": 0}),
+		openAPIParameter("limit", "query", "Most results to return, at most API_MAX_PAGE_SIZE.", openAPIObject{"type": "integer", "minimum": 1}),
+	}
+	msg := openAPIParameter("msg", "query", "Search query, with field:value terms, \"quoted phrases\" and -negations.", openAPIObject{"type": "string"})
+	msg["required"] = true
+	q := openAPIParameter("q", "query", "Search query, like msg of /api.", openAPIObject{"type": "string"})
+	q["required"] = true
+	initial := openAPIParameter("initial", "query", "Only the names of this A to Z group, \"#\" for the others.", openAPIObject{"type": "string", "pattern": "^[A-Za-z#]$"})
+	format := openAPIParameter("format", "query", "\"ndjson\" for NDJSON, Server-Sent Events otherwise.", openAPIObject{"type": "string", "enum": []string{"ndjson"}})
+
+	lyricContent := openAPIObject{}
+	for _, format := range lyricFormats {
+		contentType, _, _ := strings.Cut(lyricContentTypes[format], ";")
+		lyricContent[contentType] = openAPIObject{"schema": openAPIObject{"type": "string"}}
+	}
+
+	v2Errors := func(responses openAPIObject, statuses ...string) openAPIObject {
+		for _, status := range statuses {
+			responses[status] = openAPIResponse("Error, see error.code.", errorV2)
+		}
+		return responses
+	}
+	paths := openAPIObject{
+		"/api": openAPIGet("legacy", "Search the local songs and the cached results of the providers",
+			append(append([]interface{}{msg}, search...), pages...),
+			openAPIObject{"200": openAPIResponse("Songs found, or code 1 to 5 when the request is invalid or nothing was found.", searchResponse)}),
+		"/api/stream": openAPIGet("legacy", "Search the local songs and every provider, sending songs as they arrive",
+			append([]interface{}{msg, format}, search...),
+			openAPIObject{"200": openAPIObject{"description": "One event per source, then \"done\", or a single \"error\".", "content": openAPIObject{
+				"text/event-stream":    openAPIObject{"schema": streamEvent},
+				"application/x-ndjson": openAPIObject{"schema": streamEvent},
+			}}}),
+		"/api/song/{id}": openAPIGet("legacy", "Return one song with its music and lyric URLs resolved",
+			[]interface{}{id},
+			openAPIObject{
+				"200": openAPIResponse("The song.", songResponse),
+				"400": openAPIResponse("Invalid id, code 2.", songResponse),
+				"404": openAPIResponse("No song with this id, code 3.", songResponse),
+			}),
+		"/lyric/{file}": openAPIGet("files", "Serve a lyric format of a song, converted from the formats it has",
+			[]interface{}{openAPIParameter("file", "path", "Song ID and format, like the derived URLs of the /api/v2 lyric.", openAPIObject{"type": "string", "pattern": "^[0-9a-f]{16}\\.(mrc|lrc|txt|vtt|srt)$"})},
+			openAPIObject{
+				"200": openAPIObject{"description": "The lyrics.", "content": lyricContent},
+				"404": openAPIObject{"description": "No such song or format, or no format it can be converted from."},
+				"502": openAPIObject{"description": "The lyric file of the song cannot be read."},
+			}),
+		"/api/v2/search": openAPIGet("v2", "Search like /api, with typed songs",
+			append(append([]interface{}{q}, search...), pages...),
+			v2Errors(openAPIObject{"200": openAPIResponse("A page of the songs found.", songList)}, "400")),
+		"/api/v2/songs": openAPIGet("v2", "List the local songs by title",
+			append([]interface{}{initial}, pages...),
+			v2Errors(openAPIObject{"200": openAPIResponse("A page of the songs.", songList)}, "400")),
+		"/api/v2/songs/{id}": openAPIGet("v2", "Return one song",
+			[]interface{}{id},
+			v2Errors(openAPIObject{"200": openAPIResponse("The song.", itemOf("SongItemV2", songV2))}, "400", "404")),
+		"/api/v2/songs/{id}/lyrics": openAPIGet("v2", "Return the lyric URLs of a song",
+			[]interface{}{id},
+			v2Errors(openAPIObject{"200": openAPIResponse("The lyric URLs.", itemOf("LyricItemV2", schemas.schema(reflect.TypeOf(lyricV2{}))))}, "400", "404")),
+		"/api/v2/songs/{id}/lyrics/lines": openAPIGet("v2", "Return the parsed lyrics of a song, or the line at a time",
+			[]interface{}{id, openAPIParameter("t", "query", "Position in the song in milliseconds, only the line shown then is returned.", openAPIObject{"type": "integer", "minimum": 0})},
+			v2Errors(openAPIObject{"200": openAPIResponse("The timed lines, or the line at t.", openAPIObject{"oneOf": []interface{}{
+				itemOf("LyricsItemV2", schemas.schema(reflect.TypeOf(parsedLyrics{}))),
+				itemOf("LyricPositionItemV2", schemas.define("LyricPosition", reflect.TypeOf(lyricPosition{}), openAPIObject{
+					"line": nullable(schemas.schema(reflect.TypeOf(lyricLine{}))),
+					"next": nullable(schemas.schema(reflect.TypeOf(lyricLine{}))),
+				})),
+			}})}, "400", "404", "502")),
+		"/api/v2/songs/{id}/cover": openAPIGet("v2", "Redirect to the cover of a song",
+			[]interface{}{id},
+			v2Errors(openAPIObject{"302": openAPIObject{"description": "Redirect to the cover image."}}, "400", "404")),
+		"/api/v2/artists": openAPIGet("v2", "List the singers of the local songs in A to Z order",
+			append([]interface{}{initial}, pages...),
+			v2Errors(openAPIObject{"200": openAPIResponse("A page of the artists.", artistList)}, "400")),
+		"/api/v2/artists/initials": openAPIGet("v2", "Group the singers by initial for A to Z navigation",
+			[]interface{}{},
+			openAPIObject{"200": openAPIResponse("The initials with their count and offset in the list.", initialList)}),
+		"/api/v2/artists/{id}": openAPIGet("v2", "Return a singer with its albums",
+			[]interface{}{id},
+			v2Errors(openAPIObject{"200": openAPIResponse("The artist.", itemOf("ArtistItemV2", schemas.schema(reflect.TypeOf(artistDetailV2{}))))}, "404")),
+		"/api/v2/artists/{id}/albums": openAPIGet("v2", "List the albums of a singer",
+			append([]interface{}{id}, pages...),
+			v2Errors(openAPIObject{"200": openAPIResponse("A page of the albums.", albumList)}, "400", "404")),
+		"/api/v2/artists/{id}/songs": openAPIGet("v2", "List the songs of a singer, album by album in track order",
+			append([]interface{}{id}, pages...),
+			v2Errors(openAPIObject{"200": openAPIResponse("A page of the songs.", songList)}, "400", "404")),
+		"/api/v2/albums": openAPIGet("v2", "List the albums of the local songs in A to Z order",
+			append([]interface{}{initial}, pages...),
+			v2Errors(openAPIObject{"200": openAPIResponse("A page of the albums.", albumList)}, "400")),
+		"/api/v2/albums/initials": openAPIGet("v2", "Group the albums by initial for A to Z navigation",
+			[]interface{}{},
+			openAPIObject{"200": openAPIResponse("The initials with their count and offset in the list.", initialList)}),
+		"/api/v2/albums/{id}": openAPIGet("v2", "Return an album with its songs in track order",
+			[]interface{}{id},
+			v2Errors(openAPIObject{"200": openAPIResponse("The album.", itemOf("AlbumItemV2", schemas.schema(reflect.TypeOf(albumDetailV2{}))))}, "404")),
+		"/api/v2/albums/{id}/songs": openAPIGet("v2", "List the songs of an album in track order",
+			append([]interface{}{id}, pages...),
+			v2Errors(openAPIObject{"200": openAPIResponse("A page of the songs.", songList)}, "400", "404")),
+	}
+
+	return openAPIObject{
+		"openapi": "3.0.3",
+		"info": openAPIObject{
+			"title":       "MeowMusicServer API",
+			"description": "Aggregated music search of the local library and the providers of metadata.json.",
+			"version":     "1.0.0",
+		},
+		"tags": []interface{}{
+			openAPIObject{"name": "legacy", "description": "The original API used by existing devices."},
+			openAPIObject{"name": "v2", "description": "Resources with typed fields and HTTP status codes."},
+			openAPIObject{"name": "files", "description": "Lyric files, converted from the formats a song has."},
+		},
+		"paths":      paths,
+		"components": openAPIObject{"schemas": schemas},
+	}
+}
+
+// openAPIHandler function: Serve the OpenAPI document at /api/openapi.json
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		document, err := json.MarshalIndent(buildOpenAPI(), "", "  ")
+		if err != nil {
+			panic(err) // Only maps, strings and numbers, a failure is a programming error
+		}
+		openAPIDocument = document
+	})
+	w.Header().Set("Server", "MeowMusicServer")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*") // Let other tools load the document
+	w.Write(openAPIDocument)
+}
+
+// docsHandler function: Serve the viewer of the OpenAPI document at /api/docs
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", "MeowMusicServer")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
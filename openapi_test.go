@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Helper function to check a decoded JSON value against a schema of the document, returning the mismatches
+func validateSchema(doc map[string]interface{}, schema map[string]interface{}, value interface{}, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		components := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+		target, ok := components[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+		if !ok {
+			return []string{at + ": unknown " + ref}
+		}
+		return validateSchema(doc, target, value, at)
+	}
+	if value == nil {
+		if schema["nullable"] == true || len(schema) == 0 {
+			return nil
+		}
+		return []string{at + ": null is not allowed"}
+	}
+	var problems []string
+	for _, item := range asList(schema["allOf"]) {
+		problems = append(problems, validateSchema(doc, item.(map[string]interface{}), value, at)...)
+	}
+	if oneOf := asList(schema["oneOf"]); len(oneOf) > 0 {
+		matches := 0
+		for _, item := range oneOf {
+			if len(validateSchema(doc, item.(map[string]interface{}), value, at)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			problems = append(problems, fmt.Sprintf("%s: %d schemas of oneOf match %v", at, matches, value))
+		}
+	}
+	if enum := asList(schema["enum"]); len(enum) > 0 {
+		found := false
+		for _, item := range enum {
+			found = found || fmt.Sprint(item) == fmt.Sprint(value)
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", at, value, enum))
+		}
+	}
+
+	switch schema["type"] {
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: %v is not a string", at, value))
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(text) {
+			problems = append(problems, fmt.Sprintf("%s: %q does not match %s", at, text, pattern))
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok || (schema["type"] == "integer" && number != float64(int64(number))) {
+			problems = append(problems, fmt.Sprintf("%s: %v is not an %s", at, value, schema["type"]))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: %v is not a boolean", at, value))
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: %v is not an array", at, value))
+		}
+		if maxItems, ok := schema["maxItems"].(float64); ok && len(items) > int(maxItems) {
+			problems = append(problems, fmt.Sprintf("%s: more than %v items", at, maxItems))
+		}
+		for i, item := range items {
+			if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(doc, itemSchema, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: %v is not an object", at, value))
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for _, name := range asList(schema["required"]) {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing %q", at, name))
+			}
+		}
+		for name, field := range object {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(doc, property, field, at+"."+name)...)
+			} else if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(doc, additional, field, at+"."+name)...)
+			} else if schema["additionalProperties"] == false {
+				problems = append(problems, fmt.Sprintf("%s: %q is not in the specification", at, name))
+			}
+		}
+	}
+	return problems
+}
+
+// Helper function to read a JSON array of the document, nil when absent
+func asList(value interface{}) []interface{} {
+	list, _ := value.([]interface{})
+	return list
+}
+
+// Helper function to find the documented schema of a response by its request path, status and content type
+func responseSchema(t *testing.T, doc map[string]interface{}, path string, status int, contentType string) map[string]interface{} {
+	t.Helper()
+	segments := strings.Split(path, "/")
+	var templates []string
+	for template := range doc["paths"].(map[string]interface{}) {
+		templates = append(templates, template)
+	}
+	// Fixed segments like /artists/initials come before the {id} they would also match
+	sort.Slice(templates, func(i, j int) bool { return strings.Count(templates[i], "{") < strings.Count(templates[j], "{") })
+	for _, template := range templates {
+		item := doc["paths"].(map[string]interface{})[template]
+		templateSegments := strings.Split(template, "/")
+		if len(templateSegments) != len(segments) {
+			continue
+		}
+		matches := true
+		for i, segment := range templateSegments {
+			if !strings.HasPrefix(segment, "{") && segment != segments[i] {
+				matches = false
+			}
+		}
+		if !matches {
+			continue
+		}
+		responses := item.(map[string]interface{})["get"].(map[string]interface{})["responses"].(map[string]interface{})
+		response, ok := responses[fmt.Sprint(status)].(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s: status %d is not documented", path, status)
+		}
+		content, _ := response["content"].(map[string]interface{})
+		media, ok := content[strings.Split(contentType, ";")[0]].(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s: %s of status %d is not documented", path, contentType, status)
+		}
+		return media["schema"].(map[string]interface{})
+	}
+	t.Fatalf("%s is not documented", path)
+	return nil
+}
+
+// Helper function to load the document served at /api/openapi.json
+func loadOpenAPI(t *testing.T) map[string]interface{} {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	openAPIHandler(rr, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	var doc map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Cannot decode the OpenAPI document: %s", err)
+	}
+	return doc
+}
+
+// TestOpenAPIDocument Test that the document is complete and that the viewer loads it
+func TestOpenAPIDocument(t *testing.T) {
+	doc := loadOpenAPI(t)
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("Unexpected OpenAPI version %v", doc["openapi"])
+	}
+	data, _ := json.Marshal(doc)
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for _, ref := range regexp.MustCompile(`#/components/schemas/(\w+)`).FindAllStringSubmatch(string(data), -1) {
+		if _, ok := schemas[ref[1]]; !ok {
+			t.Errorf("%s is referenced but not defined", ref[0])
+		}
+	}
+	var paths []string
+	for path := range doc["paths"].(map[string]interface{}) {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range []string{"/api", "/api/song/{id}", "/api/stream", "/api/v2/albums/{id}", "/api/v2/artists", "/api/v2/search", "/api/v2/songs/{id}/lyrics"} {
+		if sort.SearchStrings(paths, path) == len(paths) || paths[sort.SearchStrings(paths, path)] != path {
+			t.Errorf("%s is not documented", path)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	docsHandler(rr, httptest.NewRequest("GET", "/api/docs", nil))
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") || !bytes.Contains(rr.Body.Bytes(), []byte(`fetch("openapi.json")`)) {
+		t.Errorf("The viewer should load openapi.json")
+	}
+	if bytes.Contains(rr.Body.Bytes(), []byte("https://")) {
+		t.Errorf("The viewer should not load anything from the internet")
+	}
+}
+
+// TestOpenAPIContract Test that the responses of every endpoint follow the document
+func TestOpenAPIContract(t *testing.T) {
+	setupAPITest(t, 0)
+	root := os.Getenv("MEDIA_ROOT")
+	writeTestFile(t, root, "Alice-Rain@Spring/standard.mp3", []byte("audio"))
+	writeTestFile(t, root, "Alice-Rain@Spring/lyric.lrc", []byte("[00:00.00]la"))
+	fakeProviderSongs["contract"] = []Song{{Song: "Rain Up", Singer: "Bob", Cover: "http://fake.example/cover.jpg"}, {Song: "Song Up", Singer: "Bob"}}
+	t.Cleanup(func() { delete(fakeProviderSongs, "contract") })
+	metadata, _ := json.Marshal(Metadata{
+		API:   []API{{APIType: "fake", Sources: "contract"}, {APIType: "fake-broken", Sources: "broken"}},
+		Other: []OtherSong{{SongName: "Song Other", Singer: "Carol", MusicURL: MusicURL{Hires: "http://other.example/song.flac"}}},
+	})
+	writeTestFile(t, root, "metadata.json", metadata)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", apiHandler)
+	mux.HandleFunc("/api/stream", apiStreamHandler)
+	mux.HandleFunc("/api/song/", songHandler)
+	mux.HandleFunc("/api/v2/", apiV2Handler)
+	doc := loadOpenAPI(t)
+	request := func(target string) []byte {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		backgroundRefreshes.Wait()
+		path := strings.Split(target, "?")[0]
+		schema := responseSchema(t, doc, path, rr.Code, rr.Header().Get("Content-Type"))
+		lines := [][]byte{rr.Body.Bytes()}
+		if strings.HasPrefix(rr.Header().Get("Content-Type"), "application/x-ndjson") {
+			lines = bytes.Split(bytes.TrimSpace(rr.Body.Bytes()), []byte("\n"))
+		}
+		for _, line := range lines {
+			var value interface{}
+			if err := json.Unmarshal(line, &value); err != nil {
+				t.Fatalf("%s: cannot decode %s", target, line)
+			}
+			for _, problem := range validateSchema(doc, schema, value, "body") {
+				t.Errorf("%s: %s", target, problem)
+			}
+		}
+		return rr.Body.Bytes()
+	}
+
+	targets := []string{
+		"/api?msg=Rain", "/api?msg=Rain", "/api?msg=Song&quality=hires&page=1&page_size=2",
+		"/api", "/api?msg=%22Song", "/api?msg=Song&num=x", "/api?msg=Song&page=0", "/api?msg=Nothing",
+		"/api/stream?format=ndjson&msg=Song", "/api/stream?format=ndjson&msg=",
+		"/api/song/not-an-id", "/api/song/0123456789abcdef",
+		"/api/v2/search?q=Song", "/api/v2/search?q=Song&has_lyrics=x", "/api/v2/search",
+		"/api/v2/artists", "/api/v2/albums", "/api/v2/artists?page=0", "/api/v2/albums/0123456789abcdef",
+		"/api/v2/artists/initials", "/api/v2/albums/initials", "/api/v2/artists?initial=a", "/api/v2/albums?initial=ab",
+		"/api/v2/songs/not-an-id", "/api/v2/songs/0123456789abcdef",
+		"/api/v2/songs", "/api/v2/songs?page=0", "/api/v2/songs?initial=s&limit=1", "/api/v2/songs?initial=ab",
+	}
+	for _, target := range targets {
+		request(target)
+	}
+
+	// Follow the IDs of the results to their details
+	var songs []Song
+	for _, target := range []string{"/api?msg=Song", "/api?msg=Rain"} {
+		var search struct {
+			Data []Song `json:"data"`
+		}
+		json.Unmarshal(request(target), &search)
+		songs = append(songs, search.Data...)
+	}
+	for _, song := range songs {
+		request("/api/song/" + song.ID)
+		request("/api/v2/songs/" + song.ID)
+		request("/api/v2/songs/" + song.ID + "/lyrics")
+		if song.Source == localSource {
+			request("/api/v2/songs/" + song.ID + "/lyrics/lines")
+			request("/api/v2/songs/" + song.ID + "/lyrics/lines?t=500")
+		}
+	}
+	var artists struct {
+		Data []catalogArtist `json:"data"`
+	}
+	json.Unmarshal(request("/api/v2/artists"), &artists)
+	for _, artist := range artists.Data {
+		request("/api/v2/artists/" + artist.ID)
+		request("/api/v2/artists/" + artist.ID + "/albums")
+		request("/api/v2/artists/" + artist.ID + "/songs")
+	}
+	var albums struct {
+		Data []catalogAlbum `json:"data"`
+	}
+	json.Unmarshal(request("/api/v2/albums"), &albums)
+	for _, album := range albums.Data {
+		request("/api/v2/albums/" + album.ID)
+		request("/api/v2/albums/" + album.ID + "/songs")
+	}
+	if len(songs) != 4 || len(artists.Data) == 0 || len(albums.Data) == 0 {
+		t.Errorf("Expected songs, artists and albums to check, got %d, %d and %d", len(songs), len(artists.Data), len(albums.Data))
+	}
+}
+
+// TestOpenAPISearchParameters Test that the singer and has_lyrics filters do what the document says
+func TestOpenAPISearchParameters(t *testing.T) {
+	setupAPITest(t, 0)
+	metadata, _ := json.Marshal(Metadata{API: []API{}, Other: []OtherSong{
+		{SongName: "Rain A", Singer: "Alice Band", LyricURL: Lyric{Lrc: "http://other.example/a.lrc"}},
+		{SongName: "Rain B", Singer: "Bob"},
+		{SongName: "Rain C", Singer: "Alice"},
+	}})
+	writeTestFile(t, os.Getenv("MEDIA_ROOT"), "metadata.json", metadata)
+
+	described := map[string]string{}
+	operation := loadOpenAPI(t)["paths"].(map[string]interface{})["/api"].(map[string]interface{})["get"].(map[string]interface{})
+	for _, parameter := range asList(operation["parameters"]) {
+		parameter := parameter.(map[string]interface{})
+		described[parameter["name"].(string)], _ = parameter["description"].(string)
+	}
+
+	// An exact singer would rank "Rain C" first if singer ranked the results
+	tests := []struct {
+		param       string
+		description string
+		want        []string
+	}{
+		{"", "", []string{"Rain A", "Rain B", "Rain C"}},
+		{"singer=alice", "Only songs whose singer contains this text, the ranking does not change.", []string{"Rain A", "Rain C"}},
+		{"has_lyrics=true", "Only songs with lyrics when true, false returns every song.", []string{"Rain A"}},
+		{"has_lyrics=false", "Only songs with lyrics when true, false returns every song.", []string{"Rain A", "Rain B", "Rain C"}},
+	}
+	for _, test := range tests {
+		name, _, _ := strings.Cut(test.param, "=")
+		if name != "" && described[name] != test.description {
+			t.Errorf("%s is described as %q, the test expects %q", name, described[name], test.description)
+		}
+		_, songs := apiTestRequest(t, "/api?msg=Rain&"+test.param)
+		var names []string
+		for _, song := range songs {
+			names = append(names, song.Song)
+		}
+		if strings.Join(names, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%q: got %v, want %v", test.param, names, test.want)
+		}
+	}
+}
+
+// TestOpenAPIContractDrift Test that the contract check notices a response that does not follow the document
+func TestOpenAPIContractDrift(t *testing.T) {
+	doc := loadOpenAPI(t)
+	schema := responseSchema(t, doc, "/api", http.StatusOK, "application/json")
+	drifted := []string{
+		`{"code":0,"msg":"","data":[],"tips":"","ip":"","cache":"","cache_updating":false,"extra":1}`,
+		`{"code":0,"msg":"","data":{},"tips":"","ip":"","cache":"","cache_updating":false}`,
+		`{"code":0,"msg":"","data":[{"num":1,"song":"","singer":"","album":"","cover":"","music_url":"http://x","lyric":null}],"tips":"","ip":"","cache":"","cache_updating":false}`,
+		`{"code":9,"msg":"","data":[],"tips":"","ip":"","cache":"","cache_updating":false}`,
+		`{"code":0,"msg":"","data":[],"tips":"","ip":"","cache":""}`,
+	}
+	for _, body := range drifted {
+		var value interface{}
+		json.Unmarshal([]byte(body), &value)
+		if len(validateSchema(doc, schema, value, "body")) == 0 {
+			t.Errorf("Expected %s not to follow the document", body)
+		}
+	}
+}
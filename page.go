@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+)
+
+var errInvalidPage = errors.New("invalid pagination parameters")
+
+// A window of the search results, Limit 0 returns every song from Offset.
+type pageParams struct {
+	Offset int
+	Limit  int
+}
+
+// maxPageSize function: Return the largest page_size or limit accepted, set by API_MAX_PAGE_SIZE
+func maxPageSize() int {
+	size, err := strconv.Atoi(os.Getenv("API_MAX_PAGE_SIZE"))
+	if err != nil || size <= 0 {
+		return 100
+	}
+	return size
+}
+
+// parsePageParams function: Read page and page_size, or offset and limit, from the query string
+func parsePageParams(queryParams url.Values) (pageParams, error) {
+	atoi := func(name string, min int) (int, bool, error) {
+		value := queryParams.Get(name)
+		if value == "" {
+			return 0, false, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < min {
+			return 0, true, errInvalidPage
+		}
+		return n, true, nil
+	}
+
+	page, hasPage, err := atoi("page", 1)
+	if err != nil {
+		return pageParams{}, err
+	}
+	pageSize, hasPageSize, err := atoi("page_size", 1)
+	if err != nil {
+		return pageParams{}, err
+	}
+	offset, hasOffset, err := atoi("offset", 0)
+	if err != nil {
+		return pageParams{}, err
+	}
+	limit, hasLimit, err := atoi("limit", 1)
+	if err != nil {
+		return pageParams{}, err
+	}
+	if (hasPage || hasPageSize) && (hasOffset || hasLimit) {
+		return pageParams{}, errInvalidPage
+	}
+
+	params := pageParams{Offset: offset, Limit: limit}
+	if hasPage || hasPageSize {
+		if !hasPageSize {
+			pageSize = maxPageSize()
+		}
+		if !hasPage {
+			page = 1
+		}
+		// A page past the largest int offset cannot exist and would wrap around to a negative one
+		if page-1 > math.MaxInt/pageSize {
+			return pageParams{}, errInvalidPage
+		}
+		params = pageParams{Offset: (page - 1) * pageSize, Limit: pageSize}
+	}
+	if params.Limit > maxPageSize() {
+		params.Limit = maxPageSize()
+	}
+	return params, nil
+}
+
+// paginate function: Order songs by Num and return the requested window, Num stays the position in the full result
+func paginate(songs []Song, params pageParams) []Song {
+	sort.SliceStable(songs, func(i, j int) bool { return songs[i].Num < songs[j].Num })
+	params.Offset = max(params.Offset, 0)
+	if params.Offset >= len(songs) {
+		return []Song{}
+	}
+	songs = songs[params.Offset:]
+	if params.Limit > 0 && params.Limit < len(songs) {
+		songs = songs[:params.Limit]
+	}
+	return songs
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// TestParsePageParams Test the page/page_size and offset/limit parameters
+func TestParsePageParams(t *testing.T) {
+	t.Setenv("API_MAX_PAGE_SIZE", "50")
+	tests := []struct {
+		query string
+		want  pageParams
+		err   bool
+	}{
+		{"", pageParams{}, false},
+		{"page=2&page_size=10", pageParams{Offset: 10, Limit: 10}, false},
+		{"page=3", pageParams{Offset: 100, Limit: 50}, false},
+		{"page_size=500", pageParams{Offset: 0, Limit: 50}, false},
+		{"offset=5&limit=20", pageParams{Offset: 5, Limit: 20}, false},
+		{"offset=5", pageParams{Offset: 5}, false},
+		{"page=0", pageParams{}, true},
+		{"limit=0", pageParams{}, true},
+		{"offset=-1", pageParams{}, true},
+		{"page=a", pageParams{}, true},
+		{"page=1&limit=10", pageParams{}, true},
+		{"page=4611686018427387905&page_size=3", pageParams{}, true},
+		{"page=9223372036854775807", pageParams{}, true},
+	}
+	for _, test := range tests {
+		queryParams, _ := url.ParseQuery(test.query)
+		got, err := parsePageParams(queryParams)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("parsePageParams(%q) = %+v, %v, want %+v, error %v", test.query, got, err, test.want, test.err)
+		}
+	}
+}
+
+// Helper function to call apiHandler and decode its response
+func apiTestRequest(t *testing.T, target string) (Response, []Song) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	apiHandler(rr, httptest.NewRequest("GET", target, nil))
+	backgroundRefreshes.Wait()
+	var response Response
+	var songs []Song
+	response.Data = &songs
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Cannot decode response of %s: %s", target, err)
+	}
+	return response, songs
+}
+
+// Helper function to serve a library of "Song 1" to "Song n" from temporary directories
+func setupAPITest(t *testing.T, n int) {
+	t.Helper()
+	root := t.TempDir()
+	t.Setenv("MEDIA_ROOT", root)
+	t.Setenv("CACHE_DIR", t.TempDir())
+	t.Setenv("CACHE_REFRESH_INTERVAL", "0")
+	other := []OtherSong{}
+	for i := 1; i <= n; i++ {
+		other = append(other, OtherSong{SongName: "Song " + strconv.Itoa(i), Singer: "Singer " + strconv.Itoa(i%3)})
+	}
+	metadata, _ := json.Marshal(Metadata{API: []API{}, Other: other})
+	writeTestFile(t, root, "metadata.json", metadata)
+
+	previous := library
+	library = newLibraryIndex()
+	t.Cleanup(func() { library = previous })
+	apiCache.purge()
+	t.Cleanup(apiCache.purge)
+}
+
+// TestAPIHandlerPagination Test that pages keep Num and total on cache misses and hits
+func TestAPIHandlerPagination(t *testing.T) {
+	setupAPITest(t, 25)
+
+	for _, cached := range []bool{false, true} {
+		response, songs := apiTestRequest(t, "/api?msg=Song&page=2&page_size=10")
+		if response.Code != 0 || response.Total != 25 || len(songs) != 10 {
+			t.Fatalf("cached %v: unexpected response %+v with %d songs", cached, response, len(songs))
+		}
+		for i, song := range songs {
+			if song.Num != 11+i {
+				t.Errorf("cached %v: song %d has num %d, want %d", cached, i, song.Num, 11+i)
+			}
+		}
+		if cached && response.Cache == "no-cache" {
+			t.Errorf("The second request should be answered from the cache")
+		}
+	}
+
+	response, songs := apiTestRequest(t, "/api?msg=Song&offset=20&limit=10")
+	if response.Total != 25 || len(songs) != 5 || songs[0].Num != 21 {
+		t.Errorf("Unexpected last page: %+v %+v", response, songs)
+	}
+	response, songs = apiTestRequest(t, "/api?msg=Song&page=9&page_size=10")
+	if response.Code != 0 || response.Total != 25 || len(songs) != 0 {
+		t.Errorf("Unexpected page after the end: %+v %+v", response, songs)
+	}
+	for _, target := range []string{"/api?msg=Song&page=0", "/api?msg=Song&page=4611686018427387905&page_size=3"} {
+		if response, _ := apiTestRequest(t, target); response.Code != 4 {
+			t.Errorf("%s got code %d, want 4", target, response.Code)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Pinyin spellings of a name, empty when it has no Chinese characters.
+type pinyinForms struct {
+	Full     string // "qilixiang"
+	Initials string // "qlx"
+}
+
+// Pinyin spellings of the fields a song is searched by.
+type songPinyin struct {
+	Song   pinyinForms
+	Singer pinyinForms
+	Album  pinyinForms
+}
+
+// Map from a character to its pinyin, parsed from pinyinTable.
+var pinyinOfRune = func() map[rune]string {
+	table := map[rune]string{}
+	for _, line := range strings.Split(pinyinTable, "\n") {
+		syllable, chars, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		for _, r := range chars {
+			if _, exists := table[r]; !exists {
+				table[r] = syllable
+			}
+		}
+	}
+	return table
+}()
+
+// pinyinOf function: Spell a name in pinyin, other words are kept and contribute their first letter to the initials
+func pinyinOf(text string) pinyinForms {
+	var full, initials strings.Builder
+	hasChinese, inWord := false, false
+	for _, r := range foldText(text) {
+		if syllable, ok := pinyinOfRune[r]; ok {
+			full.WriteString(syllable)
+			initials.WriteByte(syllable[0])
+			hasChinese, inWord = true, false
+			continue
+		}
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			inWord = false
+			continue
+		}
+		full.WriteRune(r)
+		if !inWord {
+			initials.WriteRune(r)
+		}
+		inWord = true
+	}
+	if !hasChinese {
+		return pinyinForms{}
+	}
+	return pinyinForms{Full: full.String(), Initials: initials.String()}
+}
+
+// pinyinOfSong function: Spell the song, singer and album of a song in pinyin
+func pinyinOfSong(song Song) songPinyin {
+	return songPinyin{Song: pinyinOf(song.Song), Singer: pinyinOf(song.Singer), Album: pinyinOf(song.Album)}
+}
+
+// isPinyinQuery function: Report whether a normalised search term could be pinyin or initials
+func isPinyinQuery(msg string) bool {
+	if msg == "" {
+		return false
+	}
+	for _, r := range msg {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// scorePinyin function: Score how well the pinyin of a song matches the search term, 0 for terms that are not pinyin
+func (matcher *songMatcher) scorePinyin(forms songPinyin) int {
+	if !matcher.pinyin {
+		return 0
+	}
+	msg, title := matcher.msg, forms.Song
+	switch {
+	case title.Full == "" && forms.Singer.Full == "" && forms.Album.Full == "":
+		return 0
+	case title.Full == msg:
+		return scorePinyinTitle
+	case title.Initials == msg:
+		return scoreInitialsTitle
+	case title.Full != "" && (strings.HasPrefix(title.Full, msg) || strings.HasPrefix(title.Initials, msg)):
+		return scorePinyinPrefix
+	case title.Full != "" && strings.Contains(title.Full, msg):
+		return scorePinyinContains
+	}
+	for _, field := range []pinyinForms{forms.Singer, forms.Album} {
+		if field.Full != "" && (field.Full == msg || field.Initials == msg) {
+			return scorePinyinSinger
+		}
+	}
+	for _, field := range []pinyinForms{forms.Singer, forms.Album} {
+		if field.Full != "" && strings.Contains(field.Full, msg) {
+			return scorePinyinSingerContains
+		}
+	}
+	if distance, ok := matcher.fuzzyDistance(title.Full); ok {
+		return scoreTitleFuzzy - distance
+	}
+	return 0
+}
@@ -0,0 +1,397 @@
+package main
+
+// Pinyin of common simplified characters without tones, one syllable per line followed by its characters.
+// Polyphones are listed under their most common reading only, ü is written v.
+const pinyinTable = `
+a 啊阿
+ai 爱哀挨埃癌矮艾碍唉蔼隘
+an 安按暗岸案俺鞍氨
+ang 昂肮
+ao 奥傲熬袄凹敖澳
+ba 八吧把爸巴拔霸罢坝芭疤扒靶叭捌
+bai 白百摆败拜柏佰
+ban 半办班般板版伴搬扮颁斑瓣拌绊
+bang 帮棒榜膀傍磅绑谤
+bao 包保报抱宝饱暴爆薄胞豹堡雹褒苞
+bei 被北备背杯悲贝辈倍碑卑
+ben 本奔笨苯
+beng 崩绷蹦泵
+bi 比必笔逼鼻闭避彼壁币毕碧臂弊蔽鄙
+bian 边变便编遍辨鞭辩贬扁
+biao 表标彪膘
+bie 别憋鳖瘪
+bin 宾滨彬斌鬓
+bing 并病兵冰饼丙柄秉
+bo 波播博伯剥泊拨玻勃搏驳脖舶
+bu 不步部布补捕哺怖
+ca 擦
+cai 才菜彩采财猜裁材睬踩蔡
+can 参残餐惨蚕灿
+cang 藏仓苍舱沧
+cao 草操曹槽糙
+ce 侧测策册厕
+ceng 曾层蹭
+cha 查茶差插察叉茬岔诧
+chai 拆柴
+chan 产缠馋禅蝉颤铲阐
+chang 长常场唱厂尝肠畅昌偿倡敞
+chao 超朝潮吵抄炒巢嘲钞
+che 车彻撤扯澈
+chen 陈沉晨尘衬臣辰
+cheng 成城程承乘称诚撑呈橙惩澄秤丞
+chi 吃持迟池尺齿赤痴驰耻翅斥匙
+chong 冲虫宠崇充
+chou 抽愁仇丑臭筹绸稠酬
+chu 出处初除楚触储础厨雏锄橱畜
+chuai 揣
+chuan 传穿船川串喘
+chuang 窗床创闯疮
+chui 吹垂锤炊
+chun 春纯唇醇蠢
+chuo 戳
+ci 次此词辞刺瓷慈磁雌赐
+cong 从聪丛匆葱
+cou 凑
+cu 粗促醋簇
+cuan 窜
+cui 催脆翠崔摧粹
+cun 村存寸
+cuo 错措挫
+da 大打达答搭嗒
+dai 带代待袋戴呆贷怠
+dan 但单担淡蛋丹胆旦诞耽
+dang 当党档挡荡铛
+dao 到道倒刀岛导盗稻悼蹈
+de 的得德
+deng 等灯登邓瞪凳
+di 地第低底敌弟帝滴递抵笛堤迪嘀
+dian 点电店典殿垫甸惦奠颠
+diao 掉调吊钓雕
+die 跌爹叠蝶碟
+ding 定顶订丁盯钉鼎叮
+diu 丢
+dong 动东懂冬洞冻栋董咚
+dou 都斗豆抖逗陡窦
+du 度读独毒堵杜渡肚督赌镀
+duan 段短断端锻
+dui 对队堆兑
+dun 顿吨蹲盾敦
+duo 多朵夺躲堕
+e 饿恶额鹅俄蛾扼
+en 恩嗯
+er 而二儿耳尔
+fa 发法罚乏伐阀
+fan 反饭翻凡烦犯范繁番帆返泛贩
+fang 方放房防访仿芳妨纺
+fei 飞非费肥废肺菲啡匪沸
+fen 分份粉纷愤奋坟芬氛
+feng 风封丰疯峰锋奉逢缝蜂凤枫
+fo 佛
+fou 否
+fu 服父付夫福复富府副负妇扶浮幅辅腐符伏俯抚赴覆肤拂馥
+ga 嘎
+gai 该改盖概钙
+gan 感干敢赶甘肝杆竿
+gang 刚钢港岗纲缸
+gao 高告搞稿糕
+ge 个哥歌格各隔革割阁戈鸽搁
+gei 给
+gen 跟根
+geng 更耕庚
+gong 工公共功供宫攻恭弓巩贡
+gou 够狗构沟购钩勾
+gu 故古顾股鼓骨谷姑孤固雇估
+gua 挂瓜刮寡
+guai 怪乖拐
+guan 关观管官馆惯冠贯罐灌
+guang 光广逛
+gui 贵归鬼规跪轨柜桂硅瑰
+gun 滚棍
+guo 过国果锅郭裹
+ha 哈
+hai 还海孩害嗨骸
+han 喊汉含寒汗韩憾旱函涵
+hang 航杭
+hao 好号毫豪耗浩
+he 和合河喝何盒核贺荷赫
+hei 黑嘿
+hen 很恨狠痕
+heng 横恒哼衡
+hong 红洪轰哄宏虹鸿
+hou 后候厚猴喉吼
+hu 呼户湖胡护忽虎互壶糊蝴乎狐
+hua 话花化画华划滑哗
+huai 坏怀淮
+huan 换欢环缓幻患唤焕
+huang 黄慌荒皇谎晃煌恍
+hui 回会灰挥汇辉毁悔惠绘徽
+hun 婚混魂昏浑
+huo 活火或货获伙祸惑
+ji 机几及己记级极急即集计济技积基击继纪寂籍寄挤迹季既吉鸡激忌剂肌姬疾辑
+jia 家加假价架甲佳嫁夹驾
+jian 间见件建简剑渐坚减健检肩尖监兼舰践鉴键溅
+jiang 将讲江奖降姜蒋僵酱浆
+jiao 叫教交脚角较焦骄郊娇胶椒浇
+jie 街接节结姐界解借介阶洁劫揭杰戒届截
+jin 进金近今紧尽仅斤禁劲锦筋津晋
+jing 经精静京境景惊井镜敬竟净警径颈晶鲸
+jiong 窘
+jiu 就九久酒旧救究纠揪舅
+ju 局据举具句居剧拒聚巨菊距惧俱鞠
+juan 卷捐倦娟绢
+jue 觉决绝掘爵倔
+jun 军君均俊菌
+ka 卡咖
+kai 开凯慨楷
+kan 看砍刊堪坎
+kang 康抗扛慷
+kao 考靠烤
+ke 可课科刻客克颗渴壳柯棵咳
+ken 肯恳啃
+keng 坑
+kong 空孔控恐
+kou 口扣寇
+ku 苦哭库裤酷枯窟
+kua 夸跨垮
+kuai 快块筷
+kuan 宽款
+kuang 况狂矿框旷
+kui 亏愧葵溃魁
+kun 困昆捆
+kuo 扩阔括
+la 拉啦辣蜡喇
+lai 来赖莱
+lan 蓝兰懒烂栏拦篮览滥
+lang 浪狼郎朗廊
+lao 老劳牢捞姥
+le 了乐勒
+lei 泪类累雷蕾垒
+leng 冷楞
+li 里理离力历利立李礼丽例粒梨厉璃黎莉篱励
+lia 俩
+lian 连脸恋练联怜莲炼帘
+liang 两亮量凉粮梁良辆谅
+liao 料聊疗辽
+lie 烈列裂猎
+lin 林临邻淋琳
+ling 另领零灵令铃玲凌陵
+liu 六流留刘柳溜
+long 龙笼隆聋
+lou 楼漏搂
+lu 路陆录鹿卢炉露芦
+luan 乱卵
+lue 略掠
+lun 论轮伦
+luo 落罗洛萝骆
+lv 绿旅律虑率铝驴
+ma 妈马吗麻骂码嘛
+mai 买卖麦埋迈脉
+man 满慢漫蛮
+mang 忙盲茫芒
+mao 毛猫冒帽貌矛茂
+me 么
+mei 没每美妹梅眉煤媒魅玫
+men 们门闷
+meng 梦猛蒙盟萌
+mi 米密迷秘蜜谜眯弥觅咪
+mian 面免棉眠绵
+miao 秒妙苗描庙渺喵
+mie 灭
+min 民敏
+ming 明名命鸣铭
+miu 谬
+mo 末莫模磨摸魔默墨漠陌寞沫茉
+mou 某谋
+mu 木目母幕慕牧墓穆
+na 那拿哪纳娜
+nai 奶耐乃
+nan 南男难
+nang 囊
+nao 脑闹恼
+ne 呢
+nei 内
+nen 嫩
+neng 能
+ni 你泥尼逆拟腻霓
+nian 年念粘
+niang 娘
+niao 鸟尿
+nie 捏
+nin 您
+ning 宁凝
+niu 牛扭纽
+nong 农弄浓
+nu 努怒奴
+nuan 暖
+nuo 诺挪
+nv 女
+o 哦噢
+ou 欧偶
+pa 怕爬琶
+pai 派排拍牌
+pan 盼判盘攀
+pang 旁胖
+pao 跑炮泡抛
+pei 陪配培佩
+pen 喷盆
+peng 朋碰捧棚蓬
+pi 皮批屁疲匹劈啤脾琵
+pian 片篇骗偏
+piao 票漂飘
+pin 品拼贫频
+ping 平评瓶凭萍屏
+po 破坡婆迫泼
+pu 普铺扑葡朴谱
+qi 起其期气七器奇妻齐旗骑企启弃泣漆岂棋
+qia 恰
+qian 前钱千签浅欠牵潜迁谦歉
+qiang 强墙枪抢腔蔷
+qiao 桥瞧巧敲悄乔
+qie 且切窃
+qin 亲琴勤侵秦
+qing 请情青清轻晴庆倾
+qiong 穷琼
+qiu 求秋球丘囚
+qu 去取区曲趣驱屈渠
+quan 全权圈劝泉拳
+que 却确缺雀
+qun 群裙
+ran 然燃染冉
+rang 让嚷
+rao 绕扰饶
+re 热惹
+ren 人认任忍仁
+reng 仍扔
+ri 日
+rong 容荣融溶绒
+rou 肉柔揉
+ru 如入乳辱儒茹
+ruan 软
+rui 瑞锐
+run 润
+ruo 若弱
+sa 撒洒萨
+sai 赛塞
+san 三散伞
+sang 桑丧嗓
+sao 扫嫂
+se 色涩
+sen 森
+sha 沙杀傻纱
+shai 晒
+shan 山善闪扇衫删陕
+shang 上商伤赏尚
+shao 少烧稍绍勺哨韶
+she 设社蛇舍射涉摄
+shei 谁
+shen 身深神什伸甚慎审婶
+sheng 生声胜省升盛绳剩圣
+shi 是时事十使世市式师实诗始史识石失室试视士示食施湿狮逝释誓驶
+shou 手受收首守寿兽瘦授
+shu 书数树属术输熟束叔鼠舒殊述疏暑
+shua 刷耍
+shuai 帅摔衰
+shuang 双霜爽
+shui 水睡税
+shun 顺瞬
+shuo 说硕
+si 四死思私司丝似斯寺撕
+song 送松宋颂嵩
+sou 搜艘
+su 素速诉苏俗宿塑肃
+suan 算酸蒜
+sui 岁随虽碎遂
+sun 孙损笋
+suo 所索锁缩
+ta 他她它塔踏
+tai 太台态抬胎泰
+tan 谈探叹弹坦贪摊滩毯
+tang 堂唐汤躺糖趟烫
+tao 讨逃套桃淘陶涛
+te 特
+teng 疼腾藤
+ti 提体题替踢梯蹄
+tian 天田甜填添
+tiao 条跳挑
+tie 铁贴
+ting 听停庭挺亭厅
+tong 同通痛统童桶铜
+tou 头投偷透
+tu 土突图涂途徒吐兔
+tuan 团
+tui 推退腿
+tun 吞
+tuo 托脱拖妥
+wa 哇挖娃瓦袜
+wai 外歪
+wan 完万晚玩湾碗弯挽婉
+wang 望王往忘网旺亡汪
+wei 为位未围危微威伟尾卫味胃违唯维委慰魏蔚薇
+wen 问文温闻稳吻纹
+weng 翁
+wo 我握窝卧蜗喔
+wu 无五物午舞误务屋武雾污悟吴乌捂伍
+xi 西系细息希喜洗习席戏吸溪惜稀夕悉袭
+xia 下夏吓虾峡侠霞瞎
+xian 先现线限显险鲜闲仙献县嫌弦咸
+xiang 想向相香像象乡响箱详巷享
+xiao 小笑校消效晓孝萧削销
+xie 写谢些鞋协斜携邪泄
+xin 心新信辛欣薪馨
+xing 行星性形兴醒姓幸型刑杏
+xiong 兄雄胸凶熊
+xiu 修休秀袖羞锈
+xu 需许须续序虚徐蓄绪叙
+xuan 选宣悬旋玄轩
+xue 学雪血穴薛
+xun 寻训讯迅熏循
+ya 呀压牙亚鸭雅芽崖
+yan 眼言严烟演颜研燕延验岩炎盐艳沿宴
+yang 样阳养杨央洋扬仰羊痒
+yao 要药摇腰遥咬邀耀谣
+ye 也夜叶业页野爷液耶
+yi 一以已意义衣医依亿忆艺议易异移疑遗仪宜益谊译椅姨奕
+yin 因音银引印饮隐阴吟
+ying 应影英硬营迎赢映鹰樱盈萤
+yo 哟
+yong 用永勇拥涌泳
+you 有又由游友油右优幽忧犹邮悠佑
+yu 与于雨语鱼遇玉育余预域宇羽愈欲予渔愚娱裕
+yuan 远原员元院愿园圆源缘怨冤袁
+yue 月越约跃悦阅岳
+yun 云运晕允孕韵
+za 杂砸
+zai 在再载灾栽
+zan 咱赞暂
+zang 脏葬
+zao 早造遭糟澡躁
+ze 则责择泽
+zen 怎
+zeng 增赠
+zha 炸扎眨渣
+zhai 摘窄宅债
+zhan 站战展占沾斩盏
+zhang 张掌涨章丈障帐
+zhao 找照招赵召罩
+zhe 这着者折哲遮
+zhen 真阵针镇震珍枕甄
+zheng 正整争证政征睁挣
+zhi 之只知直制至指纸值志止支质智置织职枝执栀
+zhong 中种重终众钟忠肿
+zhou 周州洲粥宙皱骤
+zhu 主住注助猪竹珠祝筑逐烛朱煮驻
+zhua 抓
+zhuan 转专砖赚
+zhuang 装状庄撞壮妆
+zhui 追坠
+zhun 准
+zhuo 桌捉卓浊
+zi 自子字资紫姿
+zong 总宗纵踪
+zou 走奏
+zu 组足族租阻祖
+zuan 钻
+zui 最嘴醉罪
+zun 尊遵
+zuo 做作坐左座昨
+`
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestPinyinOf Test the full pinyin and initials of names
+func TestPinyinOf(t *testing.T) {
+	tests := map[string]pinyinForms{
+		"七里香":       {Full: "qilixiang", Initials: "qlx"},
+		"周杰倫":       {Full: "zhoujielun", Initials: "zjl"},
+		"夜曲 (Live)": {Full: "yequlive", Initials: "yql"},
+		"女儿情":       {Full: "nverqing", Initials: "neq"},
+		"Jay Chou":  {},
+		"":          {},
+	}
+	for input, want := range tests {
+		if got := pinyinOf(input); got != want {
+			t.Errorf("pinyinOf(%q) = %+v, want %+v", input, got, want)
+		}
+	}
+}
+
+// TestPinyinSearch Test that library songs and "other" songs are found by pinyin and initials
+func TestPinyinSearch(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("MEDIA_ROOT", root)
+	t.Setenv("LIBRARY_INDEX_PATH", filepath.Join(t.TempDir(), "library.json"))
+	writeTestFile(t, root, "周杰伦-七里香@七里香/standard.mp3", []byte("audio"))
+	writeTestFile(t, root, "metadata.json", []byte(`{"api":[],"other":[
+		{"song_name":"稻香","singer":"周杰伦"},
+		{"song_name":"Qi","singer":"Meow"}
+	]}`))
+	defer func(previous *libraryIndex) { library = previous }(library)
+	library = newLibraryIndex()
+
+	tests := map[string][]string{
+		"qilixiang": {"七里香"},
+		"qlx":       {"七里香"},
+		"daoxiang":  {"稻香"},
+		"zjl":       {"七里香", "稻香"},
+		"qilixaing": {"七里香"},
+		"qi":        {"Qi", "七里香"},
+	}
+	for msg, want := range tests {
+		songs := getLocalSongs(msg)
+		if len(songs) != len(want) {
+			t.Errorf("getLocalSongs(%q) = %+v, want %v", msg, songs, want)
+			continue
+		}
+		for i, song := range songs {
+			if song.Song != want[i] {
+				t.Errorf("getLocalSongs(%q)[%d] = %q, want %q", msg, i, song.Song, want[i])
+			}
+		}
+	}
+
+	// The pinyin is rebuilt for an index loaded from disk
+	if err := library.save(libraryIndexPath()); err != nil {
+		t.Fatalf("save returns error: %s", err)
+	}
+	library = newLibraryIndex()
+	if err := library.load(libraryIndexPath()); err != nil {
+		t.Fatalf("load returns error: %s", err)
+	}
+	library.refreshed = true
+	if songs := getLocalSongs("qlx"); len(songs) != 1 {
+		t.Errorf("Expected the loaded index to match initials, got %+v", songs)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+var errNotSupported = errors.New("not supported by this provider")
+
+// Provider is an upstream music source configured in the "api" list of metadata.json.
+type Provider interface {
+	// Search returns the songs of the upstream matching msg, songs found before ctx is done may be returned with its error.
+	Search(ctx context.Context, msg string) ([]Song, error)
+	// Resolve returns the music URLs of a song found by Search.
+	Resolve(ctx context.Context, song Song) (MusicURL, error)
+	// Lyrics returns the lyric URLs of a song found by Search.
+	Lyrics(ctx context.Context, song Song) (Lyric, error)
+	// Health reports whether the upstream is reachable.
+	Health(ctx context.Context) error
+}
+
+// Creates a provider for one entry of the "api" list.
+type providerFactory func(api API) Provider
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]providerFactory{}
+)
+
+func init() {
+	registerProvider("", newSameSystemProvider)
+	registerProvider("api.yuanfeng.cn", newYuafengProvider)
+}
+
+// registerProvider function: Register the provider used for an api_type of metadata.json
+func registerProvider(apiType string, factory providerFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[apiType] = factory
+}
+
+// newProvider function: Create the provider registered for the api_type of an API entry
+func newProvider(api API) (Provider, error) {
+	providersMu.RLock()
+	factory, ok := providers[api.APIType]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no provider registered for api_type %q", api.APIType)
+	}
+	return factory(api), nil
+}
+
+// Another MeowMusicServer, api_type "".
+type sameSystemProvider struct {
+	api API
+}
+
+// newSameSystemProvider function: Create a provider for an API of the same system
+func newSameSystemProvider(api API) Provider {
+	return &sameSystemProvider{api: api}
+}
+
+// Search function: Query the /api endpoint of the other server
+func (provider *sameSystemProvider) Search(ctx context.Context, msg string) ([]Song, error) {
+	apiURL, err := url.Parse(provider.api.APIURL)
+	if err != nil {
+		return nil, err
+	}
+	query := apiURL.Query()
+	if query.Get("msg") == "" {
+		query.Set("msg", msg)
+	}
+	apiURL.RawQuery = query.Encode()
+
+	body, err := getBody(ctx, apiURL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// The other server answers with the Response envelope, a bare song array is accepted as well
+	var response struct {
+		Data []Song `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		var songs []Song
+		if err := json.Unmarshal(body, &songs); err != nil {
+			return nil, err
+		}
+		response.Data = songs
+	}
+	for i := range response.Data {
+		typedSongFields(&response.Data[i])
+	}
+	return response.Data, nil
+}
+
+// Resolve function: Songs of the same system already carry their URLs
+func (provider *sameSystemProvider) Resolve(ctx context.Context, song Song) (MusicURL, error) {
+	typedSongFields(&song)
+	if musicURL, ok := song.MusicURL.(MusicURL); ok {
+		return musicURL, nil
+	}
+	return MusicURL{}, errNotSupported
+}
+
+// Lyrics function: Songs of the same system already carry their lyric URLs
+func (provider *sameSystemProvider) Lyrics(ctx context.Context, song Song) (Lyric, error) {
+	typedSongFields(&song)
+	if lyric, ok := song.Lyric.(Lyric); ok {
+		return lyric, nil
+	}
+	return Lyric{}, errNotSupported
+}
+
+// Health function: Check that the other server answers
+func (provider *sameSystemProvider) Health(ctx context.Context) error {
+	_, err := getBody(ctx, provider.api.APIURL)
+	return err
+}
+
+// getBody function: GET a URL with the upstream client and return its body
+func getBody(ctx context.Context, rawURL string) ([]byte, error) {
+	return getLimitedBody(ctx, rawURL, -1)
+}
+
+// getLimitedBody function: GET a URL with the upstream client and return its body, failing past limit bytes unless limit is negative
+func getLimitedBody(ctx context.Context, rawURL string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	release, err := upstreamRequests.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if limit < 0 {
+		return io.ReadAll(resp.Body)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err == nil && int64(len(body)) > limit {
+		return nil, fmt.Errorf("response larger than %d bytes", limit)
+	}
+	return body, err
+}
+
+// getJSON function: GET a URL with the upstream client and decode its JSON body
+func getJSON(ctx context.Context, rawURL string, v interface{}) error {
+	body, err := getBody(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
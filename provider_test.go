@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Provider answering from memory, registered as api_type "fake" so federation can be tested without network.
+type fakeProvider struct {
+	api   API
+	songs []Song
+	err   error
+}
+
+// Songs served by the fake provider, keyed by the "sources" field of the API entry.
+var fakeProviderSongs = map[string][]Song{}
+
+func init() {
+	registerProvider("fake", func(api API) Provider {
+		return &fakeProvider{api: api, songs: fakeProviderSongs[api.Sources]}
+	})
+	registerProvider("fake-broken", func(api API) Provider {
+		return &fakeProvider{api: api, err: errors.New("upstream is down")}
+	})
+}
+
+func (provider *fakeProvider) Search(ctx context.Context, msg string) ([]Song, error) {
+	if provider.err != nil {
+		return nil, provider.err
+	}
+	var songs []Song
+	for _, song := range provider.songs {
+		if strings.Contains(song.Song, msg) || strings.Contains(song.Singer, msg) || strings.Contains(song.Album, msg) {
+			songs = append(songs, song)
+		}
+	}
+	return songs, nil
+}
+
+func (provider *fakeProvider) Resolve(ctx context.Context, song Song) (MusicURL, error) {
+	if provider.err != nil {
+		return MusicURL{}, provider.err
+	}
+	return MusicURL{Standard: "http://fake.example/" + song.Song + ".mp3"}, nil
+}
+
+func (provider *fakeProvider) Lyrics(ctx context.Context, song Song) (Lyric, error) {
+	if provider.err != nil {
+		return Lyric{}, provider.err
+	}
+	return Lyric{Lrc: "http://fake.example/" + song.Song + ".lrc"}, nil
+}
+
+func (provider *fakeProvider) Health(ctx context.Context) error { return provider.err }
+
+// TestNewProvider Test the provider registry
+func TestNewProvider(t *testing.T) {
+	for _, apiType := range []string{"", "api.yuanfeng.cn", "fake"} {
+		if _, err := newProvider(API{APIType: apiType}); err != nil {
+			t.Errorf("newProvider(%q) returns error: %s", apiType, err)
+		}
+	}
+	if _, err := newProvider(API{APIType: "unknown"}); err == nil {
+		t.Errorf("newProvider(%q) should return an error", "unknown")
+	}
+}
+
+// TestAPISongHandlerOnMetadataProviders Test federation over the providers of metadata.json
+func TestAPISongHandlerOnMetadataProviders(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("MEDIA_ROOT", root)
+	fakeProviderSongs["a"] = []Song{{Song: "Sunny", Singer: "A"}, {Song: "Rainy", Singer: "A"}}
+	fakeProviderSongs["b"] = []Song{{Song: "Sunny Day", Singer: "B"}}
+	defer delete(fakeProviderSongs, "a")
+	defer delete(fakeProviderSongs, "b")
+	writeTestFile(t, root, "metadata.json", []byte(`{
+		"api": [
+			{"api_type": "fake", "sources": "a"},
+			{"api_type": "fake-broken"},
+			{"api_type": "unknown"},
+			{"api_type": "fake", "sources": "b"}
+		],
+		"other": [{"song_name": "Sunny Local", "singer": "C"}]
+	}`))
+
+	songs := apiSongHandlerOnMetadata("Sunny")
+	want := []string{"Sunny Local", "Sunny", "Sunny Day"}
+	if len(songs) != len(want) {
+		t.Fatalf("Expected %d songs, got %d: %+v", len(want), len(songs), songs)
+	}
+	for i, song := range songs {
+		if song.Song != want[i] || song.Num != i+1 {
+			t.Errorf("Song %d: got %q num %d, want %q num %d", i, song.Song, song.Num, want[i], i+1)
+		}
+	}
+}
+
+// TestSameSystemProvider Test the provider for another MeowMusicServer
+func TestSameSystemProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Response{
+			Code: 0,
+			Data: []Song{{Num: 7, Song: r.URL.Query().Get("msg"), MusicURL: MusicURL{Standard: "http://other/standard.mp3"}}},
+		})
+	}))
+	defer server.Close()
+
+	provider, err := newProvider(API{APIURL: server.URL + "/api"})
+	if err != nil {
+		t.Fatalf("newProvider returns error: %s", err)
+	}
+	songs, err := provider.Search(context.Background(), "晴天")
+	if err != nil {
+		t.Fatalf("Search returns error: %s", err)
+	}
+	if len(songs) != 1 || songs[0].Song != "晴天" {
+		t.Fatalf("Unexpected songs: %+v", songs)
+	}
+	musicURL, err := provider.Resolve(context.Background(), songs[0])
+	if err != nil || musicURL.Standard != "http://other/standard.mp3" {
+		t.Errorf("Unexpected Resolve result: %+v (%v)", musicURL, err)
+	}
+	if err := provider.Health(context.Background()); err != nil {
+		t.Errorf("Health returns error: %s", err)
+	}
+}
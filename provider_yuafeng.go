@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// 枫雨API, api_type "api.yuanfeng.cn".
+type yuafengProvider struct {
+	api API
+}
+
+// newYuafengProvider function: Create a provider for 枫雨API
+func newYuafengProvider(api API) Provider {
+	return &yuafengProvider{api: api}
+}
+
+// Search function: Query 枫雨API and keep the songs matching msg
+func (provider *yuafengProvider) Search(ctx context.Context, msg string) ([]Song, error) {
+	var songs []Song
+	matcher := newSongMatcher(msg)
+	for _, otherSong := range YuafengAPIResponseHandler(ctx, provider.api.APIKey, msg, provider.api.Sources) {
+		song := Song{
+			Num:      0, // Initialize Num to 0
+			Song:     otherSong.SongName,
+			Singer:   otherSong.Singer,
+			Album:    otherSong.Album,
+			Cover:    otherSong.Cover,
+			MusicURL: otherSong.MusicURL,
+			Lyric:    otherSong.LyricURL,
+		}
+		// Check if the song matches the msg, the same way local songs are matched
+		if matcher.score(song) > 0 {
+			songs = append(songs, song)
+		}
+	}
+	return songs, ctx.Err()
+}
+
+// Resolve function: Return the URLs found by Search, or search the song again to get them
+func (provider *yuafengProvider) Resolve(ctx context.Context, song Song) (MusicURL, error) {
+	if musicURL, ok := song.MusicURL.(MusicURL); ok && musicURL != (MusicURL{}) {
+		return musicURL, nil
+	}
+	songs, err := provider.Search(ctx, song.Song)
+	if err != nil {
+		return MusicURL{}, err
+	}
+	for _, found := range songs {
+		if found.Song == song.Song && found.Singer == song.Singer {
+			return found.MusicURL.(MusicURL), nil
+		}
+	}
+	return MusicURL{}, fmt.Errorf("song %q not found on 枫雨API", song.Song)
+}
+
+// Lyrics function: 枫雨API free sources do not provide lyric URLs
+func (provider *yuafengProvider) Lyrics(ctx context.Context, song Song) (Lyric, error) {
+	return Lyric{}, errNotSupported
+}
+
+// Health function: Check that the source of 枫雨API answers
+func (provider *yuafengProvider) Health(ctx context.Context) error {
+	sourceURL := yuafengSourceURL(provider.api.Sources)
+	if sourceURL == "" {
+		return fmt.Errorf("unknown 枫雨API source %q", provider.api.Sources)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", sourceURL, nil)
+	if err != nil {
+		return err
+	}
+	release, err := upstreamRequests.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Base URL of 枫雨API.
+var yuafengBaseURL = "https://api.yuafeng.cn"
+
+// yuafengSourceURL function: Return the free API URL of a 枫雨API source
+func yuafengSourceURL(sources string) string {
+	switch sources {
+	case "kuwo":
+		return yuafengBaseURL + "/API/ly/kwmusic.php"
+	case "netease":
+		return yuafengBaseURL + "/API/ly/wymusic.php"
+	case "migu":
+		return yuafengBaseURL + "/API/ly/mgmusic.php"
+	case "baidu":
+		return yuafengBaseURL + "/API/ly/bdmusic.php"
+	default:
+		return ""
+	}
+}
+
+type YuafengAPIFreeResponse struct {
+	Code int `json:"code"`
+	Data []struct {
+		Num       int    `json:"num"`
+		Song      string `json:"song"`
+		Singer    string `json:"singer"`
+		Cover     string `json:"cover"`
+		AlbumName string `json:"album_name"`
+	} `json:"data"`
+}
+
+type YuafengAPIFreeSingleResponse struct {
+	Code int `json:"code"`
+	Data struct {
+		Song      string `json:"song"`
+		Singer    string `json:"singer"`
+		Cover     string `json:"cover"`
+		AlbumName string `json:"album_name"`
+		Music     string `json:"music"`
+		Lyric     string `json:"lyric"`
+	} `json:"data"`
+}
+
+type YuafengAPIQSResponse struct {
+	Code int `json:"code"`
+	Data []struct {
+		Song     string `json:"song"`
+		Singer   string `json:"singer"`
+		Cover    string `json:"cover"`
+		Audition string `json:"music_low"`
+		Standard string `json:"music_high"`
+		Lyric    string `json:"lyric"`
+	} `json:"data"`
+}
+
+// 枫雨API response handler, the format lookups of every result run concurrently within FANOUT_WORKERS until ctx is done.
+func YuafengAPIResponseHandler(ctx context.Context, key string, msg string, sources string) []OtherSong {
+	var songs []OtherSong
+	if key == "" {
+		sourceURL := yuafengSourceURL(sources)
+		if sourceURL == "" {
+			return []OtherSong{}
+		}
+		var response YuafengAPIFreeResponse
+		if err := getJSON(ctx, sourceURL+"?msg="+url.QueryEscape(msg), &response); err != nil {
+			fmt.Println("Error fetching the data form Yuafeng free API:", err)
+			return []OtherSong{}
+		}
+		maxNum := 0
+		for _, item := range response.Data {
+			if item.Num > maxNum {
+				maxNum = item.Num
+			}
+		}
+		if maxNum > len(response.Data) {
+			maxNum = len(response.Data)
+		}
+
+		// One lookup per result and format, a slow lookup only loses its own quality.
+		// They share the FANOUT_WORKERS request slots with the other providers.
+		formats := []string{"LQ", "PQ", "HQ", "SQ"}
+		musicURLs := make([]MusicURL, maxNum)
+		var mu sync.Mutex
+		forEachConcurrent(maxNum*len(formats), func(job int) {
+			i, format := job/len(formats)+1, formats[job%len(formats)]
+			singleUrl := sourceURL + "?msg=" + url.QueryEscape(msg) + "&n=" + strconv.Itoa(i) + "&format=" + format
+			var singleResponse YuafengAPIFreeSingleResponse
+			if err := getJSON(ctx, singleUrl, &singleResponse); err != nil {
+				fmt.Println("Error fetching the data form Yuafeng free API:", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			switch format {
+			case "LQ":
+				musicURLs[i-1].Audition = singleResponse.Data.Music
+			case "PQ":
+				musicURLs[i-1].Standard = singleResponse.Data.Music
+			case "HQ":
+				musicURLs[i-1].Highquality = singleResponse.Data.Music
+			case "SQ":
+				musicURLs[i-1].Superquality = singleResponse.Data.Music
+			}
+		})
+
+		mu.Lock()
+		defer mu.Unlock()
+		for i, musicURL := range musicURLs {
+			item := response.Data[i]
+			// Check if the song data is valid before appending to songs
+			if item.Song != "" && item.Singer != "" && item.AlbumName != "" && item.Cover != "" && (musicURL.Audition != "" || musicURL.Standard != "" || musicURL.Highquality != "" || musicURL.Superquality != "") {
+				songs = append(songs, OtherSong{
+					SongName: item.Song,
+					Singer:   item.Singer,
+					Album:    item.AlbumName,
+					Cover:    item.Cover,
+					MusicURL: musicURL,
+				})
+			}
+		}
+	} //else {
+	//url := "https://api-v2.yuafeng.cn/API/"
+	//if sources == "qsmusic" {
+	//resp, err := http.Get(url + "?key=" + key + "&msg=" + msg)
+	//} else {
+	// No other resource support has been provided temporarily.
+	//return []OtherSong{}
+	//}
+	return songs
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fields a search term can be scoped to with "field:value".
+var searchFields = map[string]string{
+	"song":   "song",
+	"title":  "song",
+	"singer": "singer",
+	"artist": "singer",
+	"album":  "album",
+}
+
+// One term of a search query, Field is empty for terms matched against song, singer and album.
+type searchTerm struct {
+	Field  string
+	Text   string // normalised
+	Negate bool
+}
+
+// A parsed /api search query such as `singer:周杰伦 album:叶惠美 晴天 -live`.
+type searchQuery struct {
+	Text      string       // words searched for by the matcher and by providers, one scoped value without free words
+	terms     []searchTerm // field and negated terms every song must satisfy
+	termsOnly bool         // no free words, a song satisfying the terms matches without scoring Text
+	matcher   *songMatcher
+}
+
+// A search query that cannot be parsed, shown to the client.
+type queryError struct {
+	reason string
+}
+
+func (err *queryError) Error() string {
+	return err.reason
+}
+
+// parseSearchQuery function: Parse scoped terms, quoted phrases and negations, a query without them searches as before
+func parseSearchQuery(msg string) (*searchQuery, error) {
+	search := &searchQuery{}
+	var words []string
+	fieldWords := map[string][]string{}
+	rest := strings.TrimSpace(msg)
+	for rest != "" {
+		var word string
+		word, rest = cutSearchWord(rest)
+
+		negate := false
+		if len(word) > 1 && word[0] == '-' {
+			negate, word = true, word[1:]
+		}
+		field := ""
+		if name, value, ok := strings.Cut(word, ":"); ok {
+			// Unknown prefixes are kept as text, so titles like "Re:Zero" still match
+			if scoped, known := searchFields[strings.ToLower(name)]; known {
+				field, word = scoped, value
+				if word == "" {
+					return nil, &queryError{fmt.Sprintf("'%s:' needs a value", name)}
+				}
+			}
+		}
+		phrase, err := unquoteSearchWord(word)
+		if err != nil {
+			return nil, err
+		}
+
+		text := normaliseText(phrase)
+		switch {
+		case text == "":
+			// Punctuation such as the dash of "Artist - Song" matches anything
+			if field != "" {
+				return nil, &queryError{fmt.Sprintf("'%s' has nothing to match", word)}
+			}
+		case negate:
+			search.terms = append(search.terms, searchTerm{Field: field, Text: text, Negate: true})
+		case field != "":
+			search.terms = append(search.terms, searchTerm{Field: field, Text: text})
+			fieldWords[field] = append(fieldWords[field], phrase)
+		default:
+			words = append(words, phrase)
+		}
+	}
+
+	if len(words) == 0 && len(fieldWords) == 0 {
+		return nil, &queryError{"at least one term to search for is required"}
+	}
+	search.Text = strings.Join(words, " ")
+	search.matcher = newSongMatcher(search.Text)
+	// A query of scoped terms only matches songs satisfying them, providers are asked for one value and their songs filtered by the rest
+	if len(words) == 0 {
+		search.termsOnly = true
+		for _, field := range []string{"song", "album", "singer"} {
+			if len(fieldWords[field]) > 0 {
+				search.Text = fieldWords[field][0]
+				break
+			}
+		}
+	}
+	return search, nil
+}
+
+// Helper function to split the next word off a query, quoted phrases are one word
+func cutSearchWord(query string) (string, string) {
+	inQuote := false
+	for i, r := range query {
+		switch {
+		case r == '"' || r == '“' || r == '”':
+			inQuote = !inQuote
+		case r == ' ' && !inQuote:
+			return query[:i], strings.TrimLeft(query[i:], " ")
+		}
+	}
+	return query, ""
+}
+
+// Helper function to remove the quotes around a phrase
+func unquoteSearchWord(word string) (string, error) {
+	if !strings.ContainsAny(word, `"“”`) {
+		return word, nil
+	}
+	phrase, opened := strings.CutPrefix(word, `"`)
+	if !opened {
+		phrase, opened = strings.CutPrefix(word, "“")
+	}
+	phrase, closed := strings.CutSuffix(phrase, `"`)
+	if !closed {
+		phrase, closed = strings.CutSuffix(phrase, "”")
+	}
+	if !opened || !closed || strings.ContainsAny(phrase, `"“”`) {
+		return "", &queryError{fmt.Sprintf("unterminated or misplaced quote in %s", word)}
+	}
+	return phrase, nil
+}
+
+// matches function: Report whether a song satisfies every field and negated term
+func (search *searchQuery) matches(song Song, pinyin songPinyin) bool {
+	for _, term := range search.terms {
+		if search.termMatches(term, song, pinyin) == term.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Helper function to check one term against the fields it is scoped to, by text or by pinyin
+func (search *searchQuery) termMatches(term searchTerm, song Song, pinyin songPinyin) bool {
+	fields := map[string]struct {
+		text   string
+		pinyin pinyinForms
+	}{
+		"song":   {song.Song, pinyin.Song},
+		"singer": {song.Singer, pinyin.Singer},
+		"album":  {song.Album, pinyin.Album},
+	}
+	for name, field := range fields {
+		if term.Field != "" && term.Field != name {
+			continue
+		}
+		if strings.Contains(normaliseText(field.text), term.Text) {
+			return true
+		}
+		if isPinyinQuery(term.Text) && field.pinyin.Full != "" &&
+			(strings.Contains(field.pinyin.Full, term.Text) || field.pinyin.Initials == term.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+// score function: Score a song against the query, 0 when it does not satisfy a term or the words
+func (search *searchQuery) score(song Song, pinyin songPinyin) int {
+	if !search.matches(song, pinyin) {
+		return 0
+	}
+	if search.termsOnly {
+		return scoreScopedTerms
+	}
+	return max(search.matcher.score(song), search.matcher.scorePinyin(pinyin))
+}
+
+// allows function: Report whether a provider's song satisfies every term, pinyin is only spelled when terms need it
+func (search *searchQuery) allows(song Song) bool {
+	if len(search.terms) == 0 {
+		return true
+	}
+	return search.matches(song, pinyinOfSong(song))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestParseSearchQuery Test scoped terms, quoted phrases and negations
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		msg   string
+		text  string
+		terms []searchTerm
+	}{
+		{"晴天", "晴天", nil},
+		{"Take On Me - a-ha", "Take On Me a-ha", nil},
+		{"Re:Zero", "Re:Zero", nil},
+		{"singer:周杰伦 album:叶惠美 晴天", "晴天", []searchTerm{{Field: "singer", Text: "周杰伦"}, {Field: "album", Text: "叶惠美"}}},
+		{"Artist:Jay", "Jay", []searchTerm{{Field: "singer", Text: "jay"}}},
+		{`"Bohemian Rhapsody" -live`, "Bohemian Rhapsody", []searchTerm{{Text: "live", Negate: true}}},
+		{`singer:"Jay Chou" -album:“范特西”`, "Jay Chou", []searchTerm{{Field: "singer", Text: "jaychou"}, {Field: "album", Text: "范特西", Negate: true}}},
+		{"晴天 -", "晴天", nil},
+		{"singer:Jay album:Fantasy", "Fantasy", []searchTerm{{Field: "singer", Text: "jay"}, {Field: "album", Text: "fantasy"}}},
+	}
+	for _, test := range tests {
+		search, err := parseSearchQuery(test.msg)
+		if err != nil {
+			t.Errorf("parseSearchQuery(%q) failed: %s", test.msg, err)
+			continue
+		}
+		if search.Text != test.text || !reflect.DeepEqual(search.terms, test.terms) {
+			t.Errorf("parseSearchQuery(%q) = %q %+v, want %q %+v", test.msg, search.Text, search.terms, test.text, test.terms)
+		}
+	}
+
+	for _, msg := range []string{`"晴天`, `晴"天"`, "singer:", `album:""`, "-live", "-singer:周杰伦 -晴天"} {
+		if _, err := parseSearchQuery(msg); err == nil {
+			t.Errorf("parseSearchQuery(%q) should fail", msg)
+		}
+	}
+}
+
+// TestSearchQueryMatches Test that terms match their own field, by text or by pinyin
+func TestSearchQueryMatches(t *testing.T) {
+	song := Song{Song: "晴天", Singer: "周杰伦", Album: "叶惠美"}
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{"singer:周杰伦 晴天", true},
+		{"singer:周杰倫 晴天", true},
+		{"singer:zjl 晴天", true},
+		{"singer:叶惠美 晴天", false},
+		{"album:叶惠美 晴天", true},
+		{"song:晴天", true},
+		{"晴天 -周杰伦", false},
+		{"晴天 -album:范特西", true},
+		{"晴天 -singer:jielun", false},
+		{"singer:周杰伦 album:叶惠美", true},
+		{"singer:zjl album:叶惠美 song:晴", true},
+		{"singer:周杰伦 album:范特西", false},
+		{"singer:周杰伦 -album:叶惠美", false},
+	}
+	for _, test := range tests {
+		search, err := parseSearchQuery(test.msg)
+		if err != nil {
+			t.Fatalf("parseSearchQuery(%q) failed: %s", test.msg, err)
+		}
+		if got := search.score(song, pinyinOfSong(song)) > 0; got != test.want {
+			t.Errorf("%q matches %v, want %v", test.msg, got, test.want)
+		}
+	}
+}
+
+// TestAPIHandlerSearchQuery Test the query syntax on local and provider songs, and the error of malformed queries
+func TestAPIHandlerSearchQuery(t *testing.T) {
+	setupAPITest(t, 0)
+	fakeProviderSongs["query"] = []Song{
+		{Song: "晴天", Singer: "周杰伦", Album: "叶惠美 (Live)"},
+		{Song: "晴天", Singer: "孙燕姿", Album: "风筝"},
+	}
+	t.Cleanup(func() { delete(fakeProviderSongs, "query") })
+	metadata, _ := json.Marshal(Metadata{
+		API: []API{{APIType: "fake", Sources: "query"}},
+		Other: []OtherSong{
+			{SongName: "晴天", Singer: "周杰伦", Album: "叶惠美"},
+			{SongName: "晴天", Singer: "五月天", Album: "神的孩子都在跳舞"},
+			{SongName: "晴天娃娃", Singer: "周杰伦", Album: "范特西"},
+		},
+	})
+	writeTestFile(t, os.Getenv("MEDIA_ROOT"), "metadata.json", metadata)
+
+	tests := []struct {
+		msg  string
+		miss []string
+		hit  []string
+	}{
+		{"singer:周杰伦 晴天", []string{"晴天 周杰伦", "晴天娃娃 周杰伦"}, []string{"晴天 周杰伦", "晴天娃娃 周杰伦", "晴天 周杰伦"}},
+		{"singer:周杰伦 album:叶惠美 晴天", []string{"晴天 周杰伦"}, []string{"晴天 周杰伦", "晴天 周杰伦"}},
+		{`"晴天" -周杰伦`, []string{"晴天 五月天"}, []string{"晴天 五月天", "晴天 孙燕姿"}},
+		{"晴天 -album:live -singer:五月天", []string{"晴天 周杰伦", "晴天娃娃 周杰伦"}, []string{"晴天 周杰伦", "晴天娃娃 周杰伦", "晴天 孙燕姿"}},
+		{"singer:孙燕姿", nil, []string{"晴天 孙燕姿"}},
+		{"singer:周杰伦 album:叶惠美", []string{"晴天 周杰伦"}, []string{"晴天 周杰伦", "晴天 周杰伦"}},
+		{"singer:周杰伦 album:范特西", []string{"晴天娃娃 周杰伦"}, []string{"晴天娃娃 周杰伦"}},
+	}
+	for _, test := range tests {
+		for _, want := range [][]string{test.miss, test.hit} {
+			response, songs := apiTestRequest(t, "/api?msg="+url.QueryEscape(test.msg))
+			var got []string
+			for _, song := range songs {
+				got = append(got, song.Song+" "+song.Singer)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%q (cache %s): got %v, want %v", test.msg, response.Cache, got, want)
+			}
+		}
+	}
+
+	for _, msg := range []string{`"晴天`, "singer:", "-晴天"} {
+		if response, _ := apiTestRequest(t, "/api?msg="+url.QueryEscape(msg)); response.Code != 5 {
+			t.Errorf("%q got code %d %q, want 5", msg, response.Code, response.Msg)
+		}
+	}
+}
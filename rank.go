@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Relevance of a song to a search term, higher is better and 0 does not match.
+const (
+	scoreExactTitle           = 100
+	scoreTitlePrefix          = 80
+	scorePinyinTitle          = 70
+	scoreInitialsTitle        = 65
+	scoreTitleToken           = 60
+	scorePinyinPrefix         = 55
+	scoreTitleContains        = 50
+	scoreScopedTerms          = 50 // Every song satisfying a query of scoped terms only
+	scorePinyinContains       = 45
+	scoreSingerExact          = 40
+	scorePinyinSinger         = 38 // Pinyin or initials of the singer or album
+	scoreAlbumExact           = 35
+	scoreSingerAlbum          = 30
+	scorePinyinSingerContains = 28
+	scoreTitleFuzzy           = 20 // Less the number of typos
+	scoreSingerFuzzy          = 10 // Less the number of typos, singer or album
+	scoreUpstream             = 1  // Upstream results matched by the provider itself
+)
+
+// A search result waiting to be ranked.
+type rankedSong struct {
+	song   Song
+	score  int
+	weight float64
+	local  bool
+	order  int // Position before ranking, keeps ties stable
+}
+
+// searchLocalFirst function: Report whether local songs are always ranked before upstream ones, set by SEARCH_LOCAL_FIRST
+func searchLocalFirst() bool {
+	localFirst, err := strconv.ParseBool(os.Getenv("SEARCH_LOCAL_FIRST"))
+	if err != nil {
+		return true
+	}
+	return localFirst
+}
+
+// searchLocalWeight function: Return the weight of local songs against provider weights, set by SEARCH_LOCAL_WEIGHT
+func searchLocalWeight() float64 {
+	weight, err := strconv.ParseFloat(os.Getenv("SEARCH_LOCAL_WEIGHT"), 64)
+	if err != nil || weight <= 0 {
+		return 1
+	}
+	return weight
+}
+
+// providerWeight function: Return the ranking weight of a provider, its "weight" in metadata.json
+func providerWeight(api API) float64 {
+	if api.Weight <= 0 {
+		return 1
+	}
+	return api.Weight
+}
+
+// searchTokens function: Split a folded text into words
+func searchTokens(text string) []string {
+	return strings.FieldsFunc(foldText(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// matchScore function: Score how well a song matches a search term
+func matchScore(song Song, msg string) int {
+	return newSongMatcher(msg).score(song)
+}
+
+// score function: Score how well a song matches the search term, comparing normalised forms
+func (matcher *songMatcher) score(song Song) int {
+	if matcher.msg == "" {
+		return 0
+	}
+	title, singer, album := normaliseText(song.Song), normaliseText(song.Singer), normaliseText(song.Album)
+	switch {
+	case title == matcher.msg:
+		return scoreExactTitle
+	case strings.HasPrefix(title, matcher.msg):
+		return scoreTitlePrefix
+	case tokensMatch(searchTokens(song.Song), matcher.tokens):
+		return scoreTitleToken
+	case strings.Contains(title, matcher.msg):
+		return scoreTitleContains
+	case singer == matcher.msg:
+		return scoreSingerExact
+	case album == matcher.msg:
+		return scoreAlbumExact
+	case strings.Contains(singer, matcher.msg) || strings.Contains(album, matcher.msg):
+		return scoreSingerAlbum
+	}
+
+	// Typo tolerant matches rank below every exact one
+	if distance, ok := matcher.fuzzyDistance(title); ok {
+		return scoreTitleFuzzy - distance
+	}
+	best := 0
+	for _, field := range []string{singer, album} {
+		if distance, ok := matcher.fuzzyDistance(field); ok {
+			best = max(best, scoreSingerFuzzy-distance)
+		}
+	}
+	return best
+}
+
+// Helper function to check that every word of the search term is a word of the title
+func tokensMatch(titleTokens []string, msgTokens []string) bool {
+	if len(msgTokens) == 0 {
+		return false
+	}
+	words := map[string]bool{}
+	for _, token := range titleTokens {
+		words[token] = true
+	}
+	for _, token := range msgTokens {
+		if !words[token] {
+			return false
+		}
+	}
+	return true
+}
+
+// rankSongs function: Order results by local preference, weighted score and original position, then number them from 1
+func rankSongs(candidates []rankedSong) []Song {
+	localFirst := searchLocalFirst()
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if localFirst && a.local != b.local {
+			return a.local
+		}
+		if scoreA, scoreB := float64(a.score)*a.weight, float64(b.score)*b.weight; scoreA != scoreB {
+			return scoreA > scoreB
+		}
+		return a.order < b.order
+	})
+	songs := make([]Song, 0, len(candidates))
+	for i, candidate := range candidates {
+		candidate.song.Num = i + 1
+		songs = append(songs, candidate.song)
+	}
+	return songs
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestMatchScore Test that exact titles rank above prefixes, title words, singers and albums
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		song Song
+		msg  string
+		want int
+	}{
+		{Song{Song: "Sunny"}, "sunny", scoreExactTitle},
+		{Song{Song: "Sunny Day"}, "Sunny", scoreTitlePrefix},
+		{Song{Song: "Day Sunny"}, "sunny day", scoreTitleToken},
+		{Song{Song: "A Sunnyday"}, "sunny", scoreTitleContains},
+		{Song{Song: "Rain", Singer: "Sunny"}, "sunny", scoreSingerExact},
+		{Song{Song: "Rain", Album: "Sunny"}, "sunny", scoreAlbumExact},
+		{Song{Song: "Rain", Singer: "Sunny Boys"}, "sunny", scoreSingerAlbum},
+		{Song{Song: "Rain", Album: "Sunny Days"}, "sunny", scoreSingerAlbum},
+		{Song{Song: "Rain", Singer: "Cloud"}, "sunny", 0},
+		{Song{Song: "Sunny"}, "", 0},
+	}
+	for _, test := range tests {
+		if got := matchScore(test.song, test.msg); got != test.want {
+			t.Errorf("matchScore(%+v, %q) = %d, want %d", test.song, test.msg, got, test.want)
+		}
+	}
+
+	// The kinds of match keep their order whatever the constants are
+	order := []int{scoreExactTitle, scoreTitlePrefix, scoreTitleToken, scoreTitleContains, scoreSingerExact, scoreAlbumExact, scoreSingerAlbum, scoreTitleFuzzy, scoreUpstream}
+	for i := 1; i < len(order); i++ {
+		if order[i-1] <= order[i] {
+			t.Errorf("Score %d should be above %d", order[i-1], order[i])
+		}
+	}
+}
+
+// TestRankSongs Test local preference, weighted scores and the stable order of ties
+func TestRankSongs(t *testing.T) {
+	candidates := func() []rankedSong {
+		return []rankedSong{
+			{song: Song{Song: "Local Prefix"}, score: scoreTitlePrefix, weight: 1, local: true, order: 0},
+			{song: Song{Song: "Local Singer"}, score: scoreSingerExact, weight: 1, local: true, order: 1},
+			{song: Song{Song: "Upstream Exact"}, score: scoreExactTitle, weight: 1, order: 2},
+			{song: Song{Song: "Upstream Prefix A"}, score: scoreTitlePrefix, weight: 1, order: 3},
+			{song: Song{Song: "Upstream Prefix B"}, score: scoreTitlePrefix, weight: 1.5, order: 4},
+			{song: Song{Song: "Upstream Prefix C"}, score: scoreTitlePrefix, weight: 1, order: 5},
+		}
+	}
+	tests := []struct {
+		localFirst string
+		want       []string
+	}{
+		{"", []string{"Local Prefix", "Local Singer", "Upstream Prefix B", "Upstream Exact", "Upstream Prefix A", "Upstream Prefix C"}},
+		{"true", []string{"Local Prefix", "Local Singer", "Upstream Prefix B", "Upstream Exact", "Upstream Prefix A", "Upstream Prefix C"}},
+		{"false", []string{"Upstream Prefix B", "Upstream Exact", "Local Prefix", "Upstream Prefix A", "Upstream Prefix C", "Local Singer"}},
+	}
+	for _, test := range tests {
+		t.Setenv("SEARCH_LOCAL_FIRST", test.localFirst)
+		var got []string
+		for i, song := range rankSongs(candidates()) {
+			got = append(got, song.Song)
+			if song.Num != i+1 {
+				t.Errorf("SEARCH_LOCAL_FIRST=%q: %q has num %d, want %d", test.localFirst, song.Song, song.Num, i+1)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SEARCH_LOCAL_FIRST=%q: got %v, want %v", test.localFirst, got, test.want)
+		}
+	}
+}
+
+// TestRankingWeights Test SEARCH_LOCAL_WEIGHT and the "weight" of providers
+func TestRankingWeights(t *testing.T) {
+	weights := map[string]float64{"": 1, "2.5": 2.5, "0": 1, "-1": 1, "heavy": 1}
+	for value, want := range weights {
+		t.Setenv("SEARCH_LOCAL_WEIGHT", value)
+		if got := searchLocalWeight(); got != want {
+			t.Errorf("SEARCH_LOCAL_WEIGHT=%q: got %v, want %v", value, got, want)
+		}
+	}
+	for weight, want := range map[float64]float64{0: 1, -2: 1, 0.5: 0.5, 3: 3} {
+		if got := providerWeight(API{Weight: weight}); got != want {
+			t.Errorf("providerWeight(%v) = %v, want %v", weight, got, want)
+		}
+	}
+	for value, want := range map[string]bool{"": true, "true": true, "0": false, "false": false, "maybe": true} {
+		t.Setenv("SEARCH_LOCAL_FIRST", value)
+		if got := searchLocalFirst(); got != want {
+			t.Errorf("SEARCH_LOCAL_FIRST=%q: got %v, want %v", value, got, want)
+		}
+	}
+}
+
+// TestAPISongHandlerOnMetadataRanking Test that provider weights break ties and local songs can be mixed in
+func TestAPISongHandlerOnMetadataRanking(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("MEDIA_ROOT", root)
+	previous := library
+	library = newLibraryIndex()
+	t.Cleanup(func() { library = previous })
+	fakeProviderSongs["light"] = []Song{{Song: "Sunny", Singer: "Light"}, {Song: "Sunny Day", Singer: "Light"}}
+	fakeProviderSongs["heavy"] = []Song{{Song: "Sunny", Singer: "Heavy"}}
+	defer delete(fakeProviderSongs, "light")
+	defer delete(fakeProviderSongs, "heavy")
+	writeTestFile(t, root, "metadata.json", []byte(`{
+		"api": [
+			{"api_type": "fake", "sources": "light"},
+			{"api_type": "fake", "sources": "heavy", "weight": 2}
+		],
+		"other": [{"song_name": "Sunny Local Mix", "singer": "Local"}]
+	}`))
+
+	tests := []struct {
+		localFirst  string
+		localWeight string
+		want        []string
+	}{
+		{"true", "1", []string{"Sunny Local Mix Local", "Sunny Heavy", "Sunny Light", "Sunny Day Light"}},
+		{"false", "1", []string{"Sunny Heavy", "Sunny Light", "Sunny Local Mix Local", "Sunny Day Light"}},
+		{"false", "3", []string{"Sunny Local Mix Local", "Sunny Heavy", "Sunny Light", "Sunny Day Light"}},
+	}
+	for _, test := range tests {
+		t.Setenv("SEARCH_LOCAL_FIRST", test.localFirst)
+		t.Setenv("SEARCH_LOCAL_WEIGHT", test.localWeight)
+		var got []string
+		for _, song := range apiSongHandlerOnMetadata("Sunny") {
+			got = append(got, song.Song+" "+song.Singer)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SEARCH_LOCAL_FIRST=%s SEARCH_LOCAL_WEIGHT=%s: got %v, want %v", test.localFirst, test.localWeight, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An in-flight refresh, waited on by every caller of the same key.
+type refreshCall struct {
+	wg    sync.WaitGroup
+	songs []Song
+}
+
+// Coalesces cache refreshes so each key is refreshed by one goroutine at a time, and not more often than minInterval.
+type refreshGroup struct {
+	mu          sync.Mutex
+	calls       map[string]*refreshCall
+	last        map[string]time.Time
+	minInterval func() time.Duration
+}
+
+// The refresh group used by apiHandler.
+var cacheRefreshes = newRefreshGroup(cacheRefreshInterval)
+
+// Background refreshes still running, waited for on shutdown.
+var backgroundRefreshes sync.WaitGroup
+
+// newRefreshGroup function: Create an empty refresh group
+func newRefreshGroup(minInterval func() time.Duration) *refreshGroup {
+	return &refreshGroup{
+		calls:       map[string]*refreshCall{},
+		last:        map[string]time.Time{},
+		minInterval: minInterval,
+	}
+}
+
+// cacheRefreshInterval function: Return the minimum time between two refreshes of a query, set by CACHE_REFRESH_INTERVAL in seconds
+func cacheRefreshInterval() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("CACHE_REFRESH_INTERVAL"))
+	if err != nil || seconds < 0 {
+		return time.Minute
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// normaliseQuery function: Trim a search term and collapse its inner whitespace
+func normaliseQuery(msg string) string {
+	return strings.Join(strings.Fields(msg), " ")
+}
+
+// do function: Run fn for key unless it is already running or ran recently, reporting whether fn ran for this caller
+func (group *refreshGroup) do(key string, fn func() []Song) ([]Song, bool) {
+	group.mu.Lock()
+	if call, ok := group.calls[key]; ok {
+		group.mu.Unlock()
+		call.wg.Wait()
+		return call.songs, false
+	}
+	if last, ok := group.last[key]; ok && time.Since(last) < group.minInterval() {
+		group.mu.Unlock()
+		return nil, false
+	}
+	call := &refreshCall{}
+	call.wg.Add(1)
+	group.calls[key] = call
+	group.mu.Unlock()
+
+	defer func() {
+		group.mu.Lock()
+		delete(group.calls, key)
+		group.last[key] = time.Now()
+		group.mu.Unlock()
+		call.wg.Done()
+	}()
+	call.songs = fn()
+	return call.songs, true
+}
+
+// forget function: Allow the next refresh of key to run immediately
+func (group *refreshGroup) forget(key string) {
+	group.mu.Lock()
+	delete(group.last, key)
+	group.mu.Unlock()
+}
+
+// refreshCache function: Search every source for a query and rewrite its cache file, coalesced with concurrent refreshes
+func refreshCache(query cacheQuery, cacheDir string) ([]Song, bool) {
+	cacheFilePath := cacheFilePathFor(cacheDir, query)
+	// The minimum interval only protects existing cache files, a missing one is always rebuilt
+	if _, err := os.Stat(cacheFilePath); os.IsNotExist(err) {
+		cacheRefreshes.forget(cacheFilePath)
+	}
+	return cacheRefreshes.do(cacheFilePath, func() []Song {
+		fmt.Println("Starting update cache file: ", cacheFilePath)
+		newSongs := apiSongHandlerOnMetadata(query.Msg)
+		newTimestamp := time.Now().Format(time.RFC3339)
+		apiCache.put(cacheFilePath, newSongs, newTimestamp)
+		recordCacheQuery(cacheDir, query)
+		fmt.Println("Updated cache file: ", cacheFilePath)
+		return newSongs
+	})
+}
+
+// storeCache function: Write songs searched by the caller as a refresh of the query, returning their timestamp or "" when a running refresh won
+func storeCache(query cacheQuery, cacheDir string, songs []Song) string {
+	cacheFilePath := cacheFilePathFor(cacheDir, query)
+	// The songs were just searched, they replace the results of a refresh within the minimum interval
+	cacheRefreshes.forget(cacheFilePath)
+	var timestamp string
+	cacheRefreshes.do(cacheFilePath, func() []Song {
+		timestamp = time.Now().Format(time.RFC3339)
+		apiCache.put(cacheFilePath, songs, timestamp)
+		recordCacheQuery(cacheDir, query)
+		return songs
+	})
+	return timestamp
+}
+
+// refreshCacheInBackground function: Refresh the cache of a query without blocking the request
+func refreshCacheInBackground(query cacheQuery, cacheDir string) {
+	backgroundRefreshes.Add(1)
+	go func() {
+		defer backgroundRefreshes.Done()
+		refreshCache(query, cacheDir)
+	}()
+}
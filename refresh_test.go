@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Fake provider counting its searches.
+type countingProvider struct {
+	fakeProvider
+	searches *int32
+}
+
+func (provider *countingProvider) Search(ctx context.Context, msg string) ([]Song, error) {
+	atomic.AddInt32(provider.searches, 1)
+	return provider.fakeProvider.Search(ctx, msg)
+}
+
+// TestRefreshGroupCoalesces Test that concurrent refreshes of one key run once
+func TestRefreshGroupCoalesces(t *testing.T) {
+	group := newRefreshGroup(func() time.Duration { return 0 })
+	var calls int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([][]Song, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = group.do("晴天", func() []Song {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return []Song{{Song: "晴天"}}
+			})
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected one refresh, got %d", calls)
+	}
+	for i, songs := range results {
+		if len(songs) != 1 || songs[0].Song != "晴天" {
+			t.Errorf("Caller %d got %+v", i, songs)
+		}
+	}
+}
+
+// TestRefreshGroupMinInterval Test that a key is not refreshed again within the minimum interval
+func TestRefreshGroupMinInterval(t *testing.T) {
+	group := newRefreshGroup(func() time.Duration { return time.Hour })
+	var calls int32
+	fn := func() []Song {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}
+
+	if _, ran := group.do("a", fn); !ran {
+		t.Errorf("Expected the first refresh to run")
+	}
+	if _, ran := group.do("a", fn); ran {
+		t.Errorf("Expected the second refresh to be skipped")
+	}
+	if _, ran := group.do("b", fn); !ran {
+		t.Errorf("Expected another key to be refreshed")
+	}
+	group.forget("a")
+	if _, ran := group.do("a", fn); !ran {
+		t.Errorf("Expected a forgotten key to be refreshed")
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 refreshes, got %d", calls)
+	}
+}
+
+// TestWriteCacheFileAtomic Test that writeCacheFile replaces the cache file without leaving temporary files
+func TestWriteCacheFileAtomic(t *testing.T) {
+	cacheDir := t.TempDir()
+	cacheFilePath := filepath.Join(cacheDir, "query.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			writeCacheFile(cacheFilePath, []Song{{Num: i, Song: "song"}}, time.Now().Format(time.RFC3339))
+		}(i)
+	}
+	wg.Wait()
+
+	songs, timestamp := readCacheFile(cacheFilePath)
+	if len(songs) != 1 || timestamp == "" {
+		t.Errorf("Unexpected cache content: %+v %q", songs, timestamp)
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatalf("Cannot read cache directory: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the cache file, found %d entries", len(entries))
+	}
+}
+
+// TestNormaliseQuery Test normaliseQuery function
+func TestNormaliseQuery(t *testing.T) {
+	if got := normaliseQuery("  周杰伦 \t 晴天  "); got != "周杰伦 晴天" {
+		t.Errorf("normaliseQuery returned %q", got)
+	}
+}
+
+// TestCachedSearchSharesFilters Test that every filter of a search term shares one refresh and one cache file
+func TestCachedSearchSharesFilters(t *testing.T) {
+	setupAPITest(t, 0)
+	t.Setenv("CACHE_REFRESH_INTERVAL", "3600")
+	var searches int32
+	registerProvider("fake-counting", func(api API) Provider {
+		return &countingProvider{fakeProvider: fakeProvider{api: api, songs: []Song{{Song: "Song Up", Singer: "Upstream"}}}, searches: &searches}
+	})
+	metadata, _ := json.Marshal(Metadata{
+		API:   []API{{APIType: "fake-counting", Sources: "counting"}},
+		Other: []OtherSong{{SongName: "Song 1", Singer: "Local"}},
+	})
+	writeTestFile(t, os.Getenv("MEDIA_ROOT"), "metadata.json", metadata)
+
+	for _, filters := range []string{"", "num=2", "singer=upstream", "album=x", "has_lyrics=1", "quality=standard", "source=local", "num=1&singer=local"} {
+		apiTestRequest(t, "/api?msg=%20Song%20&"+filters)
+	}
+	if searches != 1 {
+		t.Errorf("Expected one upstream search for every filter, got %d", searches)
+	}
+	entries, err := os.ReadDir(os.Getenv("CACHE_DIR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if isCacheDataFile(entry.Name()) {
+			files = append(files, entry.Name())
+		}
+	}
+	if len(files) != 1 || files[0] != newCacheQuery("Song").fileName() {
+		t.Errorf("Expected the one cache file of msg, got %v", files)
+	}
+
+	// The filters are applied to the cached songs of msg
+	if _, songs := apiTestRequest(t, "/api?msg=Song&singer=upstream"); len(songs) != 1 || songs[0].Song != "Song Up" {
+		t.Errorf("Unexpected filtered songs from the shared cache: %+v", songs)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Length of a song ID in hexadecimal characters.
+const songIDLength = 16
+
+// Most upstream songs remembered by songRegistry, the oldest are forgotten first.
+const songRegistrySize = 4096
+
+// Upstream songs seen in search results, so /api/song/{id} finds them without searching again.
+type songRegistry struct {
+	mu    sync.Mutex
+	songs map[string]Song
+	order []string
+}
+
+// The registry of upstream songs used by the handlers.
+var upstreamSongs = &songRegistry{songs: map[string]Song{}}
+
+// The cache files holding upstream songs, so an ID missing from songRegistry is read from one file rather than searched for on disk.
+type cachedSongIndex struct {
+	mu    sync.Mutex
+	dir   string            // Cache directory indexed, empty before the first lookup
+	files map[string]string // Song ID to the path of the cache file holding it
+}
+
+// The index of the cache files used by findSong, filled on the first lookup and by cache writes.
+var cachedSongs = &cachedSongIndex{}
+
+// songID function: Hash a source and a key unique within it into a stable song ID
+func songID(source string, key string) string {
+	sum := sha256.Sum256([]byte(source + "\x00" + key))
+	return hex.EncodeToString(sum[:songIDLength/2])
+}
+
+// localSongID function: Return the ID of a library song from its file or folder relative to the media root
+func localSongID(relPath string) string {
+	return songID(localSource, filepath.ToSlash(relPath))
+}
+
+// otherSongID function: Return the ID of a song of the "other" list of metadata.json
+func otherSongID(otherSong OtherSong) string {
+	return songID(localSource, "other\x00"+otherSong.SongName+"\x00"+otherSong.Singer+"\x00"+otherSong.Album)
+}
+
+// upstreamSongID function: Return the ID of a provider's song, from the provider's own ID when it has one
+func upstreamSongID(source string, song Song) string {
+	if song.ID != "" {
+		return songID(source, "id\x00"+song.ID)
+	}
+	return songID(source, "song\x00"+song.Song+"\x00"+song.Singer+"\x00"+song.Album)
+}
+
+// isSongID function: Report whether a string has the form of a song ID
+func isSongID(id string) bool {
+	if len(id) != songIDLength {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
+
+// add function: Remember an upstream song, replacing an older copy of it
+func (registry *songRegistry) add(song Song) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.songs[song.ID]; !ok {
+		registry.order = append(registry.order, song.ID)
+	}
+	registry.songs[song.ID] = song
+	for len(registry.order) > songRegistrySize {
+		delete(registry.songs, registry.order[0])
+		registry.order = registry.order[1:]
+	}
+}
+
+// get function: Return a remembered upstream song
+func (registry *songRegistry) get(id string) (Song, bool) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	song, ok := registry.songs[id]
+	return song, ok
+}
+
+// add function: Record the upstream songs of a cache file written, once its directory is indexed
+func (index *cachedSongIndex) add(path string, songs []Song) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	if index.dir != filepath.Dir(path) {
+		return
+	}
+	index.addSongs(path, songs)
+}
+
+// lookup function: Return the cache file holding a song, the cache directory is read once when it is first looked in
+func (index *cachedSongIndex) lookup(cacheDir string, id string) (string, bool) {
+	cacheDir = filepath.Clean(cacheDir)
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	if index.dir != cacheDir {
+		index.dir, index.files = cacheDir, map[string]string{}
+		entries, _ := os.ReadDir(cacheDir)
+		for _, entry := range entries {
+			if entry.IsDir() || !isCacheDataFile(entry.Name()) {
+				continue
+			}
+			path := filepath.Join(cacheDir, entry.Name())
+			songs, _ := readCacheFile(path)
+			index.addSongs(path, songs)
+		}
+	}
+	path, ok := index.files[id]
+	return path, ok
+}
+
+// forget function: Drop a song whose cache file no longer holds it
+func (index *cachedSongIndex) forget(id string) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	delete(index.files, id)
+}
+
+// Helper function to record the upstream songs of a cache file, the caller holds mu
+func (index *cachedSongIndex) addSongs(path string, songs []Song) {
+	for _, song := range songs {
+		if song.ID != "" && song.Source != localSource {
+			index.files[song.ID] = path
+		}
+	}
+}
+
+// findSong function: Find a song by ID in the library, metadata.json, the upstream songs seen and the cache files
+func findSong(id string) (Song, bool) {
+	for _, song := range localSongs() {
+		if song.ID == id {
+			return song, true
+		}
+	}
+	if song, ok := upstreamSongs.get(id); ok {
+		return song, true
+	}
+
+	// Songs cached before a restart, or forgotten by the registry, are read from the one cache file holding them
+	path, ok := cachedSongs.lookup(cacheDirPath(), id)
+	if !ok {
+		return Song{}, false
+	}
+	songs, _ := readCacheFile(path)
+	for _, song := range songs {
+		if song.ID == id {
+			upstreamSongs.add(song)
+			return song, true
+		}
+	}
+	// The file was swept or written again without the song
+	cachedSongs.forget(id)
+	return Song{}, false
+}
+
+// resolveSong function: Fill in the music and lyric URLs of an upstream song from its provider, when its search result had none
+func resolveSong(ctx context.Context, song Song) Song {
+	typedSongFields(&song)
+	musicURL, hasMusicURL := song.MusicURL.(MusicURL)
+	lyric, hasLyric := song.Lyric.(Lyric)
+	hasMusicURL = hasMusicURL && musicURL != MusicURL{}
+	hasLyric = hasLyric && lyric != Lyric{}
+	if song.Source != localSource && (!hasMusicURL || !hasLyric) {
+		if provider, api, ok := songProvider(song.Source); ok {
+			ctx, cancel := context.WithTimeout(ctx, providerTimeout(api))
+			defer cancel()
+			if !hasMusicURL {
+				if resolved, err := provider.Resolve(ctx, song); err == nil {
+					musicURL = resolved
+				} else if !errors.Is(err, errNotSupported) {
+					fmt.Println("Error resolving song: ", song.ID, err)
+				}
+			}
+			if !hasLyric {
+				if resolved, err := provider.Lyrics(ctx, song); err == nil {
+					lyric = resolved
+				} else if !errors.Is(err, errNotSupported) {
+					fmt.Println("Error resolving lyrics: ", song.ID, err)
+				}
+			}
+			resolvedSong := song
+			resolvedSong.MusicURL, resolvedSong.Lyric = musicURL, lyric
+			upstreamSongs.add(resolvedSong)
+		}
+	}
+
+	// Every quality and lyric format is listed, empty when the song does not have it
+	song.MusicURL, song.Lyric = musicURL, lyric
+	song.Num = 0 // Positions only mean something in search results
+	return song
+}
+
+// Helper function to return the provider of metadata.json whose songs have a source
+func songProvider(source string) (Provider, API, bool) {
+	metadata, err := library.getMetadata()
+	if err != nil {
+		return nil, API{}, false
+	}
+	for _, api := range metadata.API {
+		if providerSource(api) != source {
+			continue
+		}
+		provider, err := newProvider(api)
+		if err != nil {
+			return nil, API{}, false
+		}
+		return provider, api, true
+	}
+	return nil, API{}, false
+}
+
+// songHandler function: Return the detail of one song by its stable ID at /api/song/{id}
+func songHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", "MeowMusicServer")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	ip, err := IPhandler(r)
+	if err != nil {
+		ip = "0.0.0.0"
+	}
+	response := Response{
+		Data:  []interface{}{},
+		Tips:  "Provide by " + os.Getenv("WEBSITE_NAME"),
+		Ip:    ip,
+		Cache: "no-cache",
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/song/")
+	song, found := Song{}, false
+	if isSongID(id) {
+		song, found = findSong(id)
+	}
+	switch {
+	case !isSongID(id):
+		response.Code, response.Msg = 2, "Invalid 'id' parameter provided."
+		w.WriteHeader(http.StatusBadRequest)
+	case !found:
+		response.Code, response.Msg = 3, "No song found for the given id."
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		response.Msg, response.Data = "API Operation successful.", resolveSong(r.Context(), song)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper function to request /api/song/{id} and decode the song of the response
+func songTestRequest(t *testing.T, id string) (int, Response, Song) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	songHandler(rr, httptest.NewRequest("GET", "/api/song/"+id, nil))
+	var response Response
+	var data json.RawMessage
+	var song Song
+	response.Data = &data
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Cannot decode response of %s: %s", id, err)
+	}
+	if response.Code == 0 {
+		json.Unmarshal(data, &song)
+	}
+	return rr.Code, response, song
+}
+
+// TestSongIDStable Test that library song IDs only depend on their path
+func TestSongIDStable(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("MEDIA_ROOT", root)
+	writeTestFile(t, root, "Singer-Song@Album/standard.mp3", []byte("audio"))
+	writeTestFile(t, root, "Other-Tune@Record/standard.mp3", []byte("audio"))
+
+	index := newLibraryIndex()
+	index.refresh()
+	songs := index.songs()
+	if len(songs) != 2 || !isSongID(songs[0].ID) || songs[0].ID == songs[1].ID {
+		t.Fatalf("Unexpected song IDs: %+v", songs)
+	}
+
+	// New files change the song but not its ID
+	later := time.Now().Add(time.Minute)
+	writeTestFile(t, root, "Singer-Song@Album/lossless.flac", []byte("audio"))
+	os.Chtimes(filepath.Join(root, "Singer-Song@Album"), later, later)
+	rebuilt := newLibraryIndex()
+	rebuilt.refresh()
+	for i, song := range rebuilt.songs() {
+		if song.ID != songs[i].ID {
+			t.Errorf("Song %q changed ID from %s to %s", song.Song, songs[i].ID, song.ID)
+		}
+	}
+
+	// An index saved before songs had IDs is rescanned
+	indexPath := filepath.Join(t.TempDir(), "library.json")
+	rebuilt.save(indexPath)
+	fileContent, _ := os.ReadFile(indexPath)
+	for _, song := range songs {
+		fileContent = []byte(strings.ReplaceAll(string(fileContent), `"id":"`+song.ID+`"`, `"id":""`))
+	}
+	os.WriteFile(indexPath, fileContent, 0666)
+	loaded := newLibraryIndex()
+	if err := loaded.load(indexPath); err != nil {
+		t.Fatalf("load returns error: %s", err)
+	}
+	if changed, _ := loaded.refresh(); changed != 2 || loaded.songs()[0].ID != songs[0].ID {
+		t.Errorf("Expected the folders without IDs to be rescanned, got %d changes and %+v", changed, loaded.songs())
+	}
+}
+
+// TestSongHandler Test the detail of local, metadata.json and upstream songs, resolved lazily
+func TestSongHandler(t *testing.T) {
+	setupAPITest(t, 0)
+	t.Setenv("HOME_URL", "http://music.example")
+	root := os.Getenv("MEDIA_ROOT")
+	writeTestFile(t, root, "Singer-Rain Local@Album/standard.mp3", []byte("audio"))
+	writeTestFile(t, root, "Singer-Rain Local@Album/lyric.lrc", []byte("[00:00.00]la"))
+	fakeProviderSongs["detail"] = []Song{{Song: "Rain Up", Singer: "Alice", Cover: "http://fake.example/cover.jpg"}}
+	t.Cleanup(func() { delete(fakeProviderSongs, "detail") })
+	metadata, _ := json.Marshal(Metadata{
+		API:   []API{{APIType: "fake", Sources: "detail"}},
+		Other: []OtherSong{{SongName: "Rain Other", Singer: "Bob", MusicURL: MusicURL{Hires: "http://other.example/rain.flac"}}},
+	})
+	writeTestFile(t, root, "metadata.json", metadata)
+
+	apiTestRequest(t, "/api?msg=Rain")
+	_, songs := apiTestRequest(t, "/api?msg=Rain")
+	ids := map[string]string{}
+	for _, song := range songs {
+		if !isSongID(song.ID) {
+			t.Fatalf("Song %q has no ID: %+v", song.Song, song)
+		}
+		ids[song.Song] = song.ID
+	}
+	if len(ids) != 3 {
+		t.Fatalf("Expected 3 songs with IDs, got %v", ids)
+	}
+	if _, again := apiTestRequest(t, "/api?msg=Rain"); len(again) != 3 || again[2].ID != songs[2].ID {
+		t.Errorf("IDs should not change between searches: %+v", again)
+	}
+
+	status, response, song := songTestRequest(t, ids["Rain Local"])
+	musicURL, _ := json.Marshal(song.MusicURL)
+	if status != http.StatusOK || response.Code != 0 || song.Source != "local" || song.Num != 0 || !strings.Contains(string(musicURL), `"hires":""`) ||
+		!strings.Contains(string(musicURL), "/file/Singer-Rain%20Local@Album/standard.mp3") {
+		t.Errorf("Unexpected local song: %d %+v %s", status, song, musicURL)
+	}
+	if _, _, song := songTestRequest(t, ids["Rain Other"]); song.Singer != "Bob" || !strings.Contains(toJSON(song.MusicURL), "rain.flac") {
+		t.Errorf("Unexpected metadata.json song: %+v", song)
+	}
+
+	// Upstream URLs are resolved when the detail is asked for, also after a restart
+	previous, previousCached := upstreamSongs, cachedSongs
+	upstreamSongs, cachedSongs = &songRegistry{songs: map[string]Song{}}, &cachedSongIndex{}
+	t.Cleanup(func() { upstreamSongs, cachedSongs = previous, previousCached })
+	status, _, song = songTestRequest(t, ids["Rain Up"])
+	if status != http.StatusOK || song.Source != "detail" || song.Cover != "http://fake.example/cover.jpg" ||
+		!strings.Contains(toJSON(song.MusicURL), "http://fake.example/Rain Up.mp3") || !strings.Contains(toJSON(song.Lyric), "Rain Up.lrc") {
+		t.Errorf("Unexpected upstream song: %d %+v", status, song)
+	}
+	if resolved, ok := upstreamSongs.get(ids["Rain Up"]); !ok || resolved.MusicURL.(MusicURL).Standard != "http://fake.example/Rain Up.mp3" {
+		t.Errorf("The resolved song should be remembered: %+v", resolved)
+	}
+
+	if status, response, _ := songTestRequest(t, "not-an-id"); status != http.StatusBadRequest || response.Code != 2 {
+		t.Errorf("Invalid ID got %d %+v", status, response)
+	}
+	if status, response, _ := songTestRequest(t, "0123456789abcdef"); status != http.StatusNotFound || response.Code != 3 {
+		t.Errorf("Unknown ID got %d %+v", status, response)
+	}
+
+	// The cache directory is indexed once, unknown IDs do not read it again and cache writes are indexed
+	snow := Song{Song: "Snow", Singer: "Alice", Source: "detail"}
+	snow.ID = upstreamSongID("detail", snow)
+	cacheDir := os.Getenv("CACHE_DIR")
+	cacheFile, _ := json.Marshal(map[string]interface{}{"songs": []Song{snow}, "timestamp": time.Now().Format(time.RFC3339)})
+	writeTestFile(t, cacheDir, "copied.json", cacheFile)
+	if status, _, _ := songTestRequest(t, snow.ID); status != http.StatusNotFound {
+		t.Errorf("A cache file not written by the server is only indexed at the next start, got %d", status)
+	}
+	writeCacheFile(filepath.Join(cacheDir, "written.json"), []Song{snow}, time.Now().Format(time.RFC3339))
+	if status, _, song := songTestRequest(t, snow.ID); status != http.StatusOK || song.Song != "Snow" {
+		t.Errorf("A song of a cache file written should be found: %d %+v", status, song)
+	}
+	os.Remove(filepath.Join(cacheDir, "written.json"))
+	upstreamSongs = &songRegistry{songs: map[string]Song{}}
+	if status, _, _ := songTestRequest(t, snow.ID); status != http.StatusNotFound {
+		t.Errorf("A song of a swept cache file should not be found, got %d", status)
+	}
+}
+
+// Helper function to encode a value for comparisons
+func toJSON(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
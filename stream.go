@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// One event of a streamed search, sent as a Server-Sent Event or as a line of NDJSON.
+type streamEvent struct {
+	Event  string `json:"event"`            // "local", "provider", "done" or "error"
+	Source string `json:"source,omitempty"` // "local" or the source of the provider
+	Songs  []Song `json:"songs,omitempty"`
+	Error  string `json:"error,omitempty"` // Why a provider failed, the stream goes on
+	Code   int    `json:"code,omitempty"`  // Response code of an "error" event
+	Msg    string `json:"msg,omitempty"`
+	Total  int    `json:"total,omitempty"` // Number of songs sent, in the "done" event
+	Cache  string `json:"cache,omitempty"` // Timestamp of the cache entry written, in the "done" event, absent when a provider failed
+}
+
+// Writes the events of one streamed search and flushes each of them.
+type searchStream struct {
+	w      http.ResponseWriter
+	ndjson bool
+}
+
+// newSearchStream function: Start a stream as NDJSON when asked by ?format=ndjson or the Accept header, as Server-Sent Events otherwise
+func newSearchStream(w http.ResponseWriter, r *http.Request) *searchStream {
+	stream := &searchStream{w: w}
+	stream.ndjson = r.URL.Query().Get("format") == "ndjson" || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+	if stream.ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Keep reverse proxies from holding events back
+	return stream
+}
+
+// send function: Write one event and flush it to the client
+func (stream *searchStream) send(event streamEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println("Error encoding stream event: ", err)
+		return
+	}
+	if stream.ndjson {
+		fmt.Fprintf(stream.w, "%s\n", data)
+	} else {
+		fmt.Fprintf(stream.w, "event: %s\ndata: %s\n\n", event.Event, data)
+	}
+	if err := http.NewResponseController(stream.w).Flush(); err != nil && err != http.ErrNotSupported {
+		fmt.Println("Error flushing stream event: ", err)
+	}
+}
+
+// apiStreamHandler function: Stream a search, local songs first and then the songs of each provider as it answers
+func apiStreamHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", "MeowMusicServer")
+	queryParams := r.URL.Query()
+	msg := normaliseQuery(queryParams.Get("msg"))
+	stream := newSearchStream(w, r)
+
+	filters, code, errMsg := checkSearchRequest(msg, queryParams)
+	if code != 0 {
+		stream.send(streamEvent{Event: "error", Code: code, Msg: errMsg})
+		return
+	}
+	search, _ := parseSearchQuery(msg)
+	metadata, err := library.getMetadata()
+	if err != nil {
+		fmt.Println("Error reading metadata file: ", err)
+		metadata = &Metadata{}
+	}
+
+	// Songs are numbered in the order they are sent, each batch ranked on its own
+	candidates := localCandidates(metadata, search)
+	numbered := rankSongs(candidates)
+	songs := filters.apply(numbered)
+	stream.send(streamEvent{Event: "local", Source: localSource, Songs: songs})
+	sent := len(songs)
+
+	failed := false
+	for result := range streamSearch(r.Context(), metadata.API, search.Text) {
+		providerSongs := rankSongs(providerCandidates(search, result, len(numbered)))
+		for i := range providerSongs {
+			providerSongs[i].Num += len(numbered)
+		}
+		numbered = append(numbered, providerSongs...)
+		event := streamEvent{Event: "provider", Source: providerSource(result.API), Songs: filters.apply(providerSongs)}
+		if result.Err != nil {
+			event.Error = result.Err.Error()
+			failed = true
+		}
+		sent += len(event.Songs)
+		stream.send(event)
+	}
+
+	// A client that left did not wait for every provider, its partial results are not cached
+	if r.Context().Err() != nil {
+		return
+	}
+
+	// Cache the complete results as a refresh, so the next /api request is a hit, with the numbers they were sent with
+	// rather than ranked across providers again, a num seen in the stream picks the same song from /api.
+	// Results missing the songs of a failed provider are left to the next refresh.
+	done := streamEvent{Event: "done", Total: sent}
+	if !failed {
+		done.Cache = storeCache(newCacheQuery(msg), cacheDirPath(), numbered)
+	}
+	stream.send(done)
+}
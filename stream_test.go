@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper function to serve a library with one local song and a fast, a slow and a broken provider
+func setupStreamTest(t *testing.T) *httptest.Server {
+	t.Helper()
+	setupAPITest(t, 0)
+	fakeProviderSongs["stream"] = []Song{{Song: "Rain Fast", Singer: "Alice"}, {Song: "Rain Fast", Singer: "Bob"}}
+	t.Cleanup(func() { delete(fakeProviderSongs, "stream") })
+	metadata, _ := json.Marshal(Metadata{
+		API: []API{
+			{APIType: "fake-slow", Sources: "Rain Slow"},
+			{APIType: "fake", Sources: "stream"},
+			{APIType: "fake-broken", Sources: "broken"},
+		},
+		Other: []OtherSong{{SongName: "Rain Local", Singer: "Alice"}},
+	})
+	writeTestFile(t, os.Getenv("MEDIA_ROOT"), "metadata.json", metadata)
+	server := httptest.NewServer(http.HandlerFunc(apiStreamHandler))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestAPIStreamNDJSON Test that local songs are sent before slow providers answer and results missing a provider are not cached
+func TestAPIStreamNDJSON(t *testing.T) {
+	server := setupStreamTest(t)
+	start := time.Now()
+	resp, err := http.Get(server.URL + "/api/stream?format=ndjson&msg=Rain")
+	if err != nil {
+		t.Fatalf("Cannot request the stream: %s", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/x-ndjson") {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+
+	var events []streamEvent
+	var localAfter time.Duration
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var event streamEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Cannot decode event %q: %s", scanner.Text(), err)
+		}
+		if event.Event == "local" {
+			localAfter = time.Since(start)
+		}
+		events = append(events, event)
+	}
+
+	var order []string
+	nums := map[int]string{}
+	for _, event := range events {
+		order = append(order, event.Event+" "+event.Source)
+		for _, song := range event.Songs {
+			nums[song.Num] = song.Song
+		}
+	}
+	// The fast providers answer in any order, the slow one last
+	if len(order) == 5 && order[1] > order[2] {
+		order[1], order[2] = order[2], order[1]
+		events[1], events[2] = events[2], events[1]
+	}
+	want := []string{"local local", "provider broken", "provider stream", "provider rain slow", "done "}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Fatalf("Got events %v, want %v", order, want)
+	}
+	if localAfter > 200*time.Millisecond {
+		t.Errorf("Local songs were sent after %s, before the slow provider is expected", localAfter)
+	}
+	if events[1].Error == "" || len(events[1].Songs) != 0 {
+		t.Errorf("The broken provider should report its error: %+v", events[1])
+	}
+	if len(nums) != 4 || nums[1] != "Rain Local" || nums[4] != "Rain Slow" || events[4].Total != 4 {
+		t.Errorf("Songs should be numbered in the order they are sent: %v, total %d", nums, events[4].Total)
+	}
+
+	// The broken provider is missing from the results, the next /api request is not a hit
+	if events[4].Cache != "" {
+		t.Errorf("Results missing a failed provider should not be cached: %+v", events[4])
+	}
+	if response, _ := apiTestRequest(t, "/api?msg=Rain"); response.Cache != "no-cache" {
+		t.Errorf("Unexpected response after the stream: %+v", response)
+	}
+}
+
+// TestAPIStreamSSE Test the event stream framing, filters and errors
+func TestAPIStreamSSE(t *testing.T) {
+	setupStreamTest(t)
+	rr := httptest.NewRecorder()
+	apiStreamHandler(rr, httptest.NewRequest("GET", "/api/stream?msg=Rain&singer=bob", nil))
+	body := rr.Body.String()
+	if contentType := rr.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		t.Errorf("Unexpected content type %q", contentType)
+	}
+	if !strings.HasPrefix(body, "event: local\ndata: {\"event\":\"local\",\"source\":\"local\"}\n\n") {
+		t.Errorf("Local songs should be filtered out by singer: %q", body)
+	}
+	if !strings.Contains(body, `"singer":"Bob"`) || strings.Contains(body, `"singer":"Alice"`) || !strings.HasSuffix(body, "\n\n") {
+		t.Errorf("Unexpected stream: %q", body)
+	}
+	if !strings.Contains(body, "event: done\ndata: {\"event\":\"done\",\"total\":1}") {
+		t.Errorf("The done event should count the songs sent: %q", body)
+	}
+
+	for target, code := range map[string]int{"/api/stream": 1, "/api/stream?msg=Rain&quality=ultra": 2, "/api/stream?msg=%22Rain": 5} {
+		rr := httptest.NewRecorder()
+		apiStreamHandler(rr, httptest.NewRequest("GET", target, nil))
+		data, ok := strings.CutPrefix(strings.TrimSpace(rr.Body.String()), "event: error\ndata: ")
+		var event streamEvent
+		if !ok || json.Unmarshal([]byte(data), &event) != nil || event.Code != code {
+			t.Errorf("%s: got %q, want an error event with code %d", target, rr.Body.String(), code)
+		}
+	}
+}
+
+// TestAPIStreamNumbersCached Test that the cached results keep the numbers of the stream when weights rank providers differently
+func TestAPIStreamNumbersCached(t *testing.T) {
+	setupStreamTest(t)
+	t.Setenv("SEARCH_LOCAL_FIRST", "false")
+	t.Setenv("CACHE_REFRESH_INTERVAL", "3600")
+	fakeProviderSongs["heavy"] = []Song{{Song: "Rain", Singer: "Carol"}}
+	t.Cleanup(func() { delete(fakeProviderSongs, "heavy") })
+	metadata, _ := json.Marshal(Metadata{
+		API: []API{
+			{APIType: "fake", Sources: "stream"},
+			{APIType: "fake-slow", Sources: "Rain Slow", Weight: 3},
+			{APIType: "fake", Sources: "heavy", Weight: 5},
+		},
+		Other: []OtherSong{{SongName: "Rain Local", Singer: "Alice"}},
+	})
+	writeTestFile(t, os.Getenv("MEDIA_ROOT"), "metadata.json", metadata)
+
+	rr := httptest.NewRecorder()
+	apiStreamHandler(rr, httptest.NewRequest("GET", "/api/stream?format=ndjson&msg=Rain", nil))
+	streamed := map[int]string{}
+	for _, line := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n") {
+		var event streamEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Cannot decode event %q: %s", line, err)
+		}
+		for _, song := range event.Songs {
+			streamed[song.Num] = song.Song + " " + song.Singer
+		}
+	}
+	if len(streamed) != 5 || streamed[1] != "Rain Local Alice" || streamed[5] != "Rain Slow " {
+		t.Fatalf("Songs should be numbered in the order they are sent: %v", streamed)
+	}
+
+	// Ranked again, the weighted providers would come first and every num would point to another song.
+	// The stream counts as a refresh, so the hits do not start one that would rank them again.
+	for i := 0; i < 2; i++ {
+		response, songs := apiTestRequest(t, "/api?msg=Rain")
+		if response.Cache == "no-cache" || len(songs) != len(streamed) {
+			t.Fatalf("Unexpected response %d after the stream: %+v %+v", i, response, songs)
+		}
+		for _, song := range songs {
+			if got := song.Song + " " + song.Singer; streamed[song.Num] != got {
+				t.Errorf("Response %d: num %d is %q in the cache, %q in the stream", i, song.Num, got, streamed[song.Num])
+			}
+		}
+	}
+}
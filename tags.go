@@ -0,0 +1,879 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var errNoTags = errors.New("no supported tags found")
+
+// Most bytes of an MP4 moov atom read for its tags, the rest of a larger atom is ignored.
+const maxMP4MoovSize = 16 << 20
+
+// Embedded tags of an audio file.
+type audioTags struct {
+	Title       string
+	Artist      string
+	Album       string
+	Genre       string
+	Track       int
+	Disc        int
+	Year        int
+	Duration    int // seconds
+	Picture     []byte
+	PictureMIME string
+}
+
+// Audio file extensions recognised when scanning the library.
+var audioExtensions = map[string]bool{
+	".mp3":  true,
+	".flac": true,
+	".ogg":  true,
+	".oga":  true,
+	".opus": true,
+	".m4a":  true,
+	".mp4":  true,
+	".aac":  true,
+	".wav":  true,
+	".amr":  true,
+}
+
+// isAudioFile function: Check whether a file name has a known audio extension
+func isAudioFile(name string) bool {
+	return audioExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// readAudioTags function: Read the embedded tags of an MP3, FLAC, OGG or M4A file
+func readAudioTags(filePath string) (*audioTags, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Detect the container from its magic bytes rather than trusting the extension
+	magic := make([]byte, 12)
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return nil, errNoTags
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	tags := &audioTags{}
+	switch {
+	case bytes.HasPrefix(magic, []byte("fLaC")):
+		err = readFLACTags(file, tags)
+	case bytes.HasPrefix(magic, []byte("OggS")):
+		err = readOggTags(file, tags)
+	case bytes.Equal(magic[4:8], []byte("ftyp")):
+		err = readMP4Tags(file, tags)
+	case bytes.HasPrefix(magic, []byte("ID3")) || strings.EqualFold(filepath.Ext(filePath), ".mp3"):
+		err = readMP3Tags(file, tags)
+	default:
+		return nil, errNoTags
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// parseTagNumber function: Parse a "3" or "3/12" style position into its first number
+func parseTagNumber(value string) int {
+	value = strings.TrimSpace(value)
+	if i := strings.IndexByte(value, '/'); i >= 0 {
+		value = value[:i]
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(value))
+	return n
+}
+
+// parseTagYear function: Take the year from a "2003", "2003-07-31" or "2003-07-31T00:00:00" style date
+func parseTagYear(value string) int {
+	value = strings.TrimSpace(value)
+	if len(value) > 4 {
+		value = value[:4]
+	}
+	year, _ := strconv.Atoi(value)
+	return year
+}
+
+// ---- MP3: ID3v2.2/2.3/2.4, ID3v1 and MPEG frame duration ----
+
+// ID3v1 genre list, also used by ID3v2 "(17)" style references.
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop", "Jazz", "Metal",
+	"New Age", "Oldies", "Other", "Pop", "R&B", "Rap", "Reggae", "Rock", "Techno", "Industrial",
+	"Alternative", "Ska", "Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk",
+	"Fusion", "Trance", "Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic",
+	"Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream", "Southern Rock", "Comedy", "Cult", "Gangsta",
+	"Top 40", "Christian Rap", "Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave", "Psychadelic", "Rave", "Showtunes",
+	"Trailer", "Lo-Fi", "Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+}
+
+// readMP3Tags function: Read ID3v2 frames, fall back to ID3v1 and compute the duration from the MPEG frames
+func readMP3Tags(file *os.File, tags *audioTags) error {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	audioStart := int64(0)
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(file, header); err == nil && bytes.HasPrefix(header, []byte("ID3")) {
+		size := int64(syncsafe(header[6:10]))
+		if size > fileInfo.Size() {
+			return errNoTags
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(file, body); err != nil {
+			return err
+		}
+		parseID3v2(header[3], header[5], body, tags)
+		audioStart = 10 + size
+		if header[5]&0x10 != 0 {
+			audioStart += 10 // footer
+		}
+	}
+
+	// ID3v1 only fills what ID3v2 left empty
+	if fileInfo.Size() >= 128 {
+		trailer := make([]byte, 128)
+		if _, err := file.ReadAt(trailer, fileInfo.Size()-128); err == nil && bytes.HasPrefix(trailer, []byte("TAG")) {
+			parseID3v1(trailer, tags)
+		}
+	}
+
+	if tags.Duration == 0 {
+		tags.Duration = mpegDuration(file, audioStart, fileInfo.Size())
+	}
+	return nil
+}
+
+// syncsafe function: Decode a 28 bit ID3v2 syncsafe integer
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// removeUnsync function: Undo ID3v2 unsynchronisation (0xFF 0x00 -> 0xFF)
+func removeUnsync(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xff && i+1 < len(b) && b[i+1] == 0x00 {
+			i++
+		}
+	}
+	return out
+}
+
+// parseID3v2 function: Walk the frames of an ID3v2 tag body
+func parseID3v2(version byte, flags byte, body []byte, tags *audioTags) {
+	if flags&0x80 != 0 && version < 4 {
+		body = removeUnsync(body)
+	}
+
+	// Skip the extended header
+	if flags&0x40 != 0 && len(body) >= 4 {
+		var extSize int
+		if version >= 4 {
+			extSize = syncsafe(body[:4])
+		} else {
+			extSize = int(binary.BigEndian.Uint32(body[:4])) + 4
+		}
+		if extSize > len(body) {
+			return
+		}
+		body = body[extSize:]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	for len(body) >= headerLen && body[0] != 0 {
+		id := string(body[:idLen])
+		var size int
+		var frameFlags uint16
+		switch version {
+		case 2:
+			size = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(body[4:8]))
+			frameFlags = binary.BigEndian.Uint16(body[8:10])
+		default:
+			size = syncsafe(body[4:8])
+			frameFlags = binary.BigEndian.Uint16(body[8:10])
+		}
+		if size < 0 || headerLen+size > len(body) {
+			return
+		}
+		data := body[headerLen : headerLen+size]
+		body = body[headerLen+size:]
+
+		// Compressed or encrypted frames are not supported
+		if (version == 3 && frameFlags&0x00c0 != 0) || (version == 4 && frameFlags&0x000c != 0) {
+			continue
+		}
+		if version == 4 && frameFlags&0x0002 != 0 {
+			data = removeUnsync(data)
+		}
+		if version == 4 && frameFlags&0x0001 != 0 && len(data) >= 4 {
+			data = data[4:] // data length indicator
+		}
+
+		switch id {
+		case "TIT2", "TT2":
+			tags.Title = id3Text(data)
+		case "TPE1", "TP1":
+			tags.Artist = id3Text(data)
+		case "TALB", "TAL":
+			tags.Album = id3Text(data)
+		case "TCON", "TCO":
+			tags.Genre = id3Genre(id3Text(data))
+		case "TRCK", "TRK":
+			tags.Track = parseTagNumber(id3Text(data))
+		case "TPOS", "TPA":
+			tags.Disc = parseTagNumber(id3Text(data))
+		case "TYER", "TYE", "TDRC":
+			tags.Year = parseTagYear(id3Text(data))
+		case "TLEN", "TLE":
+			if ms, err := strconv.Atoi(id3Text(data)); err == nil && ms > 0 {
+				tags.Duration = ms / 1000
+			}
+		case "APIC":
+			parseAPIC(data, tags, false)
+		case "PIC":
+			parseAPIC(data, tags, true)
+		}
+	}
+}
+
+// id3Text function: Decode an ID3v2 text frame, multiple values are joined with "/"
+func id3Text(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	values := strings.Split(decodeID3String(data[0], data[1:]), "\x00")
+	var parts []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// decodeID3String function: Decode ISO-8859-1, UTF-16 with BOM, UTF-16BE or UTF-8 text
+func decodeID3String(encoding byte, data []byte) string {
+	switch encoding {
+	case 1, 2:
+		bigEndian := encoding == 2
+		if len(data) >= 2 && data[0] == 0xff && data[1] == 0xfe {
+			bigEndian, data = false, data[2:]
+		} else if len(data) >= 2 && data[0] == 0xfe && data[1] == 0xff {
+			bigEndian, data = true, data[2:]
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			if bigEndian {
+				units = append(units, binary.BigEndian.Uint16(data[i:]))
+			} else {
+				units = append(units, binary.LittleEndian.Uint16(data[i:]))
+			}
+			// A BOM may start every value of a multi-value frame
+			if n := len(units); n >= 2 && units[n-2] == 0 && (units[n-1] == 0xfeff || units[n-1] == 0xfffe) {
+				units = units[:n-1]
+			}
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		return string(data)
+	default:
+		return latin1(data)
+	}
+}
+
+// latin1 function: Convert ISO-8859-1 bytes to a string
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// id3Genre function: Resolve "(17)", "17" or "(17)Rock" genre references
+func id3Genre(value string) string {
+	ref := value
+	if strings.HasPrefix(ref, "(") {
+		if end := strings.IndexByte(ref, ')'); end > 0 {
+			if rest := strings.TrimSpace(ref[end+1:]); rest != "" {
+				return rest
+			}
+			ref = ref[1:end]
+		}
+	}
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n >= 0 && n < len(id3v1Genres) {
+			return id3v1Genres[n]
+		}
+		return ""
+	}
+	return value
+}
+
+// parseAPIC function: Read the picture of an APIC (v2.3/2.4) or PIC (v2.2) frame
+func parseAPIC(data []byte, tags *audioTags, v22 bool) {
+	if len(data) < 4 || tags.Picture != nil {
+		return
+	}
+	encoding := data[0]
+	var mime string
+	rest := data[1:]
+	if v22 {
+		switch strings.ToUpper(string(rest[:3])) {
+		case "PNG":
+			mime = "image/png"
+		default:
+			mime = "image/jpeg"
+		}
+		rest = rest[3:]
+	} else {
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			return
+		}
+		mime = string(rest[:end])
+		rest = rest[end+1:]
+	}
+	if len(rest) < 1 {
+		return
+	}
+	rest = rest[1:] // picture type
+
+	// Skip the description, terminated by one or two zero bytes depending on the encoding
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(rest); i += 2 {
+			if rest[i] == 0 && rest[i+1] == 0 {
+				rest = rest[i+2:]
+				break
+			}
+		}
+	} else if end := bytes.IndexByte(rest, 0); end >= 0 {
+		rest = rest[end+1:]
+	}
+	if len(rest) == 0 {
+		return
+	}
+	if mime == "" || !strings.Contains(mime, "/") {
+		mime = "image/" + strings.ToLower(mime)
+	}
+	tags.Picture = rest
+	tags.PictureMIME = mime
+}
+
+// parseID3v1 function: Fill empty fields from a 128 byte ID3v1 tag
+func parseID3v1(trailer []byte, tags *audioTags) {
+	field := func(b []byte) string {
+		if end := bytes.IndexByte(b, 0); end >= 0 {
+			b = b[:end]
+		}
+		return strings.TrimSpace(latin1(b))
+	}
+	if tags.Title == "" {
+		tags.Title = field(trailer[3:33])
+	}
+	if tags.Artist == "" {
+		tags.Artist = field(trailer[33:63])
+	}
+	if tags.Album == "" {
+		tags.Album = field(trailer[63:93])
+	}
+	if tags.Year == 0 {
+		tags.Year = parseTagYear(field(trailer[93:97]))
+	}
+	if tags.Track == 0 && trailer[125] == 0 && trailer[126] != 0 {
+		tags.Track = int(trailer[126])
+	}
+	if tags.Genre == "" && int(trailer[127]) < len(id3v1Genres) {
+		tags.Genre = id3v1Genres[trailer[127]]
+	}
+}
+
+// MPEG audio bitrates in kbit/s, indexed by [version is MPEG1][layer 1..3][index].
+var mpegBitrates = [2][3][16]int{
+	{ // MPEG2 / MPEG2.5
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+	{ // MPEG1
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+}
+
+// MPEG sample rates, indexed by [version bits][index].
+var mpegSampleRates = [4][3]int{
+	{11025, 12000, 8000},  // MPEG2.5
+	{0, 0, 0},             // reserved
+	{22050, 24000, 16000}, // MPEG2
+	{44100, 48000, 32000}, // MPEG1
+}
+
+// mpegDuration function: Compute the duration from a Xing/Info/VBRI header or estimate it from the bitrate
+func mpegDuration(file *os.File, start int64, fileSize int64) int {
+	buf := make([]byte, 4096)
+	n, _ := file.ReadAt(buf, start)
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xff || buf[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+		versionBits := (buf[i+1] >> 3) & 0x03
+		layerBits := (buf[i+1] >> 1) & 0x03
+		bitrateIndex := buf[i+2] >> 4
+		rateIndex := (buf[i+2] >> 2) & 0x03
+		if versionBits == 1 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+			continue
+		}
+		mpeg1 := 0
+		if versionBits == 3 {
+			mpeg1 = 1
+		}
+		layer := 3 - int(layerBits) // 0 = layer I
+		bitrate := mpegBitrates[mpeg1][layer][bitrateIndex] * 1000
+		sampleRate := mpegSampleRates[versionBits][rateIndex]
+		samplesPerFrame := 1152
+		if layer == 0 {
+			samplesPerFrame = 384
+		} else if layer == 2 && mpeg1 == 0 {
+			samplesPerFrame = 576
+		}
+
+		// Xing/Info header sits after the side information of the first frame
+		mono := buf[i+3]>>6 == 3
+		sideInfo := 32
+		switch {
+		case mpeg1 == 1 && mono:
+			sideInfo = 17
+		case mpeg1 == 0 && !mono:
+			sideInfo = 17
+		case mpeg1 == 0 && mono:
+			sideInfo = 9
+		}
+		frames := 0
+		if off := i + 4 + sideInfo; off+12 <= len(buf) {
+			tag := string(buf[off : off+4])
+			if (tag == "Xing" || tag == "Info") && buf[off+7]&0x01 != 0 {
+				frames = int(binary.BigEndian.Uint32(buf[off+8 : off+12]))
+			}
+		}
+		if off := i + 4 + 32; frames == 0 && off+18 <= len(buf) && string(buf[off:off+4]) == "VBRI" {
+			frames = int(binary.BigEndian.Uint32(buf[off+14 : off+18]))
+		}
+		if frames > 0 && sampleRate > 0 {
+			return frames * samplesPerFrame / sampleRate
+		}
+		if bitrate > 0 {
+			return int((fileSize - start - int64(i)) * 8 / int64(bitrate))
+		}
+		return 0
+	}
+	return 0
+}
+
+// ---- FLAC: STREAMINFO, VORBIS_COMMENT and PICTURE blocks ----
+
+// readFLACTags function: Walk the FLAC metadata blocks
+func readFLACTags(file *os.File, tags *audioTags) error {
+	reader := io.Reader(file)
+	if _, err := io.ReadFull(reader, make([]byte, 4)); err != nil {
+		return err
+	}
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		block := make([]byte, size)
+		if _, err := io.ReadFull(reader, block); err != nil {
+			return err
+		}
+		switch blockType {
+		case 0:
+			if len(block) >= 18 {
+				sampleRate := int(block[10])<<12 | int(block[11])<<4 | int(block[12])>>4
+				totalSamples := int64(block[13]&0x0f)<<32 | int64(binary.BigEndian.Uint32(block[14:18]))
+				if sampleRate > 0 {
+					tags.Duration = int(totalSamples / int64(sampleRate))
+				}
+			}
+		case 4:
+			parseVorbisComment(block, tags)
+		case 6:
+			parseFLACPicture(block, tags)
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// parseVorbisComment function: Read a little-endian Vorbis comment block shared by FLAC, Vorbis and Opus
+func parseVorbisComment(block []byte, tags *audioTags) {
+	readLen := func() (int, bool) {
+		if len(block) < 4 {
+			return 0, false
+		}
+		n := int(binary.LittleEndian.Uint32(block[:4]))
+		block = block[4:]
+		return n, n >= 0 && n <= len(block)
+	}
+	vendorLen, ok := readLen()
+	if !ok {
+		return
+	}
+	block = block[vendorLen:]
+	if len(block) < 4 {
+		return
+	}
+	count := int(binary.LittleEndian.Uint32(block[:4]))
+	block = block[4:]
+	var albumArtist string
+	for i := 0; i < count; i++ {
+		n, ok := readLen()
+		if !ok {
+			return
+		}
+		comment := string(block[:n])
+		block = block[n:]
+		eq := strings.IndexByte(comment, '=')
+		if eq < 0 {
+			continue
+		}
+		value := strings.TrimSpace(comment[eq+1:])
+		switch strings.ToUpper(comment[:eq]) {
+		case "TITLE":
+			tags.Title = value
+		case "ARTIST":
+			if tags.Artist == "" {
+				tags.Artist = value
+			} else {
+				tags.Artist += "/" + value
+			}
+		case "ALBUMARTIST", "ALBUM ARTIST":
+			albumArtist = value
+		case "ALBUM":
+			tags.Album = value
+		case "GENRE":
+			tags.Genre = value
+		case "TRACKNUMBER":
+			tags.Track = parseTagNumber(value)
+		case "DISCNUMBER":
+			tags.Disc = parseTagNumber(value)
+		case "DATE", "YEAR":
+			tags.Year = parseTagYear(value)
+		case "METADATA_BLOCK_PICTURE":
+			if picture, err := base64.StdEncoding.DecodeString(value); err == nil {
+				parseFLACPicture(picture, tags)
+			}
+		}
+	}
+	if tags.Artist == "" {
+		tags.Artist = albumArtist
+	}
+}
+
+// parseFLACPicture function: Read a big-endian FLAC PICTURE block, front covers win
+func parseFLACPicture(block []byte, tags *audioTags) {
+	if len(block) < 8 {
+		return
+	}
+	pictureType := binary.BigEndian.Uint32(block[:4])
+	if tags.Picture != nil && pictureType != 3 {
+		return
+	}
+	pos := 4
+	mimeLen := int(binary.BigEndian.Uint32(block[pos:]))
+	pos += 4
+	if mimeLen < 0 || pos+mimeLen+4 > len(block) {
+		return
+	}
+	mime := string(block[pos : pos+mimeLen])
+	pos += mimeLen
+	descLen := int(binary.BigEndian.Uint32(block[pos:]))
+	pos += 4 + descLen + 16 // description, width, height, depth, colors
+	if descLen < 0 || pos+4 > len(block) {
+		return
+	}
+	dataLen := int(binary.BigEndian.Uint32(block[pos:]))
+	pos += 4
+	if dataLen <= 0 || pos+dataLen > len(block) {
+		return
+	}
+	tags.Picture = block[pos : pos+dataLen]
+	tags.PictureMIME = mime
+}
+
+// ---- OGG: Vorbis and Opus ----
+
+// readOggTags function: Reassemble the first packets for the comment header and read the last granule for the duration
+func readOggTags(file *os.File, tags *audioTags) error {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var packets [][]byte
+	var packet []byte
+	offset := int64(0)
+	for len(packets) < 2 && offset < fileInfo.Size() {
+		header := make([]byte, 27)
+		if _, err := file.ReadAt(header, offset); err != nil || string(header[:4]) != "OggS" {
+			break
+		}
+		segments := make([]byte, header[26])
+		if _, err := file.ReadAt(segments, offset+27); err != nil {
+			break
+		}
+		pos := offset + 27 + int64(len(segments))
+		for _, lacing := range segments {
+			data := make([]byte, lacing)
+			if _, err := file.ReadAt(data, pos); err != nil {
+				break
+			}
+			pos += int64(lacing)
+			packet = append(packet, data...)
+			if lacing < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+		offset = pos
+	}
+	if len(packets) < 2 {
+		return errNoTags
+	}
+
+	sampleRate := 0
+	id, comment := packets[0], packets[1]
+	switch {
+	case bytes.HasPrefix(id, []byte("\x01vorbis")) && len(id) >= 16 && bytes.HasPrefix(comment, []byte("\x03vorbis")):
+		sampleRate = int(binary.LittleEndian.Uint32(id[12:16]))
+		parseVorbisComment(comment[7:], tags)
+	case bytes.HasPrefix(id, []byte("OpusHead")) && bytes.HasPrefix(comment, []byte("OpusTags")):
+		sampleRate = 48000
+		parseVorbisComment(comment[8:], tags)
+	default:
+		return errNoTags
+	}
+
+	// The granule position of the last page is the total number of samples
+	tailSize := int64(65536)
+	if tailSize > fileInfo.Size() {
+		tailSize = fileInfo.Size()
+	}
+	tail := make([]byte, tailSize)
+	if _, err := file.ReadAt(tail, fileInfo.Size()-tailSize); err == nil || err == io.EOF {
+		if i := bytes.LastIndex(tail, []byte("OggS")); i >= 0 && i+14 <= len(tail) && sampleRate > 0 {
+			granule := int64(binary.LittleEndian.Uint64(tail[i+6 : i+14]))
+			if granule > 0 {
+				tags.Duration = int(granule / int64(sampleRate))
+			}
+		}
+	}
+	return nil
+}
+
+// ---- M4A/MP4: moov.mvhd and moov.udta.meta.ilst ----
+
+// mp4Atom function: Read the next atom header, returning its type and payload size
+func mp4Atom(data []byte) (string, []byte, []byte, bool) {
+	if len(data) < 8 {
+		return "", nil, nil, false
+	}
+	size := int64(binary.BigEndian.Uint32(data[:4]))
+	name := string(data[4:8])
+	headerLen := int64(8)
+	switch size {
+	case 0:
+		size = int64(len(data))
+	case 1:
+		if len(data) < 16 {
+			return "", nil, nil, false
+		}
+		size = int64(binary.BigEndian.Uint64(data[8:16]))
+		headerLen = 16
+	}
+	if size < headerLen || size > int64(len(data)) {
+		return "", nil, nil, false
+	}
+	return name, data[headerLen:size], data[size:], true
+}
+
+// readMP4Tags function: Locate the moov atom and read its duration and iTunes item list
+func readMP4Tags(file *os.File, tags *audioTags) error {
+	// Find moov among the top level atoms without loading the media data
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	var moov []byte
+	for offset := int64(0); offset+8 <= fileInfo.Size(); {
+		header := make([]byte, 16)
+		n, _ := file.ReadAt(header, offset)
+		if n < 8 {
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerLen := int64(8)
+		if size == 1 && n >= 16 {
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		} else if size == 0 {
+			size = fileInfo.Size() - offset
+		}
+		// A size pointing past the end of the file is corrupt, trusting it would allocate that much
+		if size < headerLen || size > fileInfo.Size()-offset {
+			break
+		}
+		if string(header[4:8]) == "moov" {
+			moov = make([]byte, min(size-headerLen, maxMP4MoovSize))
+			if _, err := file.ReadAt(moov, offset+headerLen); err != nil {
+				return err
+			}
+			break
+		}
+		offset += size
+	}
+	if moov == nil {
+		return errNoTags
+	}
+
+	for rest := moov; ; {
+		name, payload, next, ok := mp4Atom(rest)
+		if !ok {
+			break
+		}
+		rest = next
+		switch name {
+		case "mvhd":
+			parseMVHD(payload, tags)
+		case "udta":
+			for udta := payload; ; {
+				name, payload, next, ok := mp4Atom(udta)
+				if !ok {
+					break
+				}
+				udta = next
+				if name == "meta" && len(payload) > 4 {
+					parseMP4Meta(payload[4:], tags)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseMVHD function: Read the timescale and duration of the movie header
+func parseMVHD(payload []byte, tags *audioTags) {
+	if len(payload) < 20 {
+		return
+	}
+	var timescale, duration uint64
+	if payload[0] == 1 {
+		if len(payload) < 32 {
+			return
+		}
+		timescale = uint64(binary.BigEndian.Uint32(payload[20:24]))
+		duration = binary.BigEndian.Uint64(payload[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(payload[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(payload[16:20]))
+	}
+	if timescale > 0 {
+		tags.Duration = int(duration / timescale)
+	}
+}
+
+// parseMP4Meta function: Read the ilst items of a meta atom
+func parseMP4Meta(meta []byte, tags *audioTags) {
+	for {
+		name, payload, next, ok := mp4Atom(meta)
+		if !ok {
+			return
+		}
+		meta = next
+		if name != "ilst" {
+			continue
+		}
+		for items := payload; ; {
+			item, itemPayload, next, ok := mp4Atom(items)
+			if !ok {
+				break
+			}
+			items = next
+			_, data, _, ok := mp4Atom(itemPayload)
+			if !ok || len(data) < 8 {
+				continue
+			}
+			dataType := binary.BigEndian.Uint32(data[:4]) & 0xffffff
+			value := data[8:]
+			switch item {
+			case "\xa9nam":
+				tags.Title = string(value)
+			case "\xa9ART":
+				tags.Artist = string(value)
+			case "aART":
+				if tags.Artist == "" {
+					tags.Artist = string(value)
+				}
+			case "\xa9alb":
+				tags.Album = string(value)
+			case "\xa9gen":
+				tags.Genre = string(value)
+			case "gnre":
+				if len(value) >= 2 {
+					if n := int(binary.BigEndian.Uint16(value)); n > 0 && n <= len(id3v1Genres) {
+						tags.Genre = id3v1Genres[n-1]
+					}
+				}
+			case "\xa9day":
+				tags.Year = parseTagYear(string(value))
+			case "trkn":
+				if len(value) >= 4 {
+					tags.Track = int(binary.BigEndian.Uint16(value[2:4]))
+				}
+			case "disk":
+				if len(value) >= 4 {
+					tags.Disc = int(binary.BigEndian.Uint16(value[2:4]))
+				}
+			case "covr":
+				if tags.Picture == nil && len(value) > 0 {
+					tags.Picture = value
+					tags.PictureMIME = "image/jpeg"
+					if dataType == 14 {
+						tags.PictureMIME = "image/png"
+					}
+				}
+			}
+		}
+	}
+}
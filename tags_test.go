@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// id3v2Frame Build an ID3v2.3 or ID3v2.4 frame
+func id3v2Frame(version byte, id string, data []byte) []byte {
+	frame := []byte(id)
+	size := make([]byte, 4)
+	if version == 4 {
+		n := len(data)
+		size = []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	} else {
+		binary.BigEndian.PutUint32(size, uint32(len(data)))
+	}
+	frame = append(frame, size...)
+	frame = append(frame, 0, 0)
+	return append(frame, data...)
+}
+
+// id3v2Tag Build an ID3v2 tag around frames
+func id3v2Tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	n := len(body)
+	header := []byte{'I', 'D', '3', version, 0, 0, byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	return append(header, body...)
+}
+
+// vorbisComment Build a little-endian Vorbis comment block
+func vorbisComment(comments ...string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(4))
+	buf.WriteString("test")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(comment)))
+		buf.WriteString(comment)
+	}
+	return buf.Bytes()
+}
+
+// mp4Box Build an MP4 atom
+func mp4Box(name string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	box := make([]byte, 8)
+	binary.BigEndian.PutUint32(box, uint32(len(body)+8))
+	copy(box[4:], name)
+	return append(box, body...)
+}
+
+// writeTestFile Write a test file into a directory
+func writeTestFile(t *testing.T, dir string, name string, content []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatalf("Cannot create directory: %s", err)
+	}
+	if err := os.WriteFile(path, content, 0666); err != nil {
+		t.Fatalf("Cannot create file: %s", err)
+	}
+	return path
+}
+
+// TestReadAudioTagsMP3 Test readAudioTags function for ID3v2.3, ID3v2.4 and ID3v1 tags
+func TestReadAudioTagsMP3(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// ID3v2.3 with UTF-16 text and a genre reference
+	utf16Title := []byte{1, 0xff, 0xfe, 'Q', 0, 'i', 0, 'n', 0, 'g', 0}
+	v23 := id3v2Tag(3,
+		id3v2Frame(3, "TIT2", utf16Title),
+		id3v2Frame(3, "TPE1", append([]byte{0}, "Jay-Chou"...)),
+		id3v2Frame(3, "TCON", append([]byte{0}, "(13)"...)),
+		id3v2Frame(3, "TRCK", append([]byte{0}, "3/10"...)),
+		id3v2Frame(3, "TYER", append([]byte{0}, "2003"...)),
+		id3v2Frame(3, "APIC", append([]byte{0}, "image/png\x00\x03cover\x00PNGDATA"...)),
+	)
+	tags, err := readAudioTags(writeTestFile(t, tempDir, "v23.mp3", v23))
+	if err != nil {
+		t.Fatalf("readAudioTags returns error: %s", err)
+	}
+	if tags.Title != "Qing" || tags.Artist != "Jay-Chou" || tags.Genre != "Pop" || tags.Track != 3 || tags.Year != 2003 {
+		t.Errorf("Unexpected ID3v2.3 tags: %+v", tags)
+	}
+	if string(tags.Picture) != "PNGDATA" || tags.PictureMIME != "image/png" {
+		t.Errorf("Unexpected ID3v2.3 picture: %q %q", tags.Picture, tags.PictureMIME)
+	}
+
+	// ID3v2.4 with UTF-8 text, ID3v1 fills the missing album
+	v24 := id3v2Tag(4,
+		id3v2Frame(4, "TIT2", append([]byte{3}, "晴天"...)),
+		id3v2Frame(4, "TDRC", append([]byte{3}, "2003-07-31"...)),
+		id3v2Frame(4, "TPOS", append([]byte{3}, "2"...)),
+	)
+	v1 := make([]byte, 128)
+	copy(v1, "TAG")
+	copy(v1[63:], "Ye Hui Mei")
+	v1[127] = 255
+	tags, err = readAudioTags(writeTestFile(t, tempDir, "v24.mp3", append(v24, v1...)))
+	if err != nil {
+		t.Fatalf("readAudioTags returns error: %s", err)
+	}
+	if tags.Title != "晴天" || tags.Album != "Ye Hui Mei" || tags.Year != 2003 || tags.Disc != 2 {
+		t.Errorf("Unexpected ID3v2.4 tags: %+v", tags)
+	}
+
+	// CBR duration estimate: MPEG1 layer III, 128 kbit/s, 44100 Hz
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	audio := bytes.Repeat(frame, 320) // 133440 bytes = 8.34 seconds
+	tags, err = readAudioTags(writeTestFile(t, tempDir, "cbr.mp3", audio))
+	if err != nil {
+		t.Fatalf("readAudioTags returns error: %s", err)
+	}
+	if tags.Duration != 8 {
+		t.Errorf("Duration error: got %d, want %d", tags.Duration, 8)
+	}
+}
+
+// TestReadAudioTagsFLAC Test readAudioTags function for FLAC Vorbis comments and pictures
+func TestReadAudioTagsFLAC(t *testing.T) {
+	// STREAMINFO: 44100 Hz and 441000 samples
+	streamInfo := make([]byte, 34)
+	sampleRate := 44100
+	streamInfo[10] = byte(sampleRate >> 12)
+	streamInfo[11] = byte(sampleRate >> 4)
+	streamInfo[12] = byte(sampleRate << 4)
+	binary.BigEndian.PutUint32(streamInfo[14:18], 441000)
+
+	comment := vorbisComment("TITLE=Sunny Day", "ARTIST=A-ha", "ALBUM=Hunting High", "TRACKNUMBER=07", "DISCNUMBER=1/2", "DATE=1985", "GENRE=Synthpop")
+
+	var picture bytes.Buffer
+	binary.Write(&picture, binary.BigEndian, uint32(3))
+	binary.Write(&picture, binary.BigEndian, uint32(len("image/jpeg")))
+	picture.WriteString("image/jpeg")
+	binary.Write(&picture, binary.BigEndian, uint32(0))
+	picture.Write(make([]byte, 16))
+	binary.Write(&picture, binary.BigEndian, uint32(4))
+	picture.WriteString("JPEG")
+
+	block := func(blockType byte, last bool, data []byte) []byte {
+		if last {
+			blockType |= 0x80
+		}
+		return append([]byte{blockType, byte(len(data) >> 16), byte(len(data) >> 8), byte(len(data))}, data...)
+	}
+	content := []byte("fLaC")
+	content = append(content, block(0, false, streamInfo)...)
+	content = append(content, block(4, false, comment)...)
+	content = append(content, block(6, true, picture.Bytes())...)
+
+	tags, err := readAudioTags(writeTestFile(t, t.TempDir(), "song.flac", content))
+	if err != nil {
+		t.Fatalf("readAudioTags returns error: %s", err)
+	}
+	want := audioTags{Title: "Sunny Day", Artist: "A-ha", Album: "Hunting High", Genre: "Synthpop", Track: 7, Disc: 1, Year: 1985, Duration: 10}
+	got := *tags
+	got.Picture, got.PictureMIME = nil, ""
+	if got.Title != want.Title || got.Artist != want.Artist || got.Album != want.Album || got.Genre != want.Genre ||
+		got.Track != want.Track || got.Disc != want.Disc || got.Year != want.Year || got.Duration != want.Duration {
+		t.Errorf("Unexpected FLAC tags: got %+v, want %+v", got, want)
+	}
+	if string(tags.Picture) != "JPEG" || tags.PictureMIME != "image/jpeg" {
+		t.Errorf("Unexpected FLAC picture: %q %q", tags.Picture, tags.PictureMIME)
+	}
+}
+
+// TestReadAudioTagsOgg Test readAudioTags function for Ogg Vorbis files
+func TestReadAudioTagsOgg(t *testing.T) {
+	page := func(granule uint64, packets ...[]byte) []byte {
+		var segments, body []byte
+		for _, packet := range packets {
+			n := len(packet)
+			for n >= 255 {
+				segments = append(segments, 255)
+				n -= 255
+			}
+			segments = append(segments, byte(n))
+			body = append(body, packet...)
+		}
+		header := make([]byte, 27)
+		copy(header, "OggS")
+		binary.LittleEndian.PutUint64(header[6:14], granule)
+		header[26] = byte(len(segments))
+		return append(append(header, segments...), body...)
+	}
+
+	id := make([]byte, 30)
+	copy(id, "\x01vorbis")
+	binary.LittleEndian.PutUint32(id[12:16], 48000)
+	comment := append([]byte("\x03vorbis"), vorbisComment("TITLE=Ogg Song", "ARTIST=Ogg Singer", "ALBUM=Ogg Album")...)
+	// Pad the comment so it spans more than one lacing segment
+	comment = append(comment, bytes.Repeat([]byte{0}, 300)...)
+
+	content := page(0, id)
+	content = append(content, page(0, comment)...)
+	content = append(content, page(48000*42, []byte("audio"))...)
+
+	tags, err := readAudioTags(writeTestFile(t, t.TempDir(), "song.ogg", content))
+	if err != nil {
+		t.Fatalf("readAudioTags returns error: %s", err)
+	}
+	if tags.Title != "Ogg Song" || tags.Artist != "Ogg Singer" || tags.Album != "Ogg Album" || tags.Duration != 42 {
+		t.Errorf("Unexpected Ogg tags: %+v", tags)
+	}
+}
+
+// TestReadAudioTagsMP4 Test readAudioTags function for M4A files
+func TestReadAudioTagsMP4(t *testing.T) {
+	item := func(name string, dataType uint32, value []byte) []byte {
+		data := make([]byte, 8)
+		binary.BigEndian.PutUint32(data, dataType)
+		return mp4Box(name, mp4Box("data", data, value))
+	}
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:20], 215000)
+
+	ilst := mp4Box("ilst",
+		item("\xa9nam", 1, []byte("M4A Song")),
+		item("\xa9ART", 1, []byte("M4A Singer")),
+		item("\xa9alb", 1, []byte("M4A Album")),
+		item("\xa9day", 1, []byte("2010-01-01T00:00:00Z")),
+		item("trkn", 0, []byte{0, 0, 0, 5, 0, 12, 0, 0}),
+		item("disk", 0, []byte{0, 0, 0, 1, 0, 1}),
+		item("gnre", 0, []byte{0, 14}),
+		item("covr", 14, []byte("PNG")),
+	)
+	moov := mp4Box("moov", mp4Box("mvhd", mvhd), mp4Box("udta", mp4Box("meta", make([]byte, 4), ilst)))
+	content := append(mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00")), mp4Box("mdat", []byte("audio"))...)
+	content = append(content, moov...)
+
+	tags, err := readAudioTags(writeTestFile(t, t.TempDir(), "song.m4a", content))
+	if err != nil {
+		t.Fatalf("readAudioTags returns error: %s", err)
+	}
+	if tags.Title != "M4A Song" || tags.Artist != "M4A Singer" || tags.Album != "M4A Album" || tags.Year != 2010 ||
+		tags.Track != 5 || tags.Disc != 1 || tags.Genre != "Pop" || tags.Duration != 215 {
+		t.Errorf("Unexpected M4A tags: %+v", tags)
+	}
+	if string(tags.Picture) != "PNG" || tags.PictureMIME != "image/png" {
+		t.Errorf("Unexpected M4A picture: %q %q", tags.Picture, tags.PictureMIME)
+	}
+}
+
+// TestReadAudioTagsMP4Corrupt Test readAudioTags function for M4A files whose atom sizes point past the end
+func TestReadAudioTagsMP4Corrupt(t *testing.T) {
+	ftyp := mp4Box("ftyp", []byte("M4A \x00\x00\x00\x00"))
+	largeMoov := make([]byte, 16)
+	binary.BigEndian.PutUint32(largeMoov[:4], 1)
+	copy(largeMoov[4:8], "moov")
+	binary.BigEndian.PutUint64(largeMoov[8:16], 1<<62)
+	oversizedMoov := mp4Box("moov", make([]byte, 32))
+	binary.BigEndian.PutUint32(oversizedMoov[:4], 0xFFFFFFF0)
+	truncatedMoov := mp4Box("moov", mp4Box("mvhd", make([]byte, 20)))
+	truncatedMoov = truncatedMoov[:len(truncatedMoov)-4]
+
+	cases := map[string][]byte{
+		"largesize": append(append([]byte{}, ftyp...), largeMoov...),
+		"oversized": append(append([]byte{}, ftyp...), oversizedMoov...),
+		"truncated": append(append([]byte{}, ftyp...), truncatedMoov...),
+		"tiny":      append(append([]byte{}, ftyp...), 0, 0, 0, 1, 'm', 'o', 'o', 'v'),
+	}
+	for name, content := range cases {
+		if _, err := readAudioTags(writeTestFile(t, t.TempDir(), "song.m4a", content)); err != errNoTags {
+			t.Errorf("%s: readAudioTags returns %v, want errNoTags", name, err)
+		}
+	}
+}
+
+// TestScanArtistSongFoldersTags Test scanArtistSongFolders function with tagged and untagged files
+func TestScanArtistSongFoldersTags(t *testing.T) {
+	root := t.TempDir()
+
+	// Tags win over the folder name, so a hyphen in the artist is kept
+	tagged := id3v2Tag(3,
+		id3v2Frame(3, "TIT2", append([]byte{0}, "Take On Me"...)),
+		id3v2Frame(3, "TPE1", append([]byte{0}, "A-ha"...)),
+	)
+	writeTestFile(t, root, "A-ha-Take On Me@Hunting/standard.mp3", tagged)
+
+	// Untagged legacy folder falls back to the folder name
+	writeTestFile(t, root, "Singer-Song@Album/cover.png", []byte("png"))
+
+	// Flat files are visible, with "Artist - Title" file names as fallback
+	writeTestFile(t, root, "Loose/Some Artist - Loose Song.mp3", []byte("not really audio"))
+	writeTestFile(t, root, "cache/hidden.mp3", []byte("private"))
+
+	found := map[string]artistSongFolder{}
+	for _, folder := range scanArtistSongFolders(root) {
+		found[folder.songName] = folder
+	}
+	if len(found) != 3 {
+		t.Fatalf("Expected 3 songs, got %d: %+v", len(found), found)
+	}
+	if folder := found["Take On Me"]; folder.artistName != "A-ha" || folder.albumName != "Hunting" {
+		t.Errorf("Unexpected tagged folder: %+v", folder)
+	}
+	if folder := found["Song"]; folder.artistName != "Singer" || folder.albumName != "Album" {
+		t.Errorf("Unexpected legacy folder: %+v", folder)
+	}
+	if folder := found["Loose Song"]; folder.artistName != "Some Artist" || folder.albumName != "Loose" || folder.audioFile != filepath.Join("Loose", "Some Artist - Loose Song.mp3") {
+		t.Errorf("Unexpected flat file: %+v", folder)
+	}
+}
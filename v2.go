@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Song of /api/v2, every field is typed and always present.
+type songV2 struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Artist   string   `json:"artist"`
+	Album    string   `json:"album"`
+	Cover    string   `json:"cover"`
+	MusicURL MusicURL `json:"music_url"`
+	Lyric    lyricV2  `json:"lyric"`
+	Track    int      `json:"track"`
+	Disc     int      `json:"disc"`
+	Year     int      `json:"year"`
+	Genre    string   `json:"genre"`
+	Duration int      `json:"duration"` // seconds
+	Source   string   `json:"source"`
+}
+
+// Lyric URLs of /api/v2, with the formats lyricHandler converts, which the legacy Lyric leaves out.
+type lyricV2 struct {
+	Mrc string `json:"mrc"`
+	Lrc string `json:"lrc"`
+	Txt string `json:"txt"`
+	Vtt string `json:"vtt"` // WebVTT for HTML5 <track>
+	Srt string `json:"srt"`
+}
+
+// Error of /api/v2, Code is a stable machine readable name of the problem.
+type errorV2 struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Body of /api/v2 errors.
+type errorResponseV2 struct {
+	Error errorV2 `json:"error"`
+}
+
+// Body of /api/v2 lists, Data holds the page from Offset.
+type listResponseV2 struct {
+	Data          interface{} `json:"data"`
+	Total         int         `json:"total"`
+	Offset        int         `json:"offset"`
+	Cache         string      `json:"cache,omitempty"` // Timestamp of the cached search, "no-cache" for local songs only
+	CacheUpdating bool        `json:"cache_updating,omitempty"`
+}
+
+// Body of /api/v2 single resources.
+type itemResponseV2 struct {
+	Data interface{} `json:"data"`
+}
+
+// An album of /api/v2 with its songs.
+type albumDetailV2 struct {
+	*catalogAlbum
+	Songs []songV2 `json:"songs"`
+}
+
+// An artist of /api/v2 with its albums.
+type artistDetailV2 struct {
+	*catalogArtist
+	Albums []*catalogAlbum `json:"albums"`
+}
+
+// toSongV2 function: Convert a Song to its typed /api/v2 form
+func toSongV2(song Song) songV2 {
+	typedSongFields(&song)
+	musicURL, _ := song.MusicURL.(MusicURL)
+	lyric, _ := song.Lyric.(Lyric)
+	return songV2{
+		ID:       song.ID,
+		Title:    song.Song,
+		Artist:   song.Singer,
+		Album:    song.Album,
+		Cover:    song.Cover,
+		MusicURL: musicURL,
+		Lyric:    lyricV2(withDerivedLyrics(song.ID, lyric)),
+		Track:    song.Track,
+		Disc:     song.Disc,
+		Year:     song.Year,
+		Genre:    song.Genre,
+		Duration: song.Duration,
+		Source:   song.Source,
+	}
+}
+
+// Helper function to convert songs to their typed /api/v2 form
+func toSongsV2(songs []Song) []songV2 {
+	songsV2 := make([]songV2, 0, len(songs))
+	for _, song := range songs {
+		songsV2 = append(songsV2, toSongV2(song))
+	}
+	return songsV2
+}
+
+// Helper function to write a /api/v2 body with its status
+func writeV2(w http.ResponseWriter, status int, body interface{}) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Helper function to write a /api/v2 error
+func writeV2Error(w http.ResponseWriter, status int, code string, message string) {
+	writeV2(w, status, errorResponseV2{Error: errorV2{Status: status, Code: code, Message: message}})
+}
+
+// Helper function to write a page of a /api/v2 list, read from page/page_size or offset/limit
+func writeV2List(w http.ResponseWriter, r *http.Request, items []interface{}) {
+	page, err := parsePageParams(r.URL.Query())
+	if err != nil {
+		writeV2Error(w, http.StatusBadRequest, "invalid_page", "Invalid 'page', 'page_size', 'offset' or 'limit' parameter.")
+		return
+	}
+	start := min(page.Offset, len(items))
+	end := len(items)
+	if page.Limit > 0 {
+		end = min(start+page.Limit, len(items))
+	}
+	writeV2(w, http.StatusOK, listResponseV2{Data: items[start:end], Total: len(items), Offset: page.Offset})
+}
+
+// apiV2Handler function: Serve the resources of /api/v2, songs, artists, albums, lyrics, covers and search
+func apiV2Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", "MeowMusicServer")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeV2Error(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is supported.")
+		return
+	}
+
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v2"), "/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] == "search":
+		searchV2(w, r)
+	case len(segments) == 1 && segments[0] == "songs":
+		songsV2(w, r)
+	case segments[0] == "songs" && len(segments) >= 2 && len(segments) <= 4:
+		songV2Handler(w, r, segments[1], strings.Join(segments[2:], "/"))
+	case segments[0] == "artists" && len(segments) <= 3:
+		artistsV2(w, r, segments[1:])
+	case segments[0] == "albums" && len(segments) <= 3:
+		albumsV2(w, r, segments[1:])
+	default:
+		writeV2Error(w, http.StatusNotFound, "not_found", "No resource at "+r.URL.Path+".")
+	}
+}
+
+// Helper function to search like /api, from the cache or the local songs
+func searchV2(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	msg := normaliseQuery(queryParams.Get("q"))
+	if msg == "" {
+		msg = normaliseQuery(queryParams.Get("msg"))
+	}
+	if msg == "" {
+		writeV2Error(w, http.StatusBadRequest, "missing_parameter", "The 'q' parameter is required.")
+		return
+	}
+	filters, code, errMsg := checkSearchRequest(msg, queryParams)
+	switch code {
+	case 0:
+	case 5:
+		writeV2Error(w, http.StatusBadRequest, "invalid_query", errMsg)
+		return
+	default:
+		writeV2Error(w, http.StatusBadRequest, "invalid_parameter", errMsg)
+		return
+	}
+	page, err := parsePageParams(queryParams)
+	if err != nil {
+		writeV2Error(w, http.StatusBadRequest, "invalid_page", "Invalid 'page', 'page_size', 'offset' or 'limit' parameter.")
+		return
+	}
+
+	songs, cache := cachedSearch(msg, filters)
+	writeV2(w, http.StatusOK, listResponseV2{
+		Data:          toSongsV2(paginate(songs, page)),
+		Total:         len(songs),
+		Offset:        page.Offset,
+		Cache:         cache,
+		CacheUpdating: true,
+	})
+}
+
+// Helper function to list the local songs by title, or only those of ?initial=
+func songsV2(w http.ResponseWriter, r *http.Request) {
+	initial, ok := initialParam(w, r)
+	if !ok {
+		return
+	}
+	var songs []Song
+	for _, song := range localSongs() {
+		if initial == "" || nameInitial(song.Song) == initial {
+			songs = append(songs, song)
+		}
+	}
+	sortSongs(songs)
+	writeV2List(w, r, songItemsV2(songs))
+}
+
+// Helper function to serve a song, its lyric URLs or its cover
+func songV2Handler(w http.ResponseWriter, r *http.Request, id string, resource string) {
+	if !isSongID(id) {
+		writeV2Error(w, http.StatusBadRequest, "invalid_id", "Invalid song id.")
+		return
+	}
+	song, ok := findSong(id)
+	if !ok {
+		writeV2Error(w, http.StatusNotFound, "not_found", "No song found for the given id.")
+		return
+	}
+	songV2 := toSongV2(resolveSong(r.Context(), song))
+	switch resource {
+	case "":
+		writeV2(w, http.StatusOK, itemResponseV2{Data: songV2})
+	case "lyrics":
+		if songV2.Lyric == (lyricV2{}) {
+			writeV2Error(w, http.StatusNotFound, "not_found", "The song has no lyrics.")
+			return
+		}
+		writeV2(w, http.StatusOK, itemResponseV2{Data: songV2.Lyric})
+	case "lyrics/lines":
+		lyricLinesV2(w, r, Lyric(songV2.Lyric))
+	case "cover":
+		if songV2.Cover == "" {
+			writeV2Error(w, http.StatusNotFound, "not_found", "The song has no cover.")
+			return
+		}
+		http.Redirect(w, r, songV2.Cover, http.StatusFound)
+	default:
+		writeV2Error(w, http.StatusNotFound, "not_found", "No resource at "+r.URL.Path+".")
+	}
+}
+
+// Helper function to read ?initial=, the A to Z group a list is limited to
+func initialParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	initial := strings.ToUpper(r.URL.Query().Get("initial"))
+	if initial != "" && initial != otherInitial && (len(initial) != 1 || initial[0] < 'A' || initial[0] > 'Z') {
+		writeV2Error(w, http.StatusBadRequest, "invalid_parameter", "Invalid 'initial' parameter, A to Z or '"+otherInitial+"'.")
+		return "", false
+	}
+	return initial, true
+}
+
+// Helper function to convert songs to a /api/v2 list
+func songItemsV2(songs []Song) []interface{} {
+	items := make([]interface{}, 0, len(songs))
+	for _, song := range toSongsV2(songs) {
+		items = append(items, song)
+	}
+	return items
+}
+
+// Helper function to serve the parsed lyrics of a song, or with ?t= only the line at that time
+func lyricLinesV2(w http.ResponseWriter, r *http.Request, lyric Lyric) {
+	time, err := 0, error(nil)
+	hasTime := r.URL.Query().Has("t")
+	if hasTime {
+		time, err = strconv.Atoi(r.URL.Query().Get("t"))
+		if err != nil || time < 0 {
+			writeV2Error(w, http.StatusBadRequest, "invalid_parameter", "Invalid 't' parameter, a position in milliseconds.")
+			return
+		}
+	}
+	lyrics, err := loadLyrics(r.Context(), lyric)
+	switch {
+	case errors.Is(err, errNoLyrics):
+		writeV2Error(w, http.StatusNotFound, "not_found", "The song has no lyrics.")
+	case err != nil:
+		fmt.Println("Error loading lyrics: ", err)
+		writeV2Error(w, http.StatusBadGateway, "lyrics_unavailable", "The lyrics of the song cannot be read.")
+	case hasTime:
+		writeV2(w, http.StatusOK, itemResponseV2{Data: lyrics.at(time)})
+	default:
+		writeV2(w, http.StatusOK, itemResponseV2{Data: lyrics})
+	}
+}
+
+// Helper function to list the artists, their initials, or show one with its albums or songs
+func artistsV2(w http.ResponseWriter, r *http.Request, segments []string) {
+	catalog := buildCatalog()
+	if len(segments) == 0 {
+		initial, ok := initialParam(w, r)
+		if !ok {
+			return
+		}
+		items := make([]interface{}, 0, len(catalog.artists))
+		for _, artist := range catalog.artists {
+			if initial == "" || artist.Initial == initial {
+				items = append(items, artist)
+			}
+		}
+		writeV2List(w, r, items)
+		return
+	}
+	if len(segments) == 1 && segments[0] == "initials" {
+		names := make([]string, 0, len(catalog.artists))
+		for _, artist := range catalog.artists {
+			names = append(names, artist.Name)
+		}
+		writeV2(w, http.StatusOK, itemResponseV2{Data: initials(names)})
+		return
+	}
+	artist, ok := catalog.artist(segments[0])
+	if !ok {
+		writeV2Error(w, http.StatusNotFound, "not_found", "No artist found for the given id.")
+		return
+	}
+	switch strings.Join(segments[1:], "") {
+	case "":
+		writeV2(w, http.StatusOK, itemResponseV2{Data: artistDetailV2{catalogArtist: artist, Albums: catalog.albumsOf(artist.ID)}})
+	case "albums":
+		items := []interface{}{}
+		for _, album := range catalog.albumsOf(artist.ID) {
+			items = append(items, album)
+		}
+		writeV2List(w, r, items)
+	case "songs":
+		writeV2List(w, r, songItemsV2(artist.songs))
+	default:
+		writeV2Error(w, http.StatusNotFound, "not_found", "No resource at "+r.URL.Path+".")
+	}
+}
+
+// Helper function to list the albums, their initials, or show one with its songs
+func albumsV2(w http.ResponseWriter, r *http.Request, segments []string) {
+	catalog := buildCatalog()
+	if len(segments) == 0 {
+		initial, ok := initialParam(w, r)
+		if !ok {
+			return
+		}
+		items := make([]interface{}, 0, len(catalog.albums))
+		for _, album := range catalog.albums {
+			if initial == "" || album.Initial == initial {
+				items = append(items, album)
+			}
+		}
+		writeV2List(w, r, items)
+		return
+	}
+	if len(segments) == 1 && segments[0] == "initials" {
+		names := make([]string, 0, len(catalog.albums))
+		for _, album := range catalog.albums {
+			names = append(names, album.Title)
+		}
+		writeV2(w, http.StatusOK, itemResponseV2{Data: initials(names)})
+		return
+	}
+	album, ok := catalog.album(segments[0])
+	if !ok {
+		writeV2Error(w, http.StatusNotFound, "not_found", "No album found for the given id.")
+		return
+	}
+	switch strings.Join(segments[1:], "") {
+	case "":
+		writeV2(w, http.StatusOK, itemResponseV2{Data: albumDetailV2{catalogAlbum: album, Songs: toSongsV2(album.songs)}})
+	case "songs":
+		writeV2List(w, r, songItemsV2(album.songs))
+	default:
+		writeV2Error(w, http.StatusNotFound, "not_found", "No resource at "+r.URL.Path+".")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Helper function to call apiV2Handler and decode its body
+func apiV2TestRequest(t *testing.T, method string, target string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	apiV2Handler(rr, httptest.NewRequest(method, target, nil))
+	backgroundRefreshes.Wait()
+	var body map[string]interface{}
+	if rr.Code != http.StatusFound {
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Cannot decode response of %s: %s", target, err)
+		}
+	}
+	return rr, body
+}
+
+// Helper function to return the sorted keys of a decoded JSON object
+func jsonKeys(value interface{}) []string {
+	var keys []string
+	for key := range value.(map[string]interface{}) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestAPIV2Search Test the status codes and typed songs of /api/v2/search
+func TestAPIV2Search(t *testing.T) {
+	setupAPITest(t, 12)
+
+	rr, body := apiV2TestRequest(t, "GET", "/api/v2/search?q=Song&singer=Singer%201&page_size=2")
+	if rr.Code != http.StatusOK || body["total"] != 4.0 || len(body["data"].([]interface{})) != 2 {
+		t.Fatalf("Unexpected search: %d %v", rr.Code, body)
+	}
+	song := body["data"].([]interface{})[0].(map[string]interface{})
+	want := []string{"album", "artist", "cover", "disc", "duration", "genre", "id", "lyric", "music_url", "source", "title", "track", "year"}
+	if keys := jsonKeys(song); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Song fields %v, want %v", keys, want)
+	}
+	if len(jsonKeys(song["music_url"])) != 6 || len(jsonKeys(song["lyric"])) != 5 {
+		t.Errorf("Every quality and lyric format should be present: %v", song)
+	}
+
+	if rr, body := apiV2TestRequest(t, "GET", "/api/v2/search?q=Nothing"); rr.Code != http.StatusOK || body["total"] != 0.0 || len(body["data"].([]interface{})) != 0 {
+		t.Errorf("A search without results should be an empty list: %d %v", rr.Code, body)
+	}
+	errors := map[string]string{
+		"/api/v2/search":                                             "missing_parameter",
+		"/api/v2/search?q=%22Song":                                   "invalid_query",
+		"/api/v2/search?q=Song&quality=ultra":                        "invalid_parameter",
+		"/api/v2/search?q=Song&page=0":                               "invalid_page",
+		"/api/v2/search?q=Song&page=1&offset=1":                      "invalid_page",
+		"/api/v2/search?q=Song&page=4611686018427387905&page_size=3": "invalid_page",
+		"/api/v2/artists?page=4611686018427387905&page_size=3":       "invalid_page",
+		"/api/v2/albums?page=4611686018427387905&page_size=3":        "invalid_page",
+	}
+	for target, code := range errors {
+		rr, body := apiV2TestRequest(t, "GET", target)
+		errorObject, _ := body["error"].(map[string]interface{})
+		if rr.Code != http.StatusBadRequest || errorObject["code"] != code || errorObject["status"] != 400.0 || errorObject["message"] == "" {
+			t.Errorf("%s: got %d %v, want 400 %s", target, rr.Code, body, code)
+		}
+	}
+}
+
+// TestAPIV2Resources Test songs, lyrics, covers, artists and albums of /api/v2
+func TestAPIV2Resources(t *testing.T) {
+	setupAPITest(t, 0)
+	t.Setenv("HOME_URL", "http://music.example")
+	root := os.Getenv("MEDIA_ROOT")
+	writeTestFile(t, root, "Alice-Rain@Spring/standard.mp3", []byte("audio"))
+	writeTestFile(t, root, "Alice-Rain@Spring/lyric.lrc", []byte("[00:00.00]la"))
+	writeTestFile(t, root, "Alice-Rain@Spring/cover.jpg", []byte("jpg"))
+	writeTestFile(t, root, "Alice-Snow@Winter/standard.mp3", []byte("audio"))
+	metadata, _ := json.Marshal(Metadata{API: []API{}, Other: []OtherSong{{SongName: "Sun", Singer: "Bob", Album: "Summer"}}})
+	writeTestFile(t, root, "metadata.json", metadata)
+
+	rr, body := apiV2TestRequest(t, "GET", "/api/v2/artists")
+	artists := body["data"].([]interface{})
+	if rr.Code != http.StatusOK || body["total"] != 2.0 || artists[0].(map[string]interface{})["name"] != "Alice" {
+		t.Fatalf("Unexpected artists: %d %v", rr.Code, body)
+	}
+	alice := artists[0].(map[string]interface{})
+	if alice["song_count"] != 2.0 || alice["album_count"] != 2.0 {
+		t.Errorf("Unexpected counts: %v", alice)
+	}
+	_, body = apiV2TestRequest(t, "GET", "/api/v2/artists/"+alice["id"].(string))
+	albums := body["data"].(map[string]interface{})["albums"].([]interface{})
+	if len(albums) != 2 || albums[0].(map[string]interface{})["title"] != "Spring" {
+		t.Fatalf("Unexpected albums of Alice: %v", body)
+	}
+
+	spring := albums[0].(map[string]interface{})
+	if spring["cover"] != "http://music.example/file/Alice-Rain@Spring/cover.jpg" {
+		t.Errorf("Unexpected album cover: %v", spring)
+	}
+	_, body = apiV2TestRequest(t, "GET", "/api/v2/albums/"+spring["id"].(string))
+	songs := body["data"].(map[string]interface{})["songs"].([]interface{})
+	if len(songs) != 1 || songs[0].(map[string]interface{})["title"] != "Rain" {
+		t.Fatalf("Unexpected songs of Spring: %v", body)
+	}
+	id := songs[0].(map[string]interface{})["id"].(string)
+
+	if rr, body := apiV2TestRequest(t, "GET", "/api/v2/songs/"+id); rr.Code != http.StatusOK || body["data"].(map[string]interface{})["artist"] != "Alice" {
+		t.Errorf("Unexpected song: %d %v", rr.Code, body)
+	}
+	if rr, body := apiV2TestRequest(t, "GET", "/api/v2/songs/"+id+"/lyrics"); rr.Code != http.StatusOK || body["data"].(map[string]interface{})["lrc"] == "" {
+		t.Errorf("Unexpected lyrics: %d %v", rr.Code, body)
+	}
+	if rr, _ := apiV2TestRequest(t, "GET", "/api/v2/songs/"+id+"/cover"); rr.Code != http.StatusFound || rr.Header().Get("Location") != spring["cover"] {
+		t.Errorf("Unexpected cover redirect: %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// Every local song by title, a page at a time
+	rr, body = apiV2TestRequest(t, "GET", "/api/v2/songs?page=2&page_size=2")
+	if list := body["data"].([]interface{}); rr.Code != http.StatusOK || body["total"] != 3.0 || body["offset"] != 2.0 || len(list) != 1 || list[0].(map[string]interface{})["title"] != "Sun" {
+		t.Errorf("Unexpected page of songs: %d %v", rr.Code, body)
+	}
+	rr, body = apiV2TestRequest(t, "GET", "/api/v2/songs?initial=S")
+	if list := body["data"].([]interface{}); rr.Code != http.StatusOK || len(list) != 2 || list[0].(map[string]interface{})["title"] != "Snow" {
+		t.Errorf("Unexpected songs of S: %d %v", rr.Code, body)
+	}
+
+	statuses := map[string]int{
+		"/api/v2/songs?page=0":                         http.StatusBadRequest,
+		"/api/v2/songs?initial=ab":                     http.StatusBadRequest,
+		"/api/v2/songs/" + id + "/nothing":             http.StatusNotFound,
+		"/api/v2/songs/0123456789abcdef":               http.StatusNotFound,
+		"/api/v2/songs/not-an-id":                      http.StatusBadRequest,
+		"/api/v2/albums/0123456789abcdef":              http.StatusNotFound,
+		"/api/v2/artists/0123456789abcdef":             http.StatusNotFound,
+		"/api/v2/unknown":                              http.StatusNotFound,
+		"/api/v2/artists?page=0":                       http.StatusBadRequest,
+		"/api/v2/albums?page=2&page_size=2":            http.StatusOK,
+		"/api/v2/songs/" + albumID("Alice", "Snow"):    http.StatusNotFound,
+		"/api/v2/albums/" + albumID("alice", "SPRING"): http.StatusOK,
+	}
+	for target, status := range statuses {
+		if rr, body := apiV2TestRequest(t, "GET", target); rr.Code != status || (status != http.StatusOK && body["error"] == nil) {
+			t.Errorf("%s: got %d %v, want %d", target, rr.Code, body, status)
+		}
+	}
+	if rr, _ := apiV2TestRequest(t, "POST", "/api/v2/artists"); rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") == "" {
+		t.Errorf("POST got %d, want 405 with Allow", rr.Code)
+	}
+}
+
+// TestLegacyAPIShape Test that /api keeps the fields existing devices decode
+func TestLegacyAPIShape(t *testing.T) {
+	setupAPITest(t, 3)
+	for _, target := range []string{"/api?msg=Song", "/api?msg=Song", "/api?msg=Nothing", "/api"} {
+		rr := httptest.NewRecorder()
+		apiHandler(rr, httptest.NewRequest("GET", target, nil))
+		backgroundRefreshes.Wait()
+		var body map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		keys := jsonKeys(body)
+		want := []string{"cache", "cache_updating", "code", "data", "ip", "msg", "tips"}
+		if body["code"] == 0.0 {
+			want = []string{"cache", "cache_updating", "code", "data", "ip", "msg", "tips", "total"}
+		}
+		if rr.Code != http.StatusOK || !reflect.DeepEqual(keys, want) {
+			t.Errorf("%s: got %d %v, want 200 %v", target, rr.Code, keys, want)
+		}
+		for _, song := range body["data"].([]interface{}) {
+			for _, key := range []string{"num", "song", "singer", "album", "cover", "music_url", "lyric"} {
+				if _, ok := song.(map[string]interface{})[key]; !ok {
+					t.Errorf("%s: song without %q: %v", target, key, song)
+				}
+			}
+			if keys := jsonKeys(song.(map[string]interface{})["lyric"]); !reflect.DeepEqual(keys, []string{"lrc", "mrc", "txt"}) {
+				t.Errorf("%s: lyric fields %v, want the legacy ones", target, keys)
+			}
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Source of "something below the media root may have changed" notifications.
+type fsNotifier interface {
+	// changes delivers a value whenever the tree may have changed.
+	changes() <-chan struct{}
+	// watchDirs registers directories created since the last call.
+	watchDirs(root string)
+	close() error
+}
+
+// Watches the media root and applies changes to the library index and the search cache.
+type libraryWatcher struct {
+	root         string
+	cacheDir     string
+	indexPath    string
+	notifier     fsNotifier
+	lastMetadata *Metadata
+	debounce     time.Duration
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+// watcherMode function: Return the watcher backend, set by WATCHER_MODE to auto, inotify or poll
+func watcherMode() string {
+	switch mode := strings.ToLower(os.Getenv("WATCHER_MODE")); mode {
+	case "inotify", "poll":
+		return mode
+	default:
+		return "auto"
+	}
+}
+
+// startLibraryWatcher function: Start watching the media root with the notifier of WATCHER_MODE
+func startLibraryWatcher() (*libraryWatcher, error) {
+	root := mediaRoot()
+	notifier, err := newFsNotifier(watcherMode(), root)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher := newLibraryWatcher(root, cacheDirPath(), libraryIndexPath(), notifier)
+	go watcher.run()
+	return watcher, nil
+}
+
+// newFsNotifier function: Create the notifier of a watcher mode, only "auto" falls back to polling when inotify fails
+func newFsNotifier(mode string, root string) (fsNotifier, error) {
+	if mode == "poll" {
+		return newPollNotifier(libraryScanInterval()), nil
+	}
+	notifier, err := newInotifyNotifier(root)
+	if err == nil {
+		return notifier, nil
+	}
+	if mode == "inotify" {
+		return nil, fmt.Errorf("cannot start the inotify watcher of WATCHER_MODE=inotify: %w", err)
+	}
+	fmt.Println("Error starting inotify watcher, falling back to polling: ", err)
+	return newPollNotifier(libraryScanInterval()), nil
+}
+
+// newLibraryWatcher function: Create a watcher around a notifier
+func newLibraryWatcher(root string, cacheDir string, indexPath string, notifier fsNotifier) *libraryWatcher {
+	watcher := &libraryWatcher{
+		root:      root,
+		cacheDir:  cacheDir,
+		indexPath: indexPath,
+		notifier:  notifier,
+		debounce:  500 * time.Millisecond,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	watcher.lastMetadata, _ = library.getMetadata()
+	return watcher
+}
+
+// run function: Apply changes until the watcher is stopped, bursts of events are debounced into one refresh
+func (watcher *libraryWatcher) run() {
+	defer close(watcher.done)
+	for {
+		select {
+		case <-watcher.stop:
+			return
+		case _, ok := <-watcher.notifier.changes():
+			if !ok {
+				return
+			}
+		}
+
+		timer := time.NewTimer(watcher.debounce)
+	debounce:
+		for {
+			select {
+			case <-watcher.stop:
+				timer.Stop()
+				return
+			case <-watcher.notifier.changes():
+			case <-timer.C:
+				break debounce
+			}
+		}
+		watcher.apply()
+	}
+}
+
+// apply function: Refresh the library index, persist it and invalidate the affected cache files
+func (watcher *libraryWatcher) apply() {
+	songs, changed, err := library.refreshSongs()
+	if err != nil {
+		fmt.Println("Error refreshing library index: ", err)
+	}
+	watcher.notifier.watchDirs(watcher.root)
+	if changed > 0 {
+		fmt.Printf("Library index updated, %d folders changed.\n", changed)
+		if err := library.save(watcher.indexPath); err != nil {
+			fmt.Println("Error saving library index: ", err)
+		}
+	}
+
+	// metadata.json changes: a different API list affects every query, other songs only their own
+	metadata, err := library.getMetadata()
+	if err != nil {
+		metadata = nil
+	}
+	purgeAll := false
+	if !sameJSON(apiList(watcher.lastMetadata), apiList(metadata)) {
+		purgeAll = true
+	} else {
+		songs = append(songs, changedOtherSongs(watcher.lastMetadata, metadata)...)
+	}
+	watcher.lastMetadata = metadata
+
+	if purgeAll {
+		removed := invalidateCacheFiles(watcher.cacheDir, func(cacheQuery) bool { return true })
+		fmt.Printf("metadata.json API list changed, %d cache files removed.\n", removed)
+		return
+	}
+	if len(songs) > 0 {
+		removed := invalidateCacheFiles(watcher.cacheDir, func(query cacheQuery) bool {
+			search, err := parseSearchQuery(query.Msg)
+			if err != nil {
+				return false
+			}
+			for _, song := range songs {
+				if search.score(song, pinyinOfSong(song)) > 0 {
+					return true
+				}
+			}
+			return false
+		})
+		if removed > 0 {
+			fmt.Printf("%d cache files invalidated by library changes.\n", removed)
+		}
+	}
+}
+
+// close function: Stop the watcher and wait for it to finish
+func (watcher *libraryWatcher) close() error {
+	close(watcher.stop)
+	err := watcher.notifier.close()
+	<-watcher.done
+	return err
+}
+
+// apiList function: Return the API list of metadata.json, nil when it cannot be read
+func apiList(metadata *Metadata) []API {
+	if metadata == nil {
+		return nil
+	}
+	return metadata.API
+}
+
+// changedOtherSongs function: Return the "other" songs of metadata.json that were added, removed or edited
+func changedOtherSongs(oldMetadata *Metadata, newMetadata *Metadata) []Song {
+	byJSON := func(metadata *Metadata) map[string]OtherSong {
+		songs := map[string]OtherSong{}
+		if metadata == nil {
+			return songs
+		}
+		for _, otherSong := range metadata.Other {
+			key, _ := json.Marshal(otherSong)
+			songs[string(key)] = otherSong
+		}
+		return songs
+	}
+	oldSongs, newSongs := byJSON(oldMetadata), byJSON(newMetadata)
+
+	var songs []Song
+	diff := func(from map[string]OtherSong, to map[string]OtherSong) {
+		for key, otherSong := range from {
+			if _, ok := to[key]; !ok {
+				songs = append(songs, Song{Song: otherSong.SongName, Singer: otherSong.Singer, Album: otherSong.Album})
+			}
+		}
+	}
+	diff(oldSongs, newSongs)
+	diff(newSongs, oldSongs)
+	return songs
+}
+
+// sameJSON function: Compare two values by their JSON encoding
+func sameJSON(a interface{}, b interface{}) bool {
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	return string(aJSON) == string(bJSON)
+}
+
+// invalidateCacheFiles function: Remove the cache files whose query matches, returning how many were removed
+func invalidateCacheFiles(cacheDir string, match func(query cacheQuery) bool) int {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return 0
+	}
+	index := readCacheIndex(cacheDir)
+	var removed []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !isCacheDataFile(name) {
+			continue
+		}
+		// A file missing from the index is matched as the empty query
+		if !match(index[name]) {
+			continue
+		}
+		apiCache.remove(filepath.Join(cacheDir, name))
+		if err := os.Remove(filepath.Join(cacheDir, name)); err != nil {
+			fmt.Println("Error deleting cache file: ", name, err)
+			continue
+		}
+		removed = append(removed, name)
+	}
+	forgetCacheFiles(cacheDir, removed...)
+	return len(removed)
+}
+
+// Polling notifier, reports a possible change on every tick.
+type pollNotifier struct {
+	ticker *time.Ticker
+	events chan struct{}
+	stop   chan struct{}
+}
+
+// newPollNotifier function: Create a notifier that fires every interval
+func newPollNotifier(interval time.Duration) *pollNotifier {
+	notifier := &pollNotifier{
+		ticker: time.NewTicker(interval),
+		events: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	go func() {
+		for {
+			select {
+			case <-notifier.stop:
+				return
+			case <-notifier.ticker.C:
+				select {
+				case notifier.events <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return notifier
+}
+
+func (notifier *pollNotifier) changes() <-chan struct{} { return notifier.events }
+
+func (notifier *pollNotifier) watchDirs(root string) {}
+
+func (notifier *pollNotifier) close() error {
+	notifier.ticker.Stop()
+	close(notifier.stop)
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// inotify events that can change the library.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_MOVE_SELF | syscall.IN_ATTRIB
+
+// inotify notifier, watches every directory of the media root.
+type inotifyNotifier struct {
+	fd      int
+	file    *os.File
+	events  chan struct{}
+	mu      sync.Mutex
+	watched map[string]bool
+}
+
+// newInotifyNotifier function: Create an inotify instance and watch the whole media root
+func newInotifyNotifier(root string) (fsNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	notifier := &inotifyNotifier{
+		// A non-blocking descriptor is handled by the runtime poller, so close unblocks read
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		events:  make(chan struct{}, 1),
+		watched: map[string]bool{},
+	}
+	if _, err := syscall.InotifyAddWatch(fd, root, inotifyMask); err != nil {
+		notifier.file.Close()
+		return nil, err
+	}
+	notifier.watched[filepath.Clean(root)] = true
+	notifier.watchDirs(root)
+	go notifier.read()
+	return notifier, nil
+}
+
+// read function: Turn inotify events into change notifications
+func (notifier *inotifyNotifier) read() {
+	defer close(notifier.events)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := notifier.file.Read(buf)
+		if err != nil {
+			return
+		}
+		if n < syscall.SizeofInotifyEvent {
+			continue
+		}
+		select {
+		case notifier.events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (notifier *inotifyNotifier) changes() <-chan struct{} { return notifier.events }
+
+// watchDirs function: Add a watch for every directory not watched yet
+func (notifier *inotifyNotifier) watchDirs(root string) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	seen := map[string]bool{}
+	walkLibraryDirs(root, func(relDir string, entries []os.DirEntry) {
+		path := filepath.Join(root, relDir)
+		seen[path] = true
+		if notifier.watched[path] {
+			return
+		}
+		if _, err := syscall.InotifyAddWatch(notifier.fd, path, inotifyMask); err == nil {
+			notifier.watched[path] = true
+		}
+	})
+	// Watches of removed directories are dropped by the kernel
+	for path := range notifier.watched {
+		if !seen[path] {
+			delete(notifier.watched, path)
+		}
+	}
+}
+
+func (notifier *inotifyNotifier) close() error {
+	return notifier.file.Close()
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// newInotifyNotifier function: inotify is only available on Linux, other systems use polling
+func newInotifyNotifier(root string) (fsNotifier, error) {
+	return nil, errors.New("inotify is not supported on this system")
+}
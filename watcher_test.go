@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Notifier driven by the test.
+type fakeNotifier struct {
+	events chan struct{}
+}
+
+func (notifier *fakeNotifier) changes() <-chan struct{} { return notifier.events }
+
+func (notifier *fakeNotifier) watchDirs(root string) {}
+
+func (notifier *fakeNotifier) close() error { return nil }
+
+// TestLibraryWatcherInvalidatesCache Test that the watcher only removes the cache files affected by a change
+func TestLibraryWatcherInvalidatesCache(t *testing.T) {
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+	t.Setenv("MEDIA_ROOT", root)
+	writeTestFile(t, root, "metadata.json", []byte(`{"api":[],"other":[{"song_name":"Rain","singer":"Meow"}]}`))
+	writeTestFile(t, root, "Singer-Song@Album/standard.mp3", []byte("audio"))
+	cacheFile := func(msg string) string {
+		return cacheFilePathFor(cacheDir, newCacheQuery(msg))
+	}
+	for _, msg := range []string{"Song", "Tune", "Rain", "Snow"} {
+		writeCacheFile(cacheFile(msg), []Song{}, "")
+		recordCacheQuery(cacheDir, newCacheQuery(msg))
+	}
+	writeTestFile(t, cacheDir, "embedded.json", []byte(`{"songs":[],"timestamp":""}`))
+
+	// Start from an up to date index
+	defer func(previous *libraryIndex) { library = previous }(library)
+	library = newLibraryIndex()
+	if _, err := library.refresh(); err != nil {
+		t.Fatalf("refresh returns error: %s", err)
+	}
+	notifier := &fakeNotifier{events: make(chan struct{}, 1)}
+	watcher := newLibraryWatcher(root, cacheDir, filepath.Join(t.TempDir(), "library.json"), notifier)
+	watcher.debounce = time.Millisecond
+
+	// A new song folder and a new "other" song
+	writeTestFile(t, root, "Band-Tune@Record/standard.mp3", []byte("audio"))
+	later := time.Now().Add(time.Minute)
+	writeTestFile(t, root, "metadata.json", []byte(`{"api":[],"other":[{"song_name":"Rain","singer":"Meow"},{"song_name":"Snow","singer":"Meow"}]}`))
+	os.Chtimes(filepath.Join(root, "metadata.json"), later, later)
+	os.Chtimes(root, later, later)
+	watcher.apply()
+
+	for msg, want := range map[string]bool{"Song": true, "Tune": false, "Rain": true, "Snow": false} {
+		_, err := os.Stat(cacheFile(msg))
+		if exists := err == nil; exists != want {
+			t.Errorf("Cache file of %q exists: %v, want %v", msg, exists, want)
+		}
+	}
+	if index := readCacheIndex(cacheDir); len(index) != 2 {
+		t.Errorf("Expected 2 queries left in the cache index, got %+v", index)
+	}
+	if songs := library.songs(); len(songs) != 2 {
+		t.Errorf("Expected 2 songs in the library index, got %d", len(songs))
+	}
+
+	// A changed API list purges every query
+	writeTestFile(t, root, "metadata.json", []byte(`{"api":[{"api_url":"http://127.0.0.1/api"}],"other":[]}`))
+	later = later.Add(time.Minute)
+	os.Chtimes(filepath.Join(root, "metadata.json"), later, later)
+	go watcher.run()
+	notifier.events <- struct{}{}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(cacheFile("Song")); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Cache was not purged after the API list changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := watcher.close(); err != nil {
+		t.Errorf("close returns error: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "embedded.json")); err != nil {
+		t.Errorf("embedded.json must be kept: %s", err)
+	}
+}
+
+// TestInotifyNotifier Test that the inotify notifier reports changes in new subdirectories
+func TestInotifyNotifier(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("inotify is only available on Linux")
+	}
+	root := t.TempDir()
+	notifier, err := newInotifyNotifier(root)
+	if err != nil {
+		t.Skipf("inotify is not available: %s", err)
+	}
+	defer notifier.close()
+
+	wait := func(what string) {
+		select {
+		case <-notifier.changes():
+		case <-time.After(2 * time.Second):
+			t.Fatalf("No change reported after %s", what)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "Singer-Song@Album"), 0777); err != nil {
+		t.Fatalf("Cannot create directory: %s", err)
+	}
+	wait("creating a folder")
+
+	notifier.watchDirs(root)
+	writeTestFile(t, root, "Singer-Song@Album/standard.mp3", []byte("audio"))
+	wait("writing a file in the new folder")
+}
+
+// TestNewFsNotifier Test that only WATCHER_MODE=auto falls back to polling when inotify cannot start
+func TestNewFsNotifier(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	if notifier, err := newFsNotifier("inotify", missing); err == nil {
+		notifier.close()
+		t.Errorf("WATCHER_MODE=inotify should fail without a media root to watch")
+	}
+	for _, mode := range []string{"auto", "poll"} {
+		notifier, err := newFsNotifier(mode, missing)
+		if err != nil {
+			t.Errorf("WATCHER_MODE=%s: unexpected error %s", mode, err)
+			continue
+		}
+		if _, ok := notifier.(*pollNotifier); !ok {
+			t.Errorf("WATCHER_MODE=%s: got %T, want polling", mode, notifier)
+		}
+		notifier.close()
+	}
+}